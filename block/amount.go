@@ -0,0 +1,89 @@
+package block
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Amount is a quantity of coin in its smallest unit. Integer arithmetic
+// keeps balances exact however many transactions they sum.
+type Amount int64
+
+const (
+	AMOUNT_DECIMALS        = 8
+	COIN            Amount = 100000000
+)
+
+// ParseAmount reads a decimal coin amount such as "1.5" or "0.00000001".
+// More than AMOUNT_DECIMALS fractional digits is an error rather than being
+// rounded away.
+func ParseAmount(s string) (Amount, error) {
+	str := strings.TrimSpace(s)
+	negative := strings.HasPrefix(str, "-")
+	if negative {
+		str = str[1:]
+	}
+	whole, frac := str, ""
+	if i := strings.IndexByte(str, '.'); i >= 0 {
+		whole, frac = str[:i], str[i+1:]
+	}
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(frac) > AMOUNT_DECIMALS {
+		return 0, fmt.Errorf("invalid amount %q: more than %d decimal places", s, AMOUNT_DECIMALS)
+	}
+	var w, f uint64
+	var err error
+	if whole != "" {
+		if w, err = strconv.ParseUint(whole, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid amount %q: out of range", s)
+		}
+	}
+	if frac != "" {
+		f, _ = strconv.ParseUint(frac+strings.Repeat("0", AMOUNT_DECIMALS-len(frac)), 10, 64)
+	}
+	if w > (math.MaxInt64-f)/uint64(COIN) {
+		return 0, fmt.Errorf("invalid amount %q: out of range", s)
+	}
+	units := Amount(w*uint64(COIN) + f)
+	if negative {
+		units = -units
+	}
+	return units, nil
+}
+
+// addAmounts returns a+b, and false if the sum overflows Amount.
+func addAmounts(a, b Amount) (Amount, bool) {
+	if b > 0 && a > math.MaxInt64-b || b < 0 && a < math.MinInt64-b {
+		return 0, false
+	}
+	return a + b, true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// String formats a as a decimal coin amount without trailing zeros.
+func (a Amount) String() string {
+	sign := ""
+	u := uint64(a)
+	if a < 0 {
+		sign = "-"
+		u = uint64(-a)
+	}
+	whole, frac := u/uint64(COIN), u%uint64(COIN)
+	if frac == 0 {
+		return fmt.Sprintf("%s%d", sign, whole)
+	}
+	fracStr := strings.TrimRight(fmt.Sprintf("%0*d", AMOUNT_DECIMALS, frac), "0")
+	return fmt.Sprintf("%s%d.%s", sign, whole, fracStr)
+}
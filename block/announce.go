@@ -0,0 +1,223 @@
+package block
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goblockchain/utils"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// ANNOUNCE_MAX_AGE bounds how old, or how far ahead, an announcement's
+	// timestamp may be, so a captured announcement cannot be replayed later.
+	ANNOUNCE_MAX_AGE = 5 * time.Minute
+	// MAX_ANNOUNCED_PEERS caps how many announced peers a node keeps.
+	MAX_ANNOUNCED_PEERS = 256
+)
+
+// Announcement is a node advertising the address it serves on to a
+// bootstrap node, signed with the node's key.
+type Announcement struct {
+	Address   string `json:"address"`
+	Timestamp int64  `json:"timestamp"`
+	PublicKey string `json:"publicKey"`
+	Signature string `json:"signature"`
+}
+
+type AnnounceResponse struct {
+	Peers []string `json:"peers"`
+}
+
+func (a *Announcement) digest() [32]byte {
+	m, _ := json.Marshal(struct {
+		Address   string `json:"address"`
+		Timestamp int64  `json:"timestamp"`
+		PublicKey string `json:"publicKey"`
+	}{a.Address, a.Timestamp, a.PublicKey})
+	return sha256.Sum256(m)
+}
+
+// NewAnnouncement signs address, a host:port, with privateKey.
+func NewAnnouncement(address string, privateKey *ecdsa.PrivateKey) (*Announcement, error) {
+	a := &Announcement{
+		Address:   address,
+		Timestamp: time.Now().UnixNano(),
+		PublicKey: fmt.Sprintf("%064x%064x", privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()),
+	}
+	h := a.digest()
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, h[:])
+	if err != nil {
+		return nil, err
+	}
+	a.Signature = (&utils.Signature{R: r, S: s}).String()
+	return a, nil
+}
+
+// Verify checks that a is well formed, fresh as of now and signed by the
+// key it carries.
+func (a *Announcement) Verify(now time.Time) error {
+	if err := ValidatePeerAddress(a.Address); err != nil {
+		return fmt.Errorf("announcement: %v", err)
+	}
+	age := now.Sub(time.Unix(0, a.Timestamp))
+	if age > ANNOUNCE_MAX_AGE || age < -ANNOUNCE_MAX_AGE {
+		return fmt.Errorf("announcement: timestamp %v outside %v of now", time.Unix(0, a.Timestamp), ANNOUNCE_MAX_AGE)
+	}
+	publicKey, err := utils.ParsePublicKey(a.PublicKey)
+	if err != nil {
+		return fmt.Errorf("announcement: %v", err)
+	}
+	signature, err := utils.ParseSignature(a.Signature)
+	if err != nil {
+		return fmt.Errorf("announcement: %v", err)
+	}
+	h := a.digest()
+	if !ecdsa.Verify(publicKey, h[:], signature.R, signature.S) {
+		return errors.New("announcement: invalid signature")
+	}
+	return nil
+}
+
+// HandleAnnouncement verifies a, adds the announcer to the neighbours and
+// returns the other peers this node knows. The signature only shows the
+// announcer holds the key, so the announced address is called back on /ping
+// and must serve that same key.
+func (bc *Blockchain) HandleAnnouncement(a *Announcement) ([]string, error) {
+	if err := a.Verify(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := bc.checkAnnouncedPeerRoom(a.Address); err != nil {
+		return nil, err
+	}
+	key, err := bc.fetchNodeKey(a.Address)
+	if err != nil {
+		return nil, fmt.Errorf("announcement: %s: %v", a.Address, err)
+	}
+	if key != a.PublicKey {
+		return nil, fmt.Errorf("announcement: %s does not serve the announced key", a.Address)
+	}
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	// Checked again, since other announcements may have landed during the
+	// call back.
+	if err := bc.announcedPeerRoom(a.Address); err != nil {
+		return nil, err
+	}
+	peers := make([]string, 0, len(bc.neighbours))
+	for _, n := range bc.neighbours {
+		if n != a.Address {
+			peers = append(peers, n)
+		}
+	}
+	bc.announcedPeers = mergePeers(bc.announcedPeers, []string{a.Address})
+	bc.neighbours = mergePeers(bc.neighbours, []string{a.Address})
+	bc.logger.Info("peer announced", "action", "announce", "peer", a.Address)
+	return peers, nil
+}
+
+func (bc *Blockchain) checkAnnouncedPeerRoom(address string) error {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	return bc.announcedPeerRoom(address)
+}
+
+// announcedPeerRoom reports whether address is already announced or there
+// is room for it under MAX_ANNOUNCED_PEERS. The caller must hold
+// muxNeighbours.
+func (bc *Blockchain) announcedPeerRoom(address string) error {
+	for _, p := range bc.announcedPeers {
+		if p == address {
+			return nil
+		}
+	}
+	if len(bc.announcedPeers) >= MAX_ANNOUNCED_PEERS {
+		return ErrTooManyAnnouncedPeers
+	}
+	return nil
+}
+
+// fetchNodeKey asks address for the node key it answers /ping with.
+func (bc *Blockchain) fetchNodeKey(address string) (string, error) {
+	client, _ := bc.peerClient()
+	resp, err := client.Get(fmt.Sprintf("http://%s/ping", address))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var pr PingResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<12)).Decode(&pr); err != nil {
+		return "", err
+	}
+	return pr.PublicKey, nil
+}
+
+// NodePublicKey returns the public half of the node key, the proposer key,
+// as announcements carry it, or "" if none is set.
+func (bc *Blockchain) NodePublicKey() string {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if bc.proposerKey == nil {
+		return ""
+	}
+	return fmt.Sprintf("%064x%064x", bc.proposerKey.PublicKey.X.Bytes(), bc.proposerKey.PublicKey.Y.Bytes())
+}
+
+// Announce advertises address to bootstrap, signed with the proposer key,
+// and adds bootstrap and the peers it returns to the neighbours. Announced
+// peers survive neighbour rescans.
+func (bc *Blockchain) Announce(bootstrap string, address string) error {
+	bc.mux.RLock()
+	key := bc.proposerKey
+	bc.mux.RUnlock()
+	if key == nil {
+		return errors.New("announce: no node key set")
+	}
+	a, err := NewAnnouncement(address, key)
+	if err != nil {
+		return err
+	}
+	m, _ := json.Marshal(a)
+	client, maxBytes := bc.peerClient()
+	resp, err := client.Post(fmt.Sprintf("http://%s/announce", bootstrap), "application/json", bytes.NewReader(m))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("announce: unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > maxBytes {
+		return fmt.Errorf("announce: response larger than %d bytes", maxBytes)
+	}
+	var ar AnnounceResponse
+	if err := json.Unmarshal(body, &ar); err != nil {
+		return err
+	}
+
+	peers := []string{bootstrap}
+	for _, p := range ar.Peers {
+		if p != address {
+			peers = append(peers, p)
+		}
+	}
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	bc.announcedPeers = mergePeers(bc.announcedPeers, peers)
+	bc.neighbours = mergePeers(bc.neighbours, peers)
+	bc.logger.Info("announced", "action", "announce", "bootstrap", bootstrap, "peers", len(ar.Peers))
+	return nil
+}
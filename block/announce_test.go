@@ -0,0 +1,92 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveNodeKey answers /ping with key's public half, like a node's server,
+// and returns its host:port.
+func serveNodeKey(t *testing.T, key testKey) string {
+	t.Helper()
+	node := &Blockchain{proposerKey: key.private}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m, _ := json.Marshal(PingResponse{PublicKey: node.NodePublicKey()})
+		w.Write(m)
+	}))
+	t.Cleanup(ts.Close)
+	return strings.TrimPrefix(ts.URL, "http://")
+}
+
+func TestHandleAnnouncementChecksTheAddress(t *testing.T) {
+	bootstrap := newTestBlockchain(t, newTestKey(t).address)
+	owner, intruder := newTestKey(t), newTestKey(t)
+	address := serveNodeKey(t, owner)
+
+	a, err := NewAnnouncement(address, intruder.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bootstrap.HandleAnnouncement(a); err == nil {
+		t.Fatal("announcement of an address serving another key accepted")
+	}
+
+	a, err = NewAnnouncement("127.0.0.1:0", owner.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bootstrap.HandleAnnouncement(a); err == nil {
+		t.Fatal("announcement of an invalid address accepted")
+	}
+
+	a, err = NewAnnouncement(address, owner.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bootstrap.HandleAnnouncement(a); err != nil {
+		t.Fatalf("genuine announcement: %v", err)
+	}
+	found := false
+	for _, n := range bootstrap.Neighbours() {
+		found = found || n == address
+	}
+	if !found {
+		t.Fatal("announced peer not added to the neighbours")
+	}
+}
+
+func TestHandleAnnouncementCapsAnnouncedPeers(t *testing.T) {
+	bootstrap := newTestBlockchain(t, newTestKey(t).address)
+	key := newTestKey(t)
+	address := serveNodeKey(t, key)
+	bootstrap.muxNeighbours.Lock()
+	for i := 0; i < MAX_ANNOUNCED_PEERS-1; i++ {
+		bootstrap.announcedPeers = append(bootstrap.announcedPeers, fmt.Sprintf("10.0.%d.%d:5001", i/256, i%256))
+	}
+	bootstrap.muxNeighbours.Unlock()
+
+	a, err := NewAnnouncement(address, key.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bootstrap.HandleAnnouncement(a); err != nil {
+		t.Fatalf("announcement filling the last slot: %v", err)
+	}
+	if _, err := bootstrap.HandleAnnouncement(a); err != nil {
+		t.Fatalf("re-announcement of a known peer: %v", err)
+	}
+
+	other := newTestKey(t)
+	a, err = NewAnnouncement(serveNodeKey(t, other), other.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bootstrap.HandleAnnouncement(a); !errors.Is(err, ErrTooManyAnnouncedPeers) {
+		t.Fatalf("announcement over the cap: got %v, want ErrTooManyAnnouncedPeers", err)
+	}
+}
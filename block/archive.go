@@ -0,0 +1,158 @@
+package block
+
+import "fmt"
+
+// txLocation is where a confirmed transaction sits in the chain.
+type txLocation struct {
+	height int
+	index  int
+}
+
+// archiveIndex holds the lookups an archive node keeps for every block.
+type archiveIndex struct {
+	transactions map[[32]byte]txLocation
+	addresses    map[string][]txLocation
+	// balances[h] is every address's balance after block h.
+	balances []map[string]Amount
+}
+
+// SetArchiveMode turns the archive indexes on or off. An archive node
+// indexes every confirmed transaction by ID and by address, and keeps a
+// balance checkpoint for every address at every height, so TransactionByID,
+// AddressHistory and BalanceAtHeight answer without replaying the chain.
+// The checkpoints grow with heights times addresses, so memory rises
+// quickly on long chains; lean nodes, the default, scan the chain instead.
+// Enabling it indexes the current chain, so set it right after
+// construction.
+func (bc *Blockchain) SetArchiveMode(enabled bool) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if !enabled {
+		bc.archive = nil
+		return
+	}
+	if bc.snapshot != nil {
+		bc.logger.Warn("archive mode unavailable on a pruned chain", "pruned_height", bc.snapshot.Height)
+		return
+	}
+	bc.reindexArchive()
+}
+
+// ArchiveMode reports whether the archive indexes are maintained.
+func (bc *Blockchain) ArchiveMode() bool {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.archive != nil
+}
+
+// reindexArchive rebuilds the archive indexes from the whole chain. The
+// caller must hold bc.mux.
+func (bc *Blockchain) reindexArchive() {
+	bc.archive = &archiveIndex{
+		transactions: make(map[[32]byte]txLocation),
+		addresses:    make(map[string][]txLocation),
+	}
+	for height := range bc.Chain {
+		bc.indexBlock(height)
+	}
+}
+
+// indexBlock adds the block at height, which must follow the last indexed
+// one, to the archive indexes. The caller must hold bc.mux.
+func (bc *Blockchain) indexBlock(height int) {
+	a := bc.archive
+	balances := make(map[string]Amount)
+	if height > 0 {
+		for addr, v := range a.balances[height-1] {
+			balances[addr] = v
+		}
+	}
+	b := bc.Chain[height]
+	for i, t := range b.Transactions {
+		loc := txLocation{height: height, index: i}
+		a.transactions[t.ID()] = loc
+		a.addresses[t.RecipientBlockchainAddress] = append(a.addresses[t.RecipientBlockchainAddress], loc)
+		if t.SenderBlockchainAddress != t.RecipientBlockchainAddress {
+			a.addresses[t.SenderBlockchainAddress] = append(a.addresses[t.SenderBlockchainAddress], loc)
+		}
+	}
+	applyBlock(balances, b)
+	a.balances = append(a.balances, balances)
+}
+
+// TransactionByID returns the confirmed transaction with the given ID and
+// the height of its block.
+func (bc *Blockchain) TransactionByID(id [32]byte) (*Transaction, int, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if bc.archive != nil {
+		loc, ok := bc.archive.transactions[id]
+		if !ok {
+			return nil, 0, ErrTransactionNotFound
+		}
+		return bc.Chain[loc.height].Transactions[loc.index], loc.height, nil
+	}
+	for height, b := range bc.Chain {
+		for _, t := range b.Transactions {
+			if t.ID() == id {
+				return t, height, nil
+			}
+		}
+	}
+	return nil, 0, ErrTransactionNotFound
+}
+
+// FindTransaction returns the earliest confirmed transaction with the given
+// content hash and the height of its block.
+func (bc *Blockchain) FindTransaction(txHash [32]byte) (*Transaction, int, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	for height, b := range bc.Chain {
+		for _, t := range b.Transactions {
+			if t.Hash() == txHash {
+				return t, height, nil
+			}
+		}
+	}
+	return nil, 0, ErrTransactionNotFound
+}
+
+// AddressHistory returns every confirmed transaction that addr sent or
+// received, oldest first.
+func (bc *Blockchain) AddressHistory(addr string) []*Transaction {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	var history []*Transaction
+	if bc.archive != nil {
+		for _, loc := range bc.archive.addresses[addr] {
+			history = append(history, bc.Chain[loc.height].Transactions[loc.index])
+		}
+		return history
+	}
+	for _, b := range bc.Chain {
+		for _, t := range b.Transactions {
+			if t.SenderBlockchainAddress == addr || t.RecipientBlockchainAddress == addr {
+				history = append(history, t)
+			}
+		}
+	}
+	return history
+}
+
+// BalanceAtHeight returns addr's balance once the block at height is
+// applied.
+func (bc *Blockchain) BalanceAtHeight(addr string, height int) (Amount, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if height < 0 || height >= len(bc.Chain) {
+		return 0, fmt.Errorf("height %d outside [0, %d]", height, len(bc.Chain)-1)
+	}
+	if bc.archive != nil {
+		return bc.archive.balances[height][addr], nil
+	}
+	balances, err := bc.balancesBefore(height + 1)
+	if err != nil {
+		return 0, err
+	}
+	return balances[addr], nil
+}
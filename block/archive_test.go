@@ -0,0 +1,81 @@
+package block
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestArchiveAndLeanAgree builds the same history on an archive node and a
+// lean one. Both must answer every query alike, the archive from its
+// indexes and the lean node by scanning; once pruned, the lean node can no
+// longer answer for the heights it dropped.
+func TestArchiveAndLeanAgree(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	archive := newTestBlockchain(t, alice.address)
+	archive.SetArchiveMode(true)
+	lean := newTestBlockchain(t, alice.address)
+	if !archive.ArchiveMode() || lean.ArchiveMode() {
+		t.Fatal("archive mode is not set as configured")
+	}
+
+	var transfer *Transaction
+	for _, bc := range []*Blockchain{archive, lean} {
+		mineBlocks(t, bc, 2)
+		transfer = NewTransaction(alice.address, bob.address, MINING_REWARD/2)
+		if err := bc.AddSignedTransactionE(transfer, &alice.private.PublicKey, alice.sign(t, transfer)); err != nil {
+			t.Fatal(err)
+		}
+		mineBlocks(t, bc, 2)
+	}
+
+	for name, bc := range map[string]*Blockchain{"archive": archive, "lean": lean} {
+		for height, want := range []Amount{0, 0, 0, MINING_REWARD / 2, MINING_REWARD / 2} {
+			got, err := bc.BalanceAtHeight(bob.address, height)
+			if err != nil {
+				t.Fatalf("%s: height %d: %v", name, height, err)
+			}
+			if got != want {
+				t.Errorf("%s: bob's balance at height %d is %s, want %s", name, height, got, want)
+			}
+		}
+		if got, want := mustBalanceAt(t, bc, alice.address, 4), 7*MINING_REWARD/2; got != want {
+			t.Errorf("%s: alice's balance at the tip is %s, want %s", name, got, want)
+		}
+		if _, err := bc.BalanceAtHeight(bob.address, 5); err == nil {
+			t.Errorf("%s: no error for a height past the tip", name)
+		}
+
+		if history := bc.AddressHistory(bob.address); len(history) != 1 || history[0].ID() != transfer.ID() {
+			t.Errorf("%s: bob's history holds %d transactions, want the transfer", name, len(history))
+		}
+		if _, height, err := bc.TransactionByID(transfer.ID()); err != nil || height != 3 {
+			t.Errorf("%s: TransactionByID = height %d, %v; want height 3", name, height, err)
+		}
+	}
+
+	if err := archive.Prune(1); err == nil {
+		t.Fatal("an archive node was pruned")
+	}
+	if err := lean.Prune(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lean.BalanceAtHeight(bob.address, 1); err == nil || !strings.Contains(err.Error(), "pruned") {
+		t.Errorf("pruned height: got %v, want a pruned error", err)
+	}
+	if got := mustBalanceAt(t, lean, bob.address, 4); got != MINING_REWARD/2 {
+		t.Errorf("pruned lean node: bob's balance at the tip is %s, want %s", got, MINING_REWARD/2)
+	}
+	lean.SetArchiveMode(true)
+	if lean.ArchiveMode() {
+		t.Error("archive mode was enabled on a pruned chain")
+	}
+}
+
+func mustBalanceAt(t *testing.T, bc *Blockchain, addr string, height int) Amount {
+	t.Helper()
+	balance, err := bc.BalanceAtHeight(addr, height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return balance
+}
@@ -0,0 +1,287 @@
+package block
+
+import "fmt"
+
+// balances returns a copy of the confirmed balances the caller may modify.
+// The caller must hold bc.mux.
+func (bc *Blockchain) balances() map[string]Amount {
+	balances := make(map[string]Amount, len(bc.balanceIndex))
+	for addr, v := range bc.balanceIndex {
+		balances[addr] = v
+	}
+	return balances
+}
+
+// Balance returns address's confirmed balance from the balance index, which
+// is updated as blocks are added and rebuilt when the chain is replaced.
+// CalculateTotalAmount gives the same figure by replaying the chain.
+func (bc *Blockchain) Balance(address string) Amount {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.balanceIndex[address]
+}
+
+func chainBalances(chain []*Block) map[string]Amount {
+	balances := make(map[string]Amount)
+	for _, b := range chain {
+		applyBlock(balances, b)
+	}
+	return balances
+}
+
+func applyBlock(balances map[string]Amount, b *Block) {
+	for _, t := range b.Transactions {
+		balances[t.RecipientBlockchainAddress] += t.Value
+		balances[t.SenderBlockchainAddress] -= t.Value + t.Fee
+	}
+}
+
+// cost is what t takes from its sender, its value plus its fee. ok is false
+// if the sum overflows Amount; admission and chain validation refuse such
+// transactions.
+func (t *Transaction) cost() (cost Amount, ok bool) {
+	return addAmounts(t.Value, t.Fee)
+}
+
+func (bc *Blockchain) pendingFees() Amount {
+	var fees Amount
+	for _, t := range bc.TransactionPool {
+		fees += t.Fee
+	}
+	return fees
+}
+
+func blockFees(b *Block, params NetworkParams) Amount {
+	var fees Amount
+	for _, t := range b.Transactions {
+		if !params.isCoinbase(t.SenderBlockchainAddress) {
+			fees += t.Fee
+		}
+	}
+	return fees
+}
+
+// Simulate applies txs in order against a copy of the confirmed balances
+// without touching the chain or the transaction pool. Transactions the
+// sender cannot fund at their position are rejected and leave the
+// balances unchanged.
+func (bc *Blockchain) Simulate(txs []*Transaction) (applied []*Transaction, rejected []*Transaction, balances map[string]Amount) {
+	bc.mux.RLock()
+	balances = bc.balances()
+	params := bc.params
+	bc.mux.RUnlock()
+	for _, t := range txs {
+		cost, ok := t.cost()
+		if !ok || t.Value < 0 || t.Fee < 0 {
+			rejected = append(rejected, t)
+			continue
+		}
+		if !params.isCoinbase(t.SenderBlockchainAddress) && balances[t.SenderBlockchainAddress] < cost {
+			rejected = append(rejected, t)
+			continue
+		}
+		credited, ok := addAmounts(balances[t.RecipientBlockchainAddress], t.Value)
+		if !ok {
+			rejected = append(rejected, t)
+			continue
+		}
+		balances[t.RecipientBlockchainAddress] = credited
+		balances[t.SenderBlockchainAddress] -= cost
+		applied = append(applied, t)
+	}
+	return applied, rejected, balances
+}
+
+// AuditBalances replays the chain transaction by transaction and reports the
+// first transaction that leaves its sender with a negative balance or moves
+// a negative amount, which would drain its recipient instead.
+func (bc *Blockchain) AuditBalances() error {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	from, balances, _ := bc.snapshot.start()
+	return auditBalances(bc.Chain, bc.params, from, balances)
+}
+
+// auditBalances replays chain from height from, starting with the balances
+// left by the blocks below it.
+func auditBalances(chain []*Block, params NetworkParams, from int, balances map[string]Amount) error {
+	for height := from; height < len(chain); height++ {
+		for i, t := range chain[height].Transactions {
+			if t.Value < 0 || t.Fee < 0 {
+				return blockErrorf(height, "transaction %d: negative value %s or fee %s", i, t.Value, t.Fee)
+			}
+			cost, ok := t.cost()
+			if !ok {
+				return blockErrorf(height, "transaction %d: value %s plus fee %s overflows", i, t.Value, t.Fee)
+			}
+			credited, ok := addAmounts(balances[t.RecipientBlockchainAddress], t.Value)
+			if !ok {
+				return blockErrorf(height, "transaction %d: balance of %s overflows", i, t.RecipientBlockchainAddress)
+			}
+			balances[t.RecipientBlockchainAddress] = credited
+			if params.isCoinbase(t.SenderBlockchainAddress) {
+				continue
+			}
+			balances[t.SenderBlockchainAddress] -= cost
+			if balances[t.SenderBlockchainAddress] < 0 {
+				return blockErrorf(height, "transaction %d: balance of %s drops to %s",
+					i, t.SenderBlockchainAddress, balances[t.SenderBlockchainAddress])
+			}
+		}
+	}
+	return nil
+}
+
+// PruneUnfundablePool drops pooled transactions the sender can no longer
+// afford from their confirmed balance, taking earlier pooled spends by the
+// same sender into account, and with SetAcceptPendingCredits also earlier
+// pooled credits. Transactions whose RecentBlockHash no longer names a
+// recent block, and nonces that do not follow on from the sender's last,
+// are dropped too. It returns the dropped transactions.
+func (bc *Blockchain) PruneUnfundablePool() []*Transaction {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.pruneUnfundablePool()
+}
+
+// pruneUnfundablePool is PruneUnfundablePool for callers that hold bc.mux.
+func (bc *Blockchain) pruneUnfundablePool() []*Transaction {
+	balances := bc.balances()
+	kept := make([]*Transaction, 0, len(bc.TransactionPool))
+	var pruned []*Transaction
+	nonces := bc.lastNonces()
+	var hashes []string
+	window := bc.params.At(len(bc.Chain)).RecentBlockWindow
+	for _, t := range bc.TransactionPool {
+		if t.RecentBlockHash != "" {
+			if hashes == nil {
+				hashes = blockHashes(bc.Chain)
+			}
+			// A reorg or the tip moving on can orphan the reference.
+			if checkBlockReference(hashes, t.RecentBlockHash, window) != nil {
+				pruned = append(pruned, t)
+				continue
+			}
+		}
+		if !bc.params.isCoinbase(t.SenderBlockchainAddress) {
+			// Once one nonce is dropped, the sender's later ones no longer
+			// follow on and go too.
+			cost, ok := t.cost()
+			if !ok || balances[t.SenderBlockchainAddress] < cost || t.Nonce != 0 && t.Nonce != nonces[t.SenderBlockchainAddress]+1 {
+				pruned = append(pruned, t)
+				continue
+			}
+			balances[t.SenderBlockchainAddress] -= cost
+			if t.Nonce != 0 {
+				nonces[t.SenderBlockchainAddress] = t.Nonce
+			}
+		}
+		if bc.acceptPendingCredits {
+			if credited, ok := addAmounts(balances[t.RecipientBlockchainAddress], t.Value); ok {
+				balances[t.RecipientBlockchainAddress] = credited
+			}
+		}
+		kept = append(kept, t)
+	}
+	bc.TransactionPool = kept
+	if len(pruned) > 0 {
+		bc.logger.Info("pruned transaction pool", "action", "prune_pool", "pruned", len(pruned))
+	}
+	return pruned
+}
+
+// SetAcceptPendingCredits lets a sender spend funds that are still only
+// pending in the pool, such as change from a transaction that has not been
+// mined yet. The spend depends on its parent: if the parent is pruned or
+// never mined, the child is pruned with it, so clients may see an accepted
+// transaction disappear. It is off by default, when only confirmed balances
+// count.
+func (bc *Blockchain) SetAcceptPendingCredits(accept bool) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.acceptPendingCredits = accept
+}
+
+// availableBalance is what sender may spend in a new pooled transaction:
+// the confirmed balance less what the sender's pooled transactions already
+// spend, so several pending transactions cannot together overdraw it. The
+// caller must hold bc.mux.
+func (bc *Blockchain) availableBalance(sender string) Amount {
+	balance := bc.balanceIndex[sender]
+	for _, t := range bc.TransactionPool {
+		if bc.acceptPendingCredits && t.RecipientBlockchainAddress == sender {
+			if credited, ok := addAmounts(balance, t.Value); ok {
+				balance = credited
+			}
+		}
+		if t.SenderBlockchainAddress == sender {
+			cost, ok := t.cost()
+			if !ok {
+				return 0
+			}
+			if balance, ok = addAmounts(balance, -cost); !ok {
+				return 0
+			}
+		}
+	}
+	return balance
+}
+
+// TransactionEffect returns the balances of the sender and recipient of the
+// transaction with ID id just before and just after the block that holds
+// it. Coinbase and genesis senders have no balance and report zero.
+func (bc *Blockchain) TransactionEffect(id [32]byte) (senderBefore, senderAfter, recipientBefore, recipientAfter Amount, err error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	for height, b := range bc.Chain {
+		for _, t := range b.Transactions {
+			if t.ID() != id {
+				continue
+			}
+			before, err := bc.balancesBefore(height)
+			if err != nil {
+				return 0, 0, 0, 0, err
+			}
+			after, _ := bc.balancesBefore(height + 1)
+			if !bc.params.isCoinbase(t.SenderBlockchainAddress) {
+				senderBefore = before[t.SenderBlockchainAddress]
+				senderAfter = after[t.SenderBlockchainAddress]
+			}
+			recipientBefore = before[t.RecipientBlockchainAddress]
+			recipientAfter = after[t.RecipientBlockchainAddress]
+			return senderBefore, senderAfter, recipientBefore, recipientAfter, nil
+		}
+	}
+	return 0, 0, 0, 0, ErrTransactionNotFound
+}
+
+// MinBalanceOverRange returns the lowest balance addr held from the start of
+// block fromHeight through the end of block toHeight, replaying each
+// transaction in order.
+func (bc *Blockchain) MinBalanceOverRange(addr string, fromHeight, toHeight int) (Amount, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if fromHeight < 0 || toHeight >= len(bc.Chain) || fromHeight > toHeight {
+		return 0, fmt.Errorf("height range [%d, %d] outside [0, %d]", fromHeight, toHeight, len(bc.Chain)-1)
+	}
+	balances, err := bc.balancesBefore(fromHeight)
+	if err != nil {
+		return 0, err
+	}
+	balance := balances[addr]
+	min := balance
+	for _, b := range bc.Chain[fromHeight : toHeight+1] {
+		for _, t := range b.Transactions {
+			if t.RecipientBlockchainAddress == addr {
+				balance += t.Value
+			}
+			if t.SenderBlockchainAddress == addr {
+				balance -= t.Value + t.Fee
+			}
+			if balance < min {
+				min = balance
+			}
+		}
+	}
+	return min, nil
+}
@@ -0,0 +1,396 @@
+package block
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestOverflowingCostIsRefused submits a transfer whose value plus fee
+// overflows Amount. It must be refused, and a chain holding one must fail
+// validation rather than credit the recipient.
+func TestOverflowingCostIsRefused(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+
+	tx := NewTransaction(alice.address, bob.address, math.MaxInt64)
+	tx.Fee = 1
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); !errors.Is(err, ErrAmountOverflow) {
+		t.Fatalf("got %v, want ErrAmountOverflow", err)
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 0 {
+		t.Fatalf("pool holds %d transactions", len(pool))
+	}
+
+	applied, rejected, _ := bc.Simulate([]*Transaction{tx})
+	if len(applied) != 0 || len(rejected) != 1 {
+		t.Fatalf("Simulate applied %d and rejected %d, want 0 and 1", len(applied), len(rejected))
+	}
+
+	chain := append(append([]*Block(nil), bc.Chain...), newBlock(0, bc.LastBlock().Hash(), []*Transaction{tx}))
+	if err := auditBalances(chain, bc.Params(), 0, make(map[string]Amount)); err == nil {
+		t.Fatal("a chain with an overflowing transaction passed the audit")
+	}
+}
+
+func TestAddAmounts(t *testing.T) {
+	for _, tc := range []struct {
+		a, b Amount
+		ok   bool
+	}{
+		{1, 2, true},
+		{math.MaxInt64, 0, true},
+		{math.MaxInt64, 1, false},
+		{math.MinInt64, -1, false},
+		{math.MinInt64, math.MaxInt64, true},
+	} {
+		if _, ok := addAmounts(tc.a, tc.b); ok != tc.ok {
+			t.Errorf("addAmounts(%d, %d) ok = %v, want %v", tc.a, tc.b, ok, tc.ok)
+		}
+	}
+}
+
+// TestFeesPayTheMiner mines a transfer with a fee to a separate address.
+// The miner must be credited the reward plus the fee and the sender debited
+// the value plus the fee. A fee that overflows the sender's cost must be
+// refused and pay the miner nothing.
+func TestFeesPayTheMiner(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+
+	const value, fee = 3 * COIN / 10, COIN / 10
+	tx := NewTransaction(alice.address, bob.address, value)
+	tx.Fee = fee
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.MineTo(carol.address); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []struct {
+		name    string
+		address string
+		balance Amount
+	}{
+		{"miner", carol.address, MINING_REWARD + fee},
+		{"sender", alice.address, MINING_REWARD - value - fee},
+		{"recipient", bob.address, value},
+	} {
+		if got := bc.Balance(want.address); got != want.balance {
+			t.Errorf("%s balance %s, want %s", want.name, got, want.balance)
+		}
+		if got := bc.CalculateTotalAmount(want.address); got != want.balance {
+			t.Errorf("%s recomputed balance %s, want %s", want.name, got, want.balance)
+		}
+	}
+
+	overflowing := NewTransaction(alice.address, bob.address, 1)
+	overflowing.Fee = math.MaxInt64
+	if err := bc.AddSignedTransactionE(overflowing, &alice.private.PublicKey, alice.sign(t, overflowing)); !errors.Is(err, ErrAmountOverflow) {
+		t.Fatalf("got %v, want ErrAmountOverflow", err)
+	}
+	if _, err := bc.MineTo(carol.address); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bc.Balance(carol.address), 2*MINING_REWARD+fee; got != want {
+		t.Fatalf("miner balance %s after the refused fee, want %s", got, want)
+	}
+	if got, want := bc.Balance(alice.address), MINING_REWARD-value-fee; got != want {
+		t.Fatalf("sender balance %s after the refused fee, want %s", got, want)
+	}
+	if err := bc.AuditBalances(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSimulateSplitsFundableTransactions simulates a mix of transfers, one
+// funded only by an earlier one in the batch, and checks the split, the
+// resulting balances and that neither chain nor pool changed.
+func TestSimulateSplitsFundableTransactions(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	height := len(bc.Chain)
+
+	toBob := NewTransaction(alice.address, bob.address, 6*COIN/10)
+	overdraw := NewTransaction(alice.address, carol.address, 6*COIN/10)
+	fromCredit := NewTransaction(bob.address, carol.address, COIN/2)
+	unfunded := NewTransaction(carol.address, alice.address, COIN)
+	negative := NewTransaction(alice.address, bob.address, -1)
+	applied, rejected, balances := bc.Simulate([]*Transaction{toBob, overdraw, fromCredit, unfunded, negative})
+
+	if len(applied) != 2 || applied[0] != toBob || applied[1] != fromCredit {
+		t.Errorf("applied %v, want the transfer to bob and bob's onward transfer", applied)
+	}
+	if len(rejected) != 3 || rejected[0] != overdraw || rejected[1] != unfunded || rejected[2] != negative {
+		t.Errorf("rejected %v, want the overdraw, the unfunded and the negative transfers", rejected)
+	}
+	for addr, want := range map[string]Amount{
+		alice.address: 4 * COIN / 10,
+		bob.address:   COIN / 10,
+		carol.address: COIN / 2,
+	} {
+		if balances[addr] != want {
+			t.Errorf("simulated balance of %s: %s, want %s", addr, balances[addr], want)
+		}
+	}
+
+	if len(bc.Chain) != height || len(bc.CopyTransactionPool()) != 0 {
+		t.Fatal("Simulate changed the chain or the pool")
+	}
+	if got := bc.Balance(alice.address); got != MINING_REWARD {
+		t.Fatalf("alice's balance %s after simulating, want %s", got, MINING_REWARD)
+	}
+}
+
+// TestAuditBalancesFlagsOverspend appends a block in which an address spends
+// more than it holds. The audit must name that block and address.
+func TestAuditBalancesFlagsOverspend(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	if err := bc.AuditBalances(); err != nil {
+		t.Fatalf("audit of an honest chain: %v", err)
+	}
+
+	spend := NewTransaction(bob.address, alice.address, COIN)
+	bc.mux.Lock()
+	bc.Chain = append(bc.Chain, newBlock(0, bc.lastBlock().Hash(), []*Transaction{spend}))
+	bc.mux.Unlock()
+	err := bc.AuditBalances()
+	var blockErr *BlockError
+	if !errors.As(err, &blockErr) || blockErr.Height != 3 {
+		t.Fatalf("got %v, want an error for block 3", err)
+	}
+	if !strings.Contains(err.Error(), bob.address) {
+		t.Fatalf("error %q does not name the overspending address", err)
+	}
+}
+
+// TestReorgPrunesUnfundableTransaction pools a spend of a mining reward,
+// then adopts a fork in which that reward was never mined. The spend must
+// leave the pool.
+func TestReorgPrunesUnfundableTransaction(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	fork := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, bc, 1)
+	tx := NewTransaction(alice.address, bob.address, COIN/2)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+
+	mineBlocks(t, fork, 2)
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer fork was not adopted")
+	}
+	if got := bc.Balance(alice.address); got != 0 {
+		t.Fatalf("alice's balance %s after the reorg, want 0", got)
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 0 {
+		t.Fatalf("pool still holds %d unfundable transactions", len(pool))
+	}
+
+	// Called directly, it reports what it drops.
+	bc.mux.Lock()
+	bc.TransactionPool = append(bc.TransactionPool, tx)
+	bc.mux.Unlock()
+	if pruned := bc.PruneUnfundablePool(); len(pruned) != 1 || pruned[0] != tx {
+		t.Fatalf("pruned %v, want the unfundable spend", pruned)
+	}
+}
+
+func TestTransactionEffect(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	if _, err := bc.MineTo(bob.address); err != nil {
+		t.Fatal(err)
+	}
+	const value, fee = COIN / 2, COIN / 100
+	tx := NewTransaction(alice.address, bob.address, value)
+	tx.Fee = fee
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+
+	effect := func(id [32]byte) [4]Amount {
+		t.Helper()
+		sb, sa, rb, ra, err := bc.TransactionEffect(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return [4]Amount{sb, sa, rb, ra}
+	}
+	// Alice also mines the block holding her transfer, so her balance after
+	// it includes the reward and her own fee.
+	want := [4]Amount{2 * MINING_REWARD, 3*MINING_REWARD - value, MINING_REWARD, MINING_REWARD + value}
+	if got := effect(tx.ID()); got != want {
+		t.Errorf("transfer effect %v, want %v", got, want)
+	}
+	coinbase := bc.Chain[3].Transactions[0]
+	if got, want := effect(coinbase.ID()), [4]Amount{0, 0, 0, MINING_REWARD}; got != want {
+		t.Errorf("coinbase effect %v, want %v", got, want)
+	}
+	if _, _, _, _, err := bc.TransactionEffect([32]byte{1}); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("unknown ID: got %v, want ErrTransactionNotFound", err)
+	}
+}
+
+// TestSpendOfPendingCredit chains a spend on a credit still in the pool.
+// It is refused by default and accepted with SetAcceptPendingCredits, and
+// the accepted child is pruned once its parent leaves the pool unmined.
+func TestSpendOfPendingCredit(t *testing.T) {
+	for _, accept := range []bool{false, true} {
+		alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+		bc := newTestBlockchain(t, alice.address)
+		mineBlocks(t, bc, 1)
+		bc.SetAcceptPendingCredits(accept)
+
+		if err := addNonced(t, bc, alice, bob.address, COIN, 0); err != nil {
+			t.Fatal(err)
+		}
+		err := addNonced(t, bc, bob, carol.address, COIN/2, 0)
+		if !accept {
+			if !errors.Is(err, ErrInsufficientBalance) {
+				t.Errorf("pending credits off: got %v, want ErrInsufficientBalance", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("pending credits on: %v", err)
+		}
+
+		bc.mux.Lock()
+		bc.TransactionPool = bc.TransactionPool[1:]
+		bc.mux.Unlock()
+		if pruned := bc.PruneUnfundablePool(); len(pruned) != 1 || pruned[0].SenderBlockchainAddress != bob.address {
+			t.Errorf("dropping the parent pruned %d transactions, want the child", len(pruned))
+		}
+	}
+}
+
+// TestMinBalanceOverRange follows alice through block 3, where she spends
+// most of her balance before a credit from bob arrives later in the block.
+func TestMinBalanceOverRange(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, carol.address)
+	for _, miner := range []string{alice.address, bob.address} {
+		if _, err := bc.MineTo(miner); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := addNonced(t, bc, alice, carol.address, 9*MINING_REWARD/10, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, bob, alice.address, MINING_REWARD/2, 0); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+
+	for _, c := range []struct {
+		from, to int
+		want     Amount
+	}{
+		{0, 3, 0},
+		{1, 1, 0},
+		{2, 2, MINING_REWARD},
+		{2, 3, MINING_REWARD / 10},
+		{3, 3, MINING_REWARD / 10},
+	} {
+		got, err := bc.MinBalanceOverRange(alice.address, c.from, c.to)
+		if err != nil {
+			t.Fatalf("[%d, %d]: %v", c.from, c.to, err)
+		}
+		if got != c.want {
+			t.Errorf("[%d, %d]: minimum %s, want %s", c.from, c.to, got, c.want)
+		}
+	}
+	if got, want := bc.Balance(alice.address), 6*MINING_REWARD/10; got != want {
+		t.Fatalf("final balance %s, want %s", got, want)
+	}
+
+	for _, r := range [][2]int{{-1, 1}, {0, 4}, {3, 2}} {
+		if _, err := bc.MinBalanceOverRange(alice.address, r[0], r[1]); err == nil {
+			t.Errorf("[%d, %d]: no error for a range outside the chain", r[0], r[1])
+		}
+	}
+}
+
+// TestPooledDoubleSpendIsRejected spends 8 of a balance of 10 twice. Each
+// spend is affordable alone, but the second must be refused while the first
+// is still pending.
+func TestPooledDoubleSpendIsRejected(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 10)
+	if got := bc.Balance(alice.address); got != 10*COIN {
+		t.Fatalf("balance %s, want 10", got)
+	}
+
+	first := NewTransaction(alice.address, bob.address, 8*COIN)
+	if err := bc.AddSignedTransactionE(first, &alice.private.PublicKey, alice.sign(t, first)); err != nil {
+		t.Fatal(err)
+	}
+	second := NewTransaction(alice.address, carol.address, 8*COIN)
+	if err := bc.AddSignedTransactionE(second, &alice.private.PublicKey, alice.sign(t, second)); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("second spend: got %v, want ErrInsufficientBalance", err)
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 1 || pool[0].RecipientBlockchainAddress != bob.address {
+		t.Fatalf("pool holds %d transactions, want only the first spend", len(pool))
+	}
+}
+
+// TestBalanceIndexMatchesRecomputed compares the cached balance of every
+// address with a full replay after mining, a transfer with a fee, a reorg
+// onto a fork, and a reload from disk.
+func TestBalanceIndexMatchesRecomputed(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	addresses := []string{alice.address, bob.address, carol.address}
+	check := func(stage string, bc *Blockchain) {
+		t.Helper()
+		for _, addr := range addresses {
+			if cached, replayed := bc.Balance(addr), bc.CalculateTotalAmount(addr); cached != replayed {
+				t.Errorf("%s: cached balance %s, recomputed %s", stage, cached, replayed)
+			}
+		}
+	}
+
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	check("after mining", bc)
+
+	tx := NewTransaction(alice.address, bob.address, COIN/2)
+	tx.Fee = COIN / 10
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.MineTo(carol.address); err != nil {
+		t.Fatal(err)
+	}
+	check("after a transfer", bc)
+
+	fork := forkBlockchain(t, bc, carol.address)
+	check("after loading", fork)
+	mineBlocks(t, fork, 2)
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer fork was not adopted")
+	}
+	check("after a reorg", bc)
+	if got := bc.Balance(carol.address); got != 3*MINING_REWARD+COIN/10 {
+		t.Fatalf("carol's balance after the reorg is %s", got)
+	}
+}
@@ -1,25 +1,45 @@
 package block
 
 import (
-	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"goblockchain/utils"
-	"log"
 	"net/http"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	MINING_DIFFICULTY = 3
-	MINING_SENDER     = "THE BLOCKCHAIN"
-	MINING_REWARD     = 1.0
-	MINING_TIMER_SEC  = 20
+	MINING_DIFFICULTY      = 3
+	MINING_SENDER          = "THE BLOCKCHAIN"
+	MINING_REWARD          = 1 * COIN
+	MINING_TIMER_SEC       = 20
+	MAX_FUTURE_DRIFT       = 2 * time.Hour
+	MEDIAN_TIME_SPAN       = 11
+	MAX_BLOCK_BYTES        = 1 << 20
+	MAX_BLOCK_TRANSACTIONS = 1000
+
+	// BLOCK_VERSION_1 blocks carry no height or merkle root; chains from
+	// before versioning decode as version 0 and are treated the same way.
+	BLOCK_VERSION_1 = 1
+	BLOCK_VERSION_2 = 2
+	BLOCK_VERSION   = BLOCK_VERSION_2
+
+	MAX_CHAIN_RESPONSE_BYTES = 64 << 20
+	MAX_PENDING_PER_SENDER   = 64
+	CYCLE_DETECTION_DEPTH    = 3
+	NONCE_GAP_TIMEOUT        = 10 * time.Minute
+	MAX_GAPPED_PER_SENDER    = 16
+	MAX_GAPPED_TOTAL         = 1024
+	HTTP_TIMEOUT             = 10 * time.Second
 
 	BLOCKCHAIN_PORT_RANGE_START        = 5001
 	BLOCKCHAIN_PORT_RANGE_END          = 5003
@@ -29,32 +49,74 @@ const (
 )
 
 type Block struct {
+	Version      int            `json:"version,omitempty"`
 	Nonce        int            `json:"nonce"`
 	PreviousHash [32]byte       `json:"previousHash"`
 	Timestamp    int64          `json:"timestamp"`
 	Transactions []*Transaction `json:"transactions"`
+
+	// Proof-of-stake blocks name their proposer and carry its signature
+	// instead of a proof-of-work nonce.
+	Proposer          string `json:"proposer,omitempty"`
+	ProposerPublicKey string `json:"proposerPublicKey,omitempty"`
+	ProposerSignature string `json:"proposerSignature,omitempty"`
+
+	// Version 2 blocks also record their height and the merkle root of
+	// their transactions.
+	Height     int      `json:"height,omitempty"`
+	MerkleRoot [32]byte `json:"merkleRoot,omitempty"`
+
+	// hash caches Hash. Blocks are not modified once built, so it only
+	// needs resetting by code that fills a block in after the fact.
+	hashMux sync.Mutex
+	hash    *[32]byte
+	// pruned blocks have lost their transactions and keep hash as given.
+	pruned bool
 }
 
 func (b *Block) MarshalJSON() ([]byte, error) {
+	var merkleRoot, prunedHash string
+	if b.Version >= BLOCK_VERSION_2 {
+		merkleRoot = fmt.Sprintf("%x", b.MerkleRoot)
+	}
+	if b.pruned {
+		prunedHash = fmt.Sprintf("%x", *b.hash)
+	}
 	return json.Marshal(struct {
-		Nonce        int            `json:"nonce"`
-		PreviousHash string         `json:"previousHash"`
-		Timestamp    int64          `json:"timestamp"`
-		Transactions []*Transaction `json:"transactions"`
+		Version           int            `json:"version,omitempty"`
+		Nonce             int            `json:"nonce"`
+		PreviousHash      string         `json:"previousHash"`
+		Timestamp         int64          `json:"timestamp"`
+		Transactions      []*Transaction `json:"transactions"`
+		Proposer          string         `json:"proposer,omitempty"`
+		ProposerPublicKey string         `json:"proposerPublicKey,omitempty"`
+		ProposerSignature string         `json:"proposerSignature,omitempty"`
+		Height            int            `json:"height,omitempty"`
+		MerkleRoot        string         `json:"merkleRoot,omitempty"`
+		PrunedHash        string         `json:"prunedHash,omitempty"`
 	}{
-		Nonce:        b.Nonce,
-		PreviousHash: fmt.Sprintf("%x", b.PreviousHash),
-		Timestamp:    b.Timestamp,
-		Transactions: b.Transactions,
+		Version:           b.Version,
+		Nonce:             b.Nonce,
+		PreviousHash:      fmt.Sprintf("%x", b.PreviousHash),
+		Timestamp:         b.Timestamp,
+		Transactions:      b.Transactions,
+		Proposer:          b.Proposer,
+		ProposerPublicKey: b.ProposerPublicKey,
+		ProposerSignature: b.ProposerSignature,
+		Height:            b.Height,
+		MerkleRoot:        merkleRoot,
+		PrunedHash:        prunedHash,
 	})
 }
 
 func newBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
 	b := new(Block)
+	b.Version = BLOCK_VERSION
 	b.Timestamp = time.Now().UnixNano()
 	b.Nonce = nonce
 	b.PreviousHash = previousHash
 	b.Transactions = transactions
+	b.MerkleRoot = merkleRoot(transactions)
 	return b
 }
 
@@ -71,8 +133,26 @@ func (b *Block) GetTransactions() []*Transaction {
 }
 
 func (b *Block) Hash() [32]byte {
+	b.hashMux.Lock()
+	defer b.hashMux.Unlock()
+	if b.hash == nil {
+		m, _ := json.Marshal(b)
+		h := sha256.Sum256(m)
+		b.hash = &h
+	}
+	return *b.hash
+}
+
+func (b *Block) invalidateHash() {
+	b.hashMux.Lock()
+	b.hash = nil
+	b.hashMux.Unlock()
+}
+
+// Size is the length of the block's JSON encoding.
+func (b *Block) Size() int {
 	m, _ := json.Marshal(b)
-	return sha256.Sum256(m)
+	return len(m)
 }
 
 func (b *Block) Print() {
@@ -86,23 +166,60 @@ func (b *Block) Print() {
 }
 
 func (b *Block) UnmarshalJSON(data []byte) error {
-	var previousHash string
+	var previousHash, merkleRoot, prunedHash string
 	v := &struct {
-		Timestamp    *int64          `json:"timestamp"`
-		Nonce        *int            `json:"nonce"`
-		PreviousHash *string         `json:"previousHash"`
-		Transactions *[]*Transaction `json:"transactions"`
+		Version           *int            `json:"version"`
+		Timestamp         *int64          `json:"timestamp"`
+		Nonce             *int            `json:"nonce"`
+		PreviousHash      *string         `json:"previousHash"`
+		Transactions      *[]*Transaction `json:"transactions"`
+		Proposer          *string         `json:"proposer"`
+		ProposerPublicKey *string         `json:"proposerPublicKey"`
+		ProposerSignature *string         `json:"proposerSignature"`
+		Height            *int            `json:"height"`
+		MerkleRoot        *string         `json:"merkleRoot"`
+		PrunedHash        *string         `json:"prunedHash"`
 	}{
-		Timestamp:    &b.Timestamp,
-		Nonce:        &b.Nonce,
-		PreviousHash: &previousHash,
-		Transactions: &b.Transactions,
+		Version:           &b.Version,
+		Timestamp:         &b.Timestamp,
+		Nonce:             &b.Nonce,
+		PreviousHash:      &previousHash,
+		Transactions:      &b.Transactions,
+		Proposer:          &b.Proposer,
+		ProposerPublicKey: &b.ProposerPublicKey,
+		ProposerSignature: &b.ProposerSignature,
+		Height:            &b.Height,
+		MerkleRoot:        &merkleRoot,
+		PrunedHash:        &prunedHash,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
-	ph, _ := hex.DecodeString(*v.PreviousHash)
-	copy(b.PreviousHash[:], ph[:32])
+	ph, err := ParseHash(previousHash)
+	if err != nil {
+		return fmt.Errorf("block: previous hash: %v", err)
+	}
+	b.PreviousHash = ph
+	if b.Version >= BLOCK_VERSION_2 {
+		mr, err := ParseHash(merkleRoot)
+		if err != nil {
+			return fmt.Errorf("block: merkle root: %v", err)
+		}
+		b.MerkleRoot = mr
+	} else {
+		// Older formats have no such fields; ignore any a peer sends.
+		b.Height = 0
+		b.MerkleRoot = [32]byte{}
+	}
+	b.invalidateHash()
+	if prunedHash != "" {
+		h, err := ParseHash(prunedHash)
+		if err != nil {
+			return fmt.Errorf("block: invalid pruned hash %q", prunedHash)
+		}
+		b.pruned = true
+		b.hash = &h
+	}
 	return nil
 }
 
@@ -111,54 +228,307 @@ type Blockchain struct {
 	Chain             []*Block       `json:"chain"`
 	BlockChainAddress string         `json:"blockChainAddress"`
 	Port              uint16         `json:"port"`
-	mux               sync.Mutex
+	// Difficulty is the proof-of-work difficulty of the next block. It
+	// follows Params().Difficulty, or the ParamSchedule entry for the next
+	// height when there is one, retargeted by AdjustDifficulty when a
+	// TargetBlockInterval is set; use SetDifficulty to change the base.
+	Difficulty int `json:"difficulty"`
+
+	// mux serializes every change to Chain and TransactionPool: mining,
+	// chain replacement and transaction admission. A transaction is therefore
+	// always validated against the chain it lands on, never one that is
+	// being replaced underneath it. Network calls are made outside it, and
+	// callbacks such as OnConfirmed and OnTransactionRejected run with it
+	// held, so they must not call back into methods that take it.
+	mux sync.RWMutex
 
-	neighbours    []string
-	muxNeighbours sync.Mutex
+	// done is closed by Stop to end the background loops.
+	done     chan struct{}
+	stopOnce sync.Once
+
+	params            NetworkParams
+	genesisHash       [32]byte
+	synced            bool
+	totalTransactions int
+	// balanceIndex is every address's confirmed balance, kept in step with
+	// the chain.
+	balanceIndex map[string]Amount
+	// confirmedHashes holds the hashes of the confirmed transactions that
+	// carry no nonce, so they cannot be replayed.
+	confirmedHashes map[[32]byte]bool
+	// nonceIndex is the highest nonce each sender has used in the chain,
+	// kept in step with it.
+	nonceIndex map[string]uint64
+	// snapshot stands in for the blocks Prune has hollowed out.
+	snapshot *pruneSnapshot
+	metrics  *swapMetrics
+	// utxo is the UTXO view of the chain, kept only in UTXO mode.
+	utxo *UTXOSet
+
+	maxChainResponseBytes int64
+	client                *http.Client
+	broadcastRetries      int
+	broadcastBackoff      time.Duration
+	tieBreak              TieBreakPolicy
+	onTransactionRejected func(req *TransactionRequest, reason error)
+	logger                *swapLogger
+	maxPendingPerSender   int
+	cycleDetectionDepth   int
+	gapped                map[string]map[uint64]*gappedTransaction
+	nonceGapTimeout       time.Duration
+	maxGappedPerSender    int
+	maxGappedTotal        int
+	mempoolMaxAge         time.Duration
+	confirmations         map[[32]byte]*confirmationWatch
+	watchedHeights        map[int][][32]byte
+	senderDenylist        map[string]bool
+	senderAllowlist       map[string]bool
+	strictSenderPolicy    bool
+	mempoolPulled         map[string]bool
+	acceptPendingCredits  bool
+	requireRecentBlock    bool
+	requireNonce          bool
+	chainFile             string
+	miningThreads         int
+	staleTipThreshold     time.Duration
+	staleTipAlerted       [32]byte
+	onStaleTip            func(age time.Duration)
+
+	compactionInterval time.Duration
+	miningMux          sync.Mutex
+	mining             *miningAttempt
+
+	subscribersMux sync.Mutex
+	subscribers    map[<-chan *Block]chan *Block
+	archive        *archiveIndex
+
+	rejectionsMux    sync.Mutex
+	rejectionHistory int
+	rejections       []RejectionRecord
+
+	confirmationSampleSize int
+	confirmationSamples    []confirmationSample
+	primary                string
+	proposerKey            *ecdsa.PrivateKey
+
+	neighbours     []string
+	muxNeighbours  sync.Mutex
+	peerFailures   map[string]int
+	pingFailures   map[string]int
+	peersFile      string
+	persistedPeers []string
+	announcedPeers []string
+	explicitPeers  []string
+	noScan         bool
 }
 
 func NewBlockchain(blockChainAddress string, port uint16) *Blockchain {
 	b := &Block{}
+	bc := newBlockchain(blockChainAddress, port)
+	bc.CreateBlock(0, b.Hash())
+	return bc
+}
+
+func newBlockchain(blockChainAddress string, port uint16) *Blockchain {
 	bc := new(Blockchain)
 	bc.BlockChainAddress = blockChainAddress
 	bc.Port = port
-	bc.CreateBlock(0, b.Hash())
+	bc.params = DefaultNetworkParams()
+	if bc.params.Difficulty == 0 {
+		bc.params.Difficulty = MINING_DIFFICULTY
+	}
+	bc.Difficulty = bc.params.Difficulty
+	bc.synced = true
+	bc.maxChainResponseBytes = MAX_CHAIN_RESPONSE_BYTES
+	bc.client = NewPeerClient(HTTP_TIMEOUT)
+	bc.broadcastRetries = BROADCAST_RETRIES
+	bc.broadcastBackoff = BROADCAST_BACKOFF
+	bc.logger = &swapLogger{l: NewLogger(nil, LOG_INFO, LOG_FORMAT_TEXT)}
+	bc.metrics = &swapMetrics{m: noMetrics{}}
+	bc.maxPendingPerSender = MAX_PENDING_PER_SENDER
+	bc.cycleDetectionDepth = CYCLE_DETECTION_DEPTH
+	bc.gapped = make(map[string]map[uint64]*gappedTransaction)
+	bc.nonceGapTimeout = NONCE_GAP_TIMEOUT
+	bc.maxGappedPerSender = MAX_GAPPED_PER_SENDER
+	bc.maxGappedTotal = MAX_GAPPED_TOTAL
+	bc.mempoolMaxAge = MEMPOOL_MAX_AGE
+	bc.mempoolPulled = make(map[string]bool)
+	bc.confirmationSampleSize = CONFIRMATION_SAMPLES
+	bc.miningThreads = runtime.NumCPU()
+	bc.staleTipThreshold = STALE_TIP_THRESHOLD
+	bc.rejectionHistory = REJECTION_HISTORY
+	bc.compactionInterval = COMPACTION_INTERVAL
+	bc.done = make(chan struct{})
+	bc.balanceIndex = make(map[string]Amount)
+	bc.confirmedHashes = make(map[[32]byte]bool)
+	bc.nonceIndex = make(map[string]uint64)
 	return bc
 }
 
+func (bc *Blockchain) Params() NetworkParams {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.params
+}
+
+// SetParams replaces the network params. Difficulties outside
+// MIN_DIFFICULTY..MAX_DIFFICULTY are clamped.
+func (bc *Blockchain) SetParams(params NetworkParams) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.params = bc.clampParamsDifficulty(params)
+	bc.syncDifficulty()
+}
+
+// SetDifficulty changes the proof-of-work difficulty used for mining and for
+// validating chains. Every node of a network must agree on it. Values
+// outside MIN_DIFFICULTY..MAX_DIFFICULTY are clamped.
+func (bc *Blockchain) SetDifficulty(difficulty int) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.params.Difficulty = bc.clampedDifficulty(difficulty)
+	bc.syncDifficulty()
+}
+
+func (bc *Blockchain) GetDifficulty() int {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.Difficulty
+}
+
+// syncDifficulty sets Difficulty to what the params, and retargeting when
+// enabled, require of the next block. The caller must hold bc.mux.
+func (bc *Blockchain) syncDifficulty() {
+	p := bc.params.At(len(bc.Chain))
+	if p.TargetBlockInterval <= 0 {
+		bc.Difficulty = p.Difficulty
+		return
+	}
+	difficulties := chainDifficulties(bc.Chain, bc.params)
+	bc.Difficulty = difficulties[len(bc.Chain)]
+}
+
+// SetMaxChainResponseBytes caps how much of a neighbour's /chain response is
+// read during conflict resolution. Larger responses are skipped.
+func (bc *Blockchain) SetMaxChainResponseBytes(n int64) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.maxChainResponseBytes = n
+}
+
+// SetHTTPTimeout bounds every request made to a neighbour, so an
+// unresponsive peer cannot stall syncing or conflict resolution. Zero means
+// no timeout. Open connections are kept.
+func (bc *Blockchain) SetHTTPTimeout(d time.Duration) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.client = &http.Client{Timeout: d, Transport: bc.client.Transport}
+}
+
+// peerClient returns the client for requests to neighbours and the most of
+// a response body read from one. The caller must not hold bc.mux.
+func (bc *Blockchain) peerClient() (*http.Client, int64) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.client, bc.maxChainResponseBytes
+}
+
 func (bc *Blockchain) Run() {
+	bc.loadPersistedPeers()
 	bc.StartSyncNeighbours()
 	bc.ResolveConflicts()
+	bc.StartCompaction()
+	if bc.IsReplica() {
+		bc.StartFollowing()
+		return
+	}
 	bc.StartMining()
 }
 
 func (bc *Blockchain) SetNeighbours() {
-	bc.neighbours = utils.FindNeighbours(
-		utils.GetHost(), bc.Port, NEIGHBOUR_IP_RANGE_START, NEIGHBOUR_IP_RANGE_END,
-		BLOCKCHAIN_PORT_RANGE_START, BLOCKCHAIN_PORT_RANGE_END)
-	log.Printf("%v", bc.neighbours)
+	bc.neighbours = nil
+	if !bc.noScan {
+		bc.neighbours = utils.FindNeighbours(
+			utils.GetHost(), bc.Port, NEIGHBOUR_IP_RANGE_START, NEIGHBOUR_IP_RANGE_END,
+			BLOCKCHAIN_PORT_RANGE_START, BLOCKCHAIN_PORT_RANGE_END)
+	}
+	bc.neighbours = mergePeers(bc.neighbours, bc.explicitPeers)
+	bc.neighbours = mergePeers(bc.neighbours, bc.persistedPeers)
+	bc.neighbours = mergePeers(bc.neighbours, bc.announcedPeers)
+	if bc.primary != "" {
+		bc.neighbours = []string{bc.primary}
+	}
+	bc.logger.Debug("neighbours updated", "action", "sync_neighbours", "count", len(bc.neighbours), "neighbours", strings.Join(bc.neighbours, ","))
 }
 
 func (bc *Blockchain) SyncNeighbours() {
 	bc.muxNeighbours.Lock()
 	defer bc.muxNeighbours.Unlock()
 	bc.SetNeighbours()
+	if bc.peersFile != "" {
+		if err := SavePeers(bc.peersFile, bc.healthyPeers()); err != nil {
+			bc.logger.Error("save peers failed", "path", bc.peersFile, "err", err)
+		}
+	}
 }
 
 func (bc *Blockchain) StartSyncNeighbours() {
-	bc.SyncNeighbours()
-	_ = time.AfterFunc(time.Second*BLOCKCHAIN_NEIGHBOUR_SYNC_TIME_SEC, bc.StartSyncNeighbours)
+	bc.repeat(time.Second*BLOCKCHAIN_NEIGHBOUR_SYNC_TIME_SEC, func() {
+		bc.SyncNeighbours()
+		bc.PingNeighbours()
+		bc.CatchUp()
+		bc.pullNewMempools()
+		bc.CheckStaleTip()
+	})
 }
 
 func (bc *Blockchain) GetTransactionPool() []*Transaction {
-	return bc.TransactionPool
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return append([]*Transaction(nil), bc.TransactionPool...)
+}
+
+// PendingTransactions returns at most limit pooled transactions, highest fee
+// first and in arrival order among equal fees, along with the size of the
+// whole pool. A limit of zero or less returns every transaction in arrival
+// order.
+func (bc *Blockchain) PendingTransactions(limit int) ([]*Transaction, int) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	total := len(bc.TransactionPool)
+	if limit <= 0 || limit >= total {
+		return append([]*Transaction(nil), bc.TransactionPool...), total
+	}
+	transactions := append([]*Transaction(nil), bc.TransactionPool...)
+	sort.SliceStable(transactions, func(i, j int) bool {
+		return transactions[i].Fee > transactions[j].Fee
+	})
+	return transactions[:limit], total
+}
+
+// PendingTransactionsFor returns the pooled transactions sent or received
+// by address, in arrival order.
+func (bc *Blockchain) PendingTransactionsFor(address string) []*Transaction {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	var transactions []*Transaction
+	for _, t := range bc.TransactionPool {
+		if t.SenderBlockchainAddress == address || t.RecipientBlockchainAddress == address {
+			transactions = append(transactions, t)
+		}
+	}
+	return transactions
 }
 
 func (bc *Blockchain) ClearTransactionPool() {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
 	bc.TransactionPool = bc.TransactionPool[:0]
 }
 
 func (bc *Blockchain) MarshalJSON() ([]byte, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
 	return json.Marshal(struct {
 		Blocks []*Block `json:"chain"`
 	}{
@@ -179,40 +549,142 @@ func (bc *Blockchain) UnmarshalJSON(data []byte) error {
 }
 
 func (bc *Blockchain) CreateBlock(nonce int, previousHash [32]byte) *Block {
-	block := newBlock(nonce, previousHash, bc.TransactionPool)
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.createBlock(nonce, previousHash)
+}
+
+// createBlock is CreateBlock for callers that hold bc.mux.
+func (bc *Blockchain) createBlock(nonce int, previousHash [32]byte) *Block {
+	block := bc.newBlock(nonce, previousHash)
+	bc.appendBlock(block)
+	return block
+}
+
+func (bc *Blockchain) newBlock(nonce int, previousHash [32]byte) *Block {
+	return bc.newBlockWith(nonce, previousHash, bc.TransactionPool)
+}
+
+// newBlockWith builds the next block from transactions. The caller must hold
+// bc.mux.
+func (bc *Blockchain) newBlockWith(nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
+	block := newBlock(nonce, previousHash, transactions)
+	block.Height = len(bc.Chain)
+	if mtp := medianTimePast(bc.Chain, bc.params.At(len(bc.Chain)).MedianTimeSpan); len(bc.Chain) > 0 && block.Timestamp <= mtp {
+		block.Timestamp = mtp + 1
+	}
+	return block
+}
+
+func (bc *Blockchain) appendBlock(block *Block) {
 	bc.Chain = append(bc.Chain, block)
-	bc.TransactionPool = []*Transaction{}
+	bc.syncDifficulty()
+	if bc.archive != nil {
+		bc.indexBlock(len(bc.Chain) - 1)
+	}
+	if bc.utxo != nil {
+		bc.utxo.ApplyBlock(block, len(bc.Chain)-1)
+	}
+	bc.totalTransactions += len(block.Transactions)
+	applyBlock(bc.balanceIndex, block)
+	bc.indexConfirmed(block)
+	bc.sampleConfirmations(block, len(bc.Chain)-1)
+	bc.dropIncluded(block)
+	bc.pruneUnfundablePool()
+	bc.notifyConfirmations(len(bc.Chain) - 1)
+	bc.persist()
+	bc.publish(block)
+
+	// The caller holds bc.mux, which must not wait on the network.
+	go bc.broadcastToNeighbours(http.MethodDelete, "/transactions", nil)
+}
 
-	for _, n := range bc.neighbours {
-		endpoint := fmt.Sprintf("http://%s/transactions", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("DELETE", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
+// dropIncluded removes the transactions of block from the pool, keeping those
+// that arrived after it was assembled. The caller must hold bc.mux.
+func (bc *Blockchain) dropIncluded(block *Block) {
+	included := make(map[*Transaction]bool, len(block.Transactions))
+	for _, t := range block.Transactions {
+		included[t] = true
 	}
+	pool := []*Transaction{}
+	for _, t := range bc.TransactionPool {
+		if !included[t] {
+			pool = append(pool, t)
+		}
+	}
+	bc.TransactionPool = pool
+}
 
-	return block
+// TotalTransactions returns the number of transactions in the chain, kept up
+// to date as blocks are added or the chain is replaced.
+func (bc *Blockchain) TotalTransactions() int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.totalTransactions
+}
+
+func countTransactions(chain []*Block) int {
+	n := 0
+	for _, b := range chain {
+		n += len(b.Transactions)
+	}
+	return n
 }
 
+// LastBlock returns the tip, or nil if the chain is empty.
 func (bc *Blockchain) LastBlock() *Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.lastBlock()
+}
+
+// lastBlock is LastBlock for callers that hold bc.mux.
+func (bc *Blockchain) lastBlock() *Block {
+	if len(bc.Chain) == 0 {
+		return nil
+	}
 	return bc.Chain[len(bc.Chain)-1]
 }
 
 type Transaction struct {
-	SenderBlockchainAddress    string  `json:"senderBlockchainAddress"`
-	RecipientBlockchainAddress string  `json:"recipientBlockchainAddress"`
-	Value                      float32 `json:"value"`
+	SenderBlockchainAddress    string `json:"senderBlockchainAddress"`
+	RecipientBlockchainAddress string `json:"recipientBlockchainAddress"`
+	Value                      Amount `json:"value"`
+	Fee                        Amount `json:"fee,omitempty"`
+	Nonce                      uint64 `json:"nonce,omitempty"`
+	// RecentBlockHash optionally binds the transaction to the chain it was
+	// built against: the hex hash of a block within RecentBlockWindow of
+	// the tip. It keeps the transaction from being replayed on a fork that
+	// lacks that block.
+	RecentBlockHash string `json:"recentBlockHash,omitempty"`
+	SenderPublicKey string `json:"senderPublicKey,omitempty"`
+	Signature       string `json:"signature,omitempty"`
+
+	// pooledAt and pooledHeight record when the transaction entered this
+	// node's pool. They are local bookkeeping and never serialized.
+	pooledAt     time.Time
+	pooledHeight int
 }
 
 func (t *Transaction) UnmarshalJSON(data []byte) error {
 	v := &struct {
-		Sender    *string  `json:"senderBlockchainAddress"`
-		Recipient *string  `json:"recipientBlockchainAddress"`
-		Value     *float32 `json:"value"`
+		Sender          *string `json:"senderBlockchainAddress"`
+		Recipient       *string `json:"recipientBlockchainAddress"`
+		Value           *Amount `json:"value"`
+		Fee             *Amount `json:"fee"`
+		Nonce           *uint64 `json:"nonce"`
+		RecentBlockHash *string `json:"recentBlockHash"`
+		SenderPublicKey *string `json:"senderPublicKey"`
+		Signature       *string `json:"signature"`
 	}{
-		Sender:    &t.SenderBlockchainAddress,
-		Recipient: &t.RecipientBlockchainAddress,
-		Value:     &t.Value,
+		Sender:          &t.SenderBlockchainAddress,
+		Recipient:       &t.RecipientBlockchainAddress,
+		Value:           &t.Value,
+		Fee:             &t.Fee,
+		Nonce:           &t.Nonce,
+		RecentBlockHash: &t.RecentBlockHash,
+		SenderPublicKey: &t.SenderPublicKey,
+		Signature:       &t.Signature,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
@@ -220,121 +692,401 @@ func (t *Transaction) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
-func (bc *Blockchain) CreateTransaction(sender string, recipient string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	isTransacted := bc.AddTransaction(sender, recipient, value, senderPublicKey, s)
+func (bc *Blockchain) CreateTransaction(sender string, recipient string, value Amount, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	return bc.CreateTransactionWithFee(sender, recipient, value, 0, senderPublicKey, s)
+}
 
-	if isTransacted {
-		for _, n := range bc.neighbours {
-			publicKeyStr := fmt.Sprintf("%064x%064x", senderPublicKey.X.Bytes(), senderPublicKey.Y.Bytes())
-			signatureStr := s.String()
-			bt := &TransactionRequest{
-				SenderBlockchainAddress:    &sender,
-				RecipientBlockchainAddress: &recipient,
-				SenderPublicKey:            &publicKeyStr,
-				Value:                      &value,
-				Signature:                  &signatureStr,
-			}
-			m, _ := json.Marshal(bt)
-			buf := bytes.NewBuffer(m)
-			endpoint := fmt.Sprintf("http://%s/transactions", n)
-			client := &http.Client{}
-			req, _ := http.NewRequest("PUT", endpoint, buf)
-			resp, _ := client.Do(req)
-			log.Printf("%v", resp)
-		}
+func (bc *Blockchain) CreateTransactionWithFee(sender string, recipient string, value Amount, fee Amount, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	t := NewTransaction(sender, recipient, value)
+	t.Fee = fee
+	return bc.CreateSignedTransaction(t, senderPublicKey, s)
+}
+
+// CreateSignedTransaction adds t like AddSignedTransaction and relays it to
+// the neighbours when it is accepted.
+func (bc *Blockchain) CreateSignedTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	return bc.CreateSignedTransactionE(t, senderPublicKey, s) == nil
+}
+
+// CreateSignedTransactionE is CreateSignedTransaction returning why t was
+// rejected.
+func (bc *Blockchain) CreateSignedTransactionE(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	if err := bc.AddSignedTransactionE(t, senderPublicKey, s); err != nil {
+		return err
 	}
+	m, _ := json.Marshal(newTransactionRequest(t, senderPublicKey, s))
+	bc.broadcastToNeighbours(http.MethodPut, "/transactions", m)
+	return nil
+}
 
-	return isTransacted
+func (bc *Blockchain) AddTransaction(sender string, recipient string, value Amount, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	return bc.AddTransactionWithFee(sender, recipient, value, 0, senderPublicKey, s)
 }
 
-func (bc *Blockchain) AddTransaction(sender string, recipient string, value float32, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+// AddTransactionE is AddTransaction returning why the transaction was
+// rejected, as one of the sentinel errors such as ErrInsufficientBalance or
+// ErrInvalidSignature.
+func (bc *Blockchain) AddTransactionE(sender string, recipient string, value Amount, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	return bc.AddSignedTransactionE(NewTransaction(sender, recipient, value), senderPublicKey, s)
+}
+
+func (bc *Blockchain) AddTransactionWithFee(sender string, recipient string, value Amount, fee Amount, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
 	t := NewTransaction(sender, recipient, value)
+	t.Fee = fee
+	return bc.AddSignedTransaction(t, senderPublicKey, s)
+}
 
-	if sender == MINING_SENDER {
-		bc.TransactionPool = append(bc.TransactionPool, t)
-		return true
+// AddSignedTransaction validates t, including its fee and nonce, against the
+// sender's signature and balance and adds it to the pool. Transactions whose
+// nonce is ahead of the sender's next nonce are held back until the gap is
+// filled.
+func (bc *Blockchain) AddSignedTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
+	return bc.AddSignedTransactionE(t, senderPublicKey, s) == nil
+}
+
+// AddSignedTransactionE is AddSignedTransaction returning why t was
+// rejected.
+func (bc *Blockchain) AddSignedTransactionE(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if err := bc.addTransaction(t, senderPublicKey, s); err != nil {
+		bc.logger.Warn("transaction rejected", "sender", t.SenderBlockchainAddress, "recipient", t.RecipientBlockchainAddress, "value", t.Value, "err", err)
+		bc.rejectTransaction(t, senderPublicKey, s, err)
+		return err
 	}
+	return nil
+}
 
-	if bc.VerifyTransactionSignature(senderPublicKey, s, t) {
-		if bc.CalculateTotalAmount(sender) < value {
-			log.Println("ERROR: Insufficient balance")
-			return false
+// ValidateTransaction reports whether AddTransaction would accept the
+// transaction, and if not why, without touching the pool.
+func (bc *Blockchain) ValidateTransaction(sender string, recipient string, value Amount, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	return bc.ValidateSignedTransaction(NewTransaction(sender, recipient, value), senderPublicKey, s)
+}
+
+// ValidateSignedTransaction is ValidateTransaction for a transaction with a
+// fee or nonce. A nonce ahead of the sender's next one is valid, since it
+// would be held back rather than rejected.
+func (bc *Blockchain) ValidateSignedTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	_, err := bc.checkTransaction(t, senderPublicKey, s)
+	return err
+}
+
+// addTransaction admits t to the pool. Coinbase transactions are refused
+// here; only addCoinbase creates them.
+func (bc *Blockchain) addTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) error {
+	// Expired queued transactions must not count against the gap limits.
+	bc.evictGapped(time.Now())
+	gapped, err := bc.checkTransaction(t, senderPublicKey, s)
+	if err != nil {
+		return err
+	}
+	t.SenderPublicKey = fmt.Sprintf("%064x%064x", senderPublicKey.X.Bytes(), senderPublicKey.Y.Bytes())
+	t.Signature = s.String()
+	if gapped {
+		bc.queueGapped(t, senderPublicKey, s)
+		return nil
+	}
+	bc.markPooled(t)
+	bc.TransactionPool = append(bc.TransactionPool, t)
+	if t.Nonce != 0 {
+		bc.promoteGapped(t.SenderBlockchainAddress)
+	}
+	return nil
+}
+
+// checkTransaction runs every admission check on t without changing any
+// state. gapped reports that t passes but its nonce is ahead of the
+// sender's next one. The caller must hold bc.mux.
+func (bc *Blockchain) checkTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) (gapped bool, err error) {
+	if bc.params.isCoinbase(t.SenderBlockchainAddress) {
+		return false, ErrReservedSender
+	}
+	if !bc.senderPermitted(t.SenderBlockchainAddress) {
+		return false, ErrSenderNotPermitted
+	}
+
+	if t.Value < 0 {
+		return false, ErrNegativeValue
+	}
+	if t.Fee < 0 {
+		return false, ErrNegativeFee
+	}
+	cost, ok := t.cost()
+	if !ok {
+		return false, ErrAmountOverflow
+	}
+	if senderPublicKey == nil || s == nil || !bc.VerifyTransactionSignature(senderPublicKey, s, t) {
+		return false, ErrInvalidSignature
+	}
+	if utils.AddressFromPublicKey(senderPublicKey) != t.SenderBlockchainAddress {
+		return false, ErrSenderKeyMismatch
+	}
+	if err := bc.checkRecentBlockHash(t); err != nil {
+		return false, err
+	}
+	if t.Nonce == 0 && bc.requireNonce {
+		return false, ErrMissingNonce
+	}
+	if t.Nonce == 0 && bc.confirmedHashes[t.Hash()] {
+		return false, ErrReplayedTransaction
+	}
+	if t.Nonce != 0 {
+		expected := bc.nextNonce(t.SenderBlockchainAddress)
+		if t.Nonce < expected {
+			return false, ErrStaleNonce
 		}
-		bc.TransactionPool = append(bc.TransactionPool, t)
-		return true
+		gapped = t.Nonce > expected
 	}
-	log.Println("ERROR: Verify Transaction")
-	return false
+	available := bc.availableBalance(t.SenderBlockchainAddress)
+	if gapped {
+		// Queued transactions are held to the same funds as pooled ones,
+		// together with the rest of the sender's queue.
+		if available, ok = addAmounts(available, -bc.gappedSpend(t.SenderBlockchainAddress, t.Nonce)); !ok {
+			return false, ErrInsufficientBalance
+		}
+	}
+	if available < cost {
+		return false, ErrInsufficientBalance
+	}
+	if err := bc.checkSpam(t); err != nil {
+		return false, err
+	}
+	if gapped {
+		if err := bc.checkGapLimits(t); err != nil {
+			return false, err
+		}
+	}
+	return gapped, nil
 }
 
 func (bc *Blockchain) VerifyTransactionSignature(senderPublicKey *ecdsa.PublicKey, s *utils.Signature, t *Transaction) bool {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256(m)
+	return verifyTransactionSignature(senderPublicKey, s, t)
+}
+
+func verifyTransactionSignature(senderPublicKey *ecdsa.PublicKey, s *utils.Signature, t *Transaction) bool {
+	h := sha256.Sum256(t.signedBytes())
 	return ecdsa.Verify(senderPublicKey, h[:], s.R, s.S)
 }
 
 func (bc *Blockchain) CopyTransactionPool() []*Transaction {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.copyTransactionPool()
+}
+
+func (bc *Blockchain) copyTransactionPool() []*Transaction {
 	transactions := make([]*Transaction, 0)
 	for _, t := range bc.TransactionPool {
-		transactions = append(transactions, NewTransaction(t.SenderBlockchainAddress, t.RecipientBlockchainAddress, t.Value))
+		c := *t
+		transactions = append(transactions, &c)
 	}
 	return transactions
 }
 
 func (bc *Blockchain) ValidProof(nonce int, previousHash [32]byte, transactions []*Transaction, difficulty int) bool {
-	zeros := strings.Repeat("0", difficulty)
-	guessBlock := Block{
-		Nonce:        nonce,
-		PreviousHash: previousHash,
-		Timestamp:    0,
-		Transactions: transactions,
-	}
-	guessHashStr := fmt.Sprintf("%x", guessBlock.Hash())
-	return guessHashStr[:3] == zeros
+	return validProof(nonce, previousHash, transactions, difficulty)
 }
 
+// ProofOfWork searches for a nonce that satisfies the difficulty for the
+// current pool across up to bc.miningThreads goroutines. With a single
+// thread it returns the lowest such nonce.
 func (bc *Blockchain) ProofOfWork() int {
-	transactions := bc.CopyTransactionPool()
-	previousHash := bc.LastBlock().Hash()
-	nonce := 0
-	for !bc.ValidProof(nonce, previousHash, transactions, MINING_DIFFICULTY) {
-		nonce += 1
-	}
+	nonce, _ := bc.ProofOfWorkContext(context.Background())
 	return nonce
 }
 
-func (bc *Blockchain) Mining() bool {
+// ProofOfWorkContext is ProofOfWork that gives up with ctx.Err() once ctx
+// is done. The pool and tip are read under the lock, which is released for
+// the search itself.
+func (bc *Blockchain) ProofOfWorkContext(ctx context.Context) (int, error) {
+	bc.mux.RLock()
+	transactions := bc.copyTransactionPool()
+	previousHash := bc.lastBlock().Hash()
+	difficulty := bc.Difficulty
+	threads := bc.miningThreads
+	bc.mux.RUnlock()
+	return bc.proofOfWork(ctx, transactions, previousHash, difficulty, threads)
+}
+
+func (bc *Blockchain) proofOfWork(ctx context.Context, transactions []*Transaction, previousHash [32]byte, difficulty int, threads int) (int, error) {
+	done := ctx.Done()
+	if threads <= 1 {
+		for nonce := 0; ; nonce++ {
+			select {
+			case <-done:
+				return 0, ctx.Err()
+			default:
+			}
+			if bc.ValidProof(nonce, previousHash, transactions, difficulty) {
+				return nonce, nil
+			}
+		}
+	}
+
+	var found int32
+	defer atomic.StoreInt32(&found, 1)
+	result := make(chan int, threads)
+	for w := 0; w < threads; w++ {
+		go func(nonce, step int) {
+			for atomic.LoadInt32(&found) == 0 {
+				if bc.ValidProof(nonce, previousHash, transactions, difficulty) {
+					atomic.StoreInt32(&found, 1)
+					result <- nonce
+					return
+				}
+				nonce += step
+			}
+		}(w, threads)
+	}
+	select {
+	case nonce := <-result:
+		return nonce, nil
+	case <-done:
+		return 0, ctx.Err()
+	}
+}
+
+// SetMiningThreads caps the goroutines ProofOfWork uses. One or less
+// searches serially.
+func (bc *Blockchain) SetMiningThreads(n int) {
 	bc.mux.Lock()
 	defer bc.mux.Unlock()
+	bc.miningThreads = n
+}
+
+func (bc *Blockchain) Mining() bool {
+	return bc.MiningContext(context.Background())
+}
+
+// MiningContext is Mining that gives up on the block once ctx is done. The
+// attempt is also abandoned once a longer chain is adopted in its place.
+func (bc *Blockchain) MiningContext(ctx context.Context) bool {
+	return bc.miningTo(ctx, "")
+}
+
+// MineTo mines one block like Mining but pays its reward to address rather
+// than the node's mining address, for pools that spread rewards over
+// several addresses.
+func (bc *Blockchain) MineTo(address string) (bool, error) {
+	if !utils.IsValidBlockchainAddress(address) {
+		return false, ErrInvalidAddress
+	}
+	return bc.miningTo(context.Background(), address), nil
+}
+
+// miningTo mines a block paying address, or the mining address if it is
+// empty.
+func (bc *Blockchain) miningTo(ctx context.Context, address string) bool {
+	if bc.Stopped() || !bc.mine(ctx, address) {
+		return false
+	}
+
+	// Neighbours answer /consensus by locking their own chain, so the
+	// broadcast must happen after ours is released.
+	bc.broadcastToNeighbours(http.MethodPut, "/consensus", nil)
+
+	return true
+}
+
+func (bc *Blockchain) mine(ctx context.Context, rewardAddress string) bool {
+	bc.mux.Lock()
+	if rewardAddress == "" {
+		rewardAddress = bc.BlockChainAddress
+	}
+
+	// Stop may have been called while we waited for the lock.
+	if bc.IsReplica() || bc.Stopped() {
+		bc.mux.Unlock()
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	bc.beginMiningAttempt(cancel)
+	defer bc.endMiningAttempt()
+
+	start := time.Now()
+	if n := bc.evictGapped(start); n > 0 {
+		bc.logger.Info("evicted gapped transactions", "count", n)
+	}
+	bc.expirePool(start, bc.mempoolMaxAge)
 
 	//if len(bc.TransactionPool) == 0 {
 	//	return false
 	//}
 
-	bc.AddTransaction(MINING_SENDER, bc.BlockChainAddress, MINING_REWARD, nil, nil)
-	nonce := bc.ProofOfWork()
-	previousHash := bc.LastBlock().Hash()
-	bc.CreateBlock(nonce, previousHash)
-	log.Println("action=mining, status=success")
+	// Blocks must replay in order without overdrawing anyone, which pool
+	// admission alone does not guarantee.
+	bc.pruneUnfundablePool()
+	params := bc.params.At(len(bc.Chain))
+	overflow := bc.takeOverflow(params)
+	if params.Consensus == CONSENSUS_POS {
+		defer bc.mux.Unlock()
+		defer bc.restoreOverflow(overflow)
+		if !bc.proposeBlock(rewardAddress) {
+			return false
+		}
+	} else {
+		bc.addCoinbase(params, rewardAddress)
+		transactions := append([]*Transaction(nil), bc.TransactionPool...)
+		work := bc.copyTransactionPool()
+		height := len(bc.Chain)
+		previousHash := bc.lastBlock().Hash()
+		difficulty, threads := bc.Difficulty, bc.miningThreads
+		bc.TransactionPool = bc.TransactionPool[1:]
+		bc.restoreOverflow(overflow)
 
-	for _, n := range bc.neighbours {
-		endpoint := fmt.Sprintf("http://%s/consensus", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("PUT", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
-	}
+		// The search runs without the lock, so transactions keep arriving and
+		// a longer chain can be validated and adopted meanwhile; adopting one
+		// cancels the search.
+		bc.mux.Unlock()
+		powStart := time.Now()
+		nonce, err := bc.proofOfWork(ctx, work, previousHash, difficulty, threads)
+		bc.metrics.ProofOfWorkDone(time.Since(powStart))
+		bc.mux.Lock()
+		defer bc.mux.Unlock()
 
+		if err == nil && (len(bc.Chain) != height || bc.lastBlock().Hash() != previousHash) {
+			err = errors.New("chain changed during proof of work")
+		}
+		if err != nil {
+			bc.logger.Info("mining abandoned", "action", "mining", "height", height, "err", err)
+			return false
+		}
+		bc.appendBlock(bc.newBlockWith(nonce, previousHash, transactions))
+	}
+	bc.metrics.BlockMined()
+	bc.logger.Info("mined block", "action", "mining", "height", len(bc.Chain)-1, "hash", ShortHash(bc.lastBlock().Hash()), "duration", time.Since(start))
 	return true
 }
 
+// addCoinbase puts the mining reward under params and the pending fees for
+// the next block, paid to address, at the front of the pool. The caller must
+// hold bc.mux.
+func (bc *Blockchain) addCoinbase(params NetworkParams, address string) {
+	coinbase := NewTransaction(params.MiningSender(), address, params.Reward(len(bc.Chain))+bc.pendingFees())
+	bc.TransactionPool = append([]*Transaction{coinbase}, bc.TransactionPool...)
+}
+
 func (bc *Blockchain) StartMining() {
-	bc.Mining()
-	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, bc.StartMining)
+	bc.repeat(time.Second*MINING_TIMER_SEC, func() { bc.Mining() })
+}
+
+func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) Amount {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.calculateTotalAmount(blockchainAddress)
 }
 
-func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
-	var totalAmount float32 = 0.0000
+// calculateTotalAmount is CalculateTotalAmount for callers that hold bc.mux.
+// It replays the whole chain; Balance reads the same figure from the index.
+func (bc *Blockchain) calculateTotalAmount(blockchainAddress string) Amount {
+	var totalAmount Amount = 0
+	if bc.snapshot != nil {
+		totalAmount = bc.snapshot.Balances[blockchainAddress]
+	}
 	for _, b := range bc.Chain {
 		for _, t := range b.Transactions {
 			value := t.Value
@@ -342,63 +1094,176 @@ func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
 				totalAmount += value
 			}
 			if blockchainAddress == t.SenderBlockchainAddress {
-				totalAmount -= value
+				totalAmount -= value + t.Fee
 			}
 		}
 	}
 	return totalAmount
 }
 
+// ValidChain reports whether chain passes the node's validation rules. The
+// caller must hold bc.mux.
 func (bc *Blockchain) ValidChain(chain []*Block) bool {
-	preBlock := chain[0]
-	currentIndex := 1
-	for currentIndex < len(chain) {
-		b := chain[currentIndex]
-		if b.PreviousHash != preBlock.Hash() {
-			return false
-		}
+	return bc.chainRules().valid(chain, bc.logger)
+}
+
+// chainRules is what a chain is validated against. It is copied under
+// bc.mux so that a large chain can be validated without holding it.
+type chainRules struct {
+	genesisHash        [32]byte
+	params             NetworkParams
+	snapshot           *pruneSnapshot
+	strictSenderPolicy bool
+	senderDenylist     map[string]bool
+	senderAllowlist    map[string]bool
+}
 
-		if !bc.ValidProof(b.GetNonce(), b.GetPreviousHash(), b.GetTransactions(), MINING_DIFFICULTY) {
+// chainRules copies the current rules. The caller must hold bc.mux.
+func (bc *Blockchain) chainRules() chainRules {
+	return chainRules{
+		genesisHash:        bc.genesisHash,
+		params:             bc.params,
+		snapshot:           bc.snapshot,
+		strictSenderPolicy: bc.strictSenderPolicy,
+		senderDenylist:     bc.senderDenylist,
+		senderAllowlist:    bc.senderAllowlist,
+	}
+}
+
+func (r chainRules) valid(chain []*Block, logger Logger) bool {
+	if len(chain) < 1 {
+		logger.Warn("invalid chain", "err", "empty chain")
+		return false
+	}
+	if err := verifyChain(chain, r.genesisHash, r.params, r.snapshot); err != nil {
+		logger.Warn("invalid chain", "err", err)
+		return false
+	}
+	if r.strictSenderPolicy {
+		if err := verifySenders(chain, r.params, r.senderDenylist, r.senderAllowlist); err != nil {
+			logger.Warn("invalid chain", "err", err)
 			return false
 		}
-
-		preBlock = b
-		currentIndex += 1
 	}
 	return true
 }
 
+// VerifyOwnChain runs the checks ValidChain applies to a neighbour's chain
+// against the node's own, under the current params, to catch a corrupt or
+// misconfigured chain. A failure tied to a block unwraps to a *BlockError.
+func (bc *Blockchain) VerifyOwnChain() error {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if err := verifyChain(bc.Chain, bc.genesisHash, bc.params, bc.snapshot); err != nil {
+		return err
+	}
+	if bc.strictSenderPolicy {
+		return verifySenders(bc.Chain, bc.params, bc.senderDenylist, bc.senderAllowlist)
+	}
+	return nil
+}
+
 func (bc *Blockchain) ResolveConflicts() bool {
-	var longestChain []*Block = nil
-	maxLength := len(bc.Chain)
+	if bc.IsReplica() {
+		return bc.followPrimary()
+	}
 
-	for _, n := range bc.neighbours {
-		endpoint := fmt.Sprintf("http://%s/chain", n)
-		resp, _ := http.Get(endpoint)
-		if resp.StatusCode == 200 {
-			var bcResp Blockchain
-			decoder := json.NewDecoder(resp.Body)
-			_ = decoder.Decode(&bcResp)
+	var candidates [][]*Block
+	for _, n := range bc.peers() {
+		chain, err := bc.fetchChain(n)
+		if err != nil {
+			bc.logger.Warn("fetch chain failed", "peer", n, "err", err)
+			bc.recordPeerFailure(n)
+			continue
+		}
+		bc.recordPeerSuccess(n)
+		candidates = append(candidates, chain)
+	}
 
-			chain := bcResp.Chain
+	// Validating a long chain takes a while, so it runs against a copy of
+	// the rules and only reads the chain under the read lock.
+	bc.mux.RLock()
+	rules := bc.chainRules()
+	tieBreak := bc.tieBreak
+	maxLength := len(bc.Chain)
+	bestTip := bc.lastBlock().Hash()
+	bc.mux.RUnlock()
 
-			if len(chain) > maxLength && bc.ValidChain(chain) {
-				maxLength = len(chain)
-				longestChain = chain
-			}
+	var longestChain []*Block = nil
+	for _, chain := range candidates {
+		longer := len(chain) > maxLength
+		tie := len(chain) == maxLength && tieBreak.wins(chain, bestTip)
+		if (longer || tie) && rules.valid(chain, bc.logger) {
+			maxLength = len(chain)
+			longestChain = chain
+			bestTip = chain[len(chain)-1].Hash()
 		}
 	}
 
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if longestChain != nil && !bc.stillBetter(longestChain, rules) {
+		// Our chain grew or was pruned meanwhile; the next round retries.
+		longestChain = nil
+	}
 	if longestChain != nil {
-		bc.Chain = longestChain
-		log.Println("Resolve conflicts replaced")
+		bc.replaceChain(longestChain)
+		bc.logger.Info("resolve conflicts", "action", "resolve_conflicts", "replaced", true, "height", len(bc.Chain)-1)
 		return true
 	}
-	log.Println("Resolve conflicts not replaced")
+	bc.logger.Info("resolve conflicts", "action", "resolve_conflicts", "replaced", false, "height", len(bc.Chain)-1)
 	return false
 }
 
-func NewTransaction(sender string, recipient string, value float32) *Transaction {
+// stillBetter reports whether chain, validated under rules without the
+// lock, should still replace the chain as it stands now. The caller must
+// hold bc.mux.
+func (bc *Blockchain) stillBetter(chain []*Block, rules chainRules) bool {
+	if bc.snapshot != rules.snapshot {
+		return false
+	}
+	return len(chain) > len(bc.Chain) ||
+		len(chain) == len(bc.Chain) && bc.tieBreak.wins(chain, bc.lastBlock().Hash())
+}
+
+// replaceChain swaps in chain, drops from the pool what the new blocks
+// confirm, returns the transactions of orphaned blocks to the pool and
+// revalidates the pool against the new chain. A running proof of work
+// extends the old tip, so it is cancelled. The caller must hold bc.mux.
+func (bc *Blockchain) replaceChain(chain []*Block) {
+	fork, _ := forkPoint(bc.Chain, chain)
+	orphaned := bc.Chain[fork+1:]
+	bc.hollowPruned(chain)
+	bc.Chain = chain
+	bc.syncDifficulty()
+	if bc.archive != nil {
+		bc.reindexArchive()
+	}
+	if bc.utxo != nil {
+		bc.rebuildUTXO()
+	}
+	bc.totalTransactions = countTransactions(bc.Chain)
+	if bc.snapshot != nil {
+		bc.totalTransactions += bc.snapshot.Transactions
+	}
+	bc.balanceIndex, _ = bc.balancesBefore(len(bc.Chain))
+	// Pruned blocks are hollow, so the hashes confirmed in them come from
+	// the snapshot.
+	bc.confirmedHashes = bc.snapshot.confirmed()
+	_, _, bc.nonceIndex = bc.snapshot.start()
+	for _, b := range bc.Chain {
+		bc.indexConfirmed(b)
+	}
+	bc.dropConfirmed(chain[fork+1:])
+	bc.reinstateOrphans(orphaned, chain[fork+1:])
+	bc.pruneUnfundablePool()
+	bc.notifyConfirmations(fork + 1)
+	bc.persist()
+	bc.publish(chain[fork+1:]...)
+	bc.cancelMining()
+}
+
+func NewTransaction(sender string, recipient string, value Amount) *Transaction {
 	return &Transaction{
 		SenderBlockchainAddress:    sender,
 		RecipientBlockchainAddress: recipient,
@@ -406,14 +1271,44 @@ func NewTransaction(sender string, recipient string, value float32) *Transaction
 	}
 }
 
+// signedBytes is the payload covered by the sender's signature. The stored
+// public key and signature are left out so they can travel with the
+// transaction without changing what was signed.
+func (t *Transaction) signedBytes() []byte {
+	m, _ := json.Marshal(struct {
+		SenderBlockchainAddress    string `json:"senderBlockchainAddress"`
+		RecipientBlockchainAddress string `json:"recipientBlockchainAddress"`
+		Value                      Amount `json:"value"`
+		Fee                        Amount `json:"fee,omitempty"`
+		Nonce                      uint64 `json:"nonce,omitempty"`
+		RecentBlockHash            string `json:"recentBlockHash,omitempty"`
+	}{
+		SenderBlockchainAddress:    t.SenderBlockchainAddress,
+		RecipientBlockchainAddress: t.RecipientBlockchainAddress,
+		Value:                      t.Value,
+		Fee:                        t.Fee,
+		Nonce:                      t.Nonce,
+		RecentBlockHash:            t.RecentBlockHash,
+	})
+	return m
+}
+
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 40))
 	fmt.Printf(" senderBlockchainAddress       %s\n", t.SenderBlockchainAddress)
 	fmt.Printf(" recipientBlockchainAddress    %s\n", t.RecipientBlockchainAddress)
-	fmt.Printf(" value                         %.4f\n", t.Value)
+	fmt.Printf(" value                         %s\n", t.Value)
+	if t.Fee != 0 {
+		fmt.Printf(" fee                           %s\n", t.Fee)
+	}
+	if t.Nonce != 0 {
+		fmt.Printf(" nonce                         %d\n", t.Nonce)
+	}
 }
 
 func (bc *Blockchain) Print() {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
 	fmt.Printf("%s \n", strings.Repeat("*", 25))
 	for i, block := range bc.Chain {
 		fmt.Printf("%s Chain %d %s \n", strings.Repeat("=", 25), i, strings.Repeat("=", 25))
@@ -423,11 +1318,14 @@ func (bc *Blockchain) Print() {
 }
 
 type TransactionRequest struct {
-	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string  `json:"sender_public_key"`
-	Value                      *float32 `json:"value"`
-	Signature                  *string  `json:"signature"`
+	SenderBlockchainAddress    *string `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
+	SenderPublicKey            *string `json:"sender_public_key"`
+	Value                      *Amount `json:"value"`
+	Fee                        *Amount `json:"fee,omitempty"`
+	Nonce                      *uint64 `json:"nonce,omitempty"`
+	RecentBlockHash            *string `json:"recentBlockHash,omitempty"`
+	Signature                  *string `json:"signature"`
 }
 
 func (tr *TransactionRequest) ValidateTransactionRequest() bool {
@@ -439,6 +1337,66 @@ func (tr *TransactionRequest) ValidateTransactionRequest() bool {
 	return true
 }
 
+// VerifySignature checks that Signature was produced by SenderPublicKey over
+// the transaction described by the request.
+func (tr *TransactionRequest) VerifySignature() (bool, error) {
+	if !tr.ValidateTransactionRequest() {
+		return false, errors.New("missing field(s)")
+	}
+	publicKey, err := utils.ParsePublicKey(*tr.SenderPublicKey)
+	if err != nil {
+		return false, err
+	}
+	signature, err := utils.ParseSignature(*tr.Signature)
+	if err != nil {
+		return false, err
+	}
+	h := sha256.Sum256(tr.Transaction().signedBytes())
+	return ecdsa.Verify(publicKey, h[:], signature.R, signature.S), nil
+}
+
+// Transaction builds the transaction the request describes. The request must
+// pass ValidateTransactionRequest.
+func (tr *TransactionRequest) Transaction() *Transaction {
+	t := NewTransaction(*tr.SenderBlockchainAddress, *tr.RecipientBlockchainAddress, *tr.Value)
+	t.Fee = tr.GetFee()
+	if tr.Nonce != nil {
+		t.Nonce = *tr.Nonce
+	}
+	if tr.RecentBlockHash != nil {
+		t.RecentBlockHash = *tr.RecentBlockHash
+	}
+	if tr.SenderPublicKey != nil {
+		t.SenderPublicKey = *tr.SenderPublicKey
+	}
+	if tr.Signature != nil {
+		t.Signature = *tr.Signature
+	}
+	return t
+}
+
+func (tr *TransactionRequest) GetFee() Amount {
+	if tr.Fee == nil {
+		return 0
+	}
+	return *tr.Fee
+}
+
 type AmountResponse struct {
-	Amount float32 `json:"amount"`
+	Amount Amount `json:"amount"`
+}
+
+// NonceResponse answers /nonce with the nonce an address's next transaction
+// should carry.
+type NonceResponse struct {
+	Nonce uint64 `json:"nonce"`
+}
+
+// TransactionResponse answers a submitted transaction with whether it was
+// accepted and the ID to track it by.
+type TransactionResponse struct {
+	Message string `json:"message"`
+	ID      string `json:"id"`
+	// Error says why a rejected transaction was turned down.
+	Error string `json:"error,omitempty"`
 }
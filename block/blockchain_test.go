@@ -0,0 +1,372 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"goblockchain/utils"
+)
+
+func TestAddTransactionRejectsMiningSender(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	mineBlocks(t, bc, 1)
+
+	for _, sender := range []string{bc.Params().MiningSender(), GENESIS_SENDER} {
+		tx := NewTransaction(sender, miner.address, 10*COIN)
+		err := bc.AddSignedTransactionE(tx, &miner.private.PublicKey, miner.sign(t, tx))
+		if !errors.Is(err, ErrReservedSender) {
+			t.Errorf("sender %q: got %v, want ErrReservedSender", sender, err)
+		}
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 0 {
+		t.Fatalf("pool holds %d transactions, want none", len(pool))
+	}
+
+	bc.SetMiningSender("POOL REWARDS")
+	tx := NewTransaction("POOL REWARDS", miner.address, 10*COIN)
+	if err := bc.AddSignedTransactionE(tx, &miner.private.PublicKey, miner.sign(t, tx)); !errors.Is(err, ErrReservedSender) {
+		t.Fatalf("custom mining sender: got %v, want ErrReservedSender", err)
+	}
+}
+
+// TestAddTransactionDuringReorg admits transactions while a longer fork
+// replaces the chain; run it with -race. Every admitted transaction must
+// end up checked against the chain it was pooled on.
+func TestAddTransactionDuringReorg(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	fork := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, fork, 3)
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 20; i++ {
+			tx := NewTransaction(alice.address, bob.address, Amount(i))
+			bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if !bc.ResolveConflicts() {
+			t.Error("the longer fork was not adopted")
+		}
+	}()
+	wg.Wait()
+
+	if got, want := bc.LastBlock().Hash(), fork.LastBlock().Hash(); got != want {
+		t.Fatalf("tip %x, want the fork's %x", got, want)
+	}
+	var pending Amount
+	for _, tx := range bc.CopyTransactionPool() {
+		pending += tx.Value + tx.Fee
+	}
+	if balance := bc.Balance(alice.address); pending > balance {
+		t.Fatalf("pool spends %s of alice's %s", pending, balance)
+	}
+	mineBlocks(t, bc, 1)
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestReorgDropsConfirmedTransactions adopts a fork that confirms a pooled
+// transaction and one waiting on a nonce gap. Neither may stay behind to be
+// mined again.
+func TestReorgDropsConfirmedTransactions(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	fork := forkBlockchain(t, bc, bob.address)
+
+	signed := func(value Amount, nonce uint64) (*Transaction, *utils.Signature) {
+		tx := NewTransaction(alice.address, bob.address, value)
+		tx.Nonce = nonce
+		return tx, alice.sign(t, tx)
+	}
+	clone := func(tx *Transaction) *Transaction {
+		c := *tx
+		return &c
+	}
+	pooled, pooledSig := signed(1, 0)
+	first, firstSig := signed(2, 1)
+	gapped, gappedSig := signed(3, 2)
+	for _, add := range []struct {
+		bc  *Blockchain
+		tx  *Transaction
+		sig *utils.Signature
+	}{
+		{bc, pooled, pooledSig},
+		{bc, gapped, gappedSig},
+		{fork, clone(pooled), pooledSig},
+		{fork, clone(first), firstSig},
+		{fork, clone(gapped), gappedSig},
+	} {
+		if err := add.bc.AddSignedTransactionE(add.tx, &alice.private.PublicKey, add.sig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mineBlocks(t, fork, 2)
+
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer fork was not adopted")
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 0 {
+		t.Fatalf("pool still holds %d confirmed transactions", len(pool))
+	}
+	bc.mux.RLock()
+	queued := bc.gappedCount()
+	bc.mux.RUnlock()
+	if queued != 0 {
+		t.Fatalf("gap queue still holds %d confirmed transactions", queued)
+	}
+	mineBlocks(t, bc, 1)
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConcurrentMiningAndPoolAccess mines while other goroutines admit
+// transactions, read the pool and the chain, and change settings; run it
+// with -race.
+func TestConcurrentMiningAndPoolAccess(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			if !bc.Mining() {
+				t.Error("mining failed")
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 30; i++ {
+			tx := NewTransaction(alice.address, bob.address, Amount(i))
+			bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			bc.CopyTransactionPool()
+			bc.GetTransactionPool()
+			bc.PendingTransactionsFor(alice.address)
+			bc.Balance(alice.address)
+			bc.LastBlock()
+			bc.Stats()
+			bc.Params()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			bc.SetMiningThreads(1 + i%4)
+			bc.SetHTTPTimeout(HTTP_TIMEOUT)
+			bc.SetMaxChainResponseBytes(MAX_CHAIN_RESPONSE_BYTES)
+			bc.SetAcceptPendingCredits(false)
+			bc.SetNonceGapTimeout(NONCE_GAP_TIMEOUT)
+			bc.SetRequireNonce(false)
+			bc.SetRequireRecentBlock(false)
+			bc.SetSenderDenylist(nil)
+			bc.SetStrictSenderPolicy(false)
+			bc.SetMaxPendingPerSender(MAX_PENDING_PER_SENDER)
+			bc.SetCycleDetectionDepth(CYCLE_DETECTION_DEPTH)
+			bc.SetMempoolMaxAge(MEMPOOL_MAX_AGE)
+			bc.SetBroadcastRetries(BROADCAST_RETRIES, BROADCAST_BACKOFF)
+			bc.SetStaleTipThreshold(STALE_TIP_THRESHOLD)
+			bc.SetLogger(NewLogger(io.Discard, LOG_ERROR, LOG_FORMAT_TEXT))
+			bc.SetMetrics(noMetrics{})
+		}
+	}()
+	wg.Wait()
+
+	if got := len(bc.Chain); got != 8 {
+		t.Fatalf("chain has %d blocks, want 8", got)
+	}
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransactionRequestVerifySignature(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	tx := NewTransaction(alice.address, bob.address, COIN)
+	tx.Fee = COIN / 100
+	signature := alice.sign(t, tx).String()
+	request := func() *TransactionRequest {
+		value, fee, key, sig := tx.Value, tx.Fee, alice.publicKey(), signature
+		return &TransactionRequest{
+			SenderBlockchainAddress:    &alice.address,
+			RecipientBlockchainAddress: &bob.address,
+			SenderPublicKey:            &key,
+			Value:                      &value,
+			Fee:                        &fee,
+			Signature:                  &sig,
+		}
+	}
+
+	if ok, err := request().VerifySignature(); err != nil || !ok {
+		t.Fatalf("signed request: %v, %v; want true, nil", ok, err)
+	}
+
+	tampered := request()
+	*tampered.Value++
+	if ok, err := tampered.VerifySignature(); err != nil || ok {
+		t.Fatalf("tampered value: %v, %v; want false, nil", ok, err)
+	}
+
+	otherKey := bob.publicKey()
+	wrongKey := request()
+	wrongKey.SenderPublicKey = &otherKey
+	if ok, _ := wrongKey.VerifySignature(); ok {
+		t.Fatal("verified against another key")
+	}
+
+	missing := request()
+	missing.Signature = nil
+	if _, err := missing.VerifySignature(); err == nil {
+		t.Fatal("verified a request without a signature")
+	}
+	garbled := request()
+	bad := "not-hex"
+	garbled.Signature = &bad
+	if _, err := garbled.VerifySignature(); err == nil {
+		t.Fatal("verified a request with a malformed signature")
+	}
+}
+
+func TestTotalTransactions(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	want := len(bc.Chain[0].Transactions)
+	if got := bc.TotalTransactions(); got != want {
+		t.Fatalf("genesis total %d, want %d", got, want)
+	}
+
+	mineBlocks(t, bc, 2)
+	want += 2
+	fork := forkBlockchain(t, bc, bob.address)
+	for i := uint64(1); i <= 3; i++ {
+		if err := addNonced(t, bc, alice, bob.address, COIN/10, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mineBlocks(t, bc, 1)
+	want += 4
+	if got := bc.TotalTransactions(); got != want {
+		t.Fatalf("total %d, want %d", got, want)
+	}
+	if got := bc.Stats().TotalTransactions; got != want {
+		t.Fatalf("Stats total %d, want %d", got, want)
+	}
+
+	// A longer fork of empty blocks replaces the one holding the transfers,
+	// which return to the pool.
+	mineBlocks(t, fork, 3)
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer fork was not adopted")
+	}
+	if got, want := bc.TotalTransactions(), fork.TotalTransactions(); got != want {
+		t.Fatalf("total after reorg %d, want the fork's %d", got, want)
+	}
+}
+
+// TestBlockHashCache checks that the cached hash matches a fresh one and
+// stays out of the block's encoding.
+func TestBlockHashCache(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	mineBlocks(t, bc, 1)
+	b := bc.Chain[1]
+	before, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := b.Hash()
+	after, _ := json.Marshal(b)
+	if string(before) != string(after) {
+		t.Fatal("hashing changed the block's encoding")
+	}
+	if fresh := sha256.Sum256(before); fresh != cached {
+		t.Fatalf("cached hash %x, want %x", cached, fresh)
+	}
+}
+
+// TestBlockVersionRoundTrip encodes and decodes a version 1 and a version 2
+// block. Each must keep its hash and validate at its height; a version 1
+// block ignores version 2 fields a peer adds, and unknown versions fail.
+func TestBlockVersionRoundTrip(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	coinbase := NewTransaction(bc.Params().MiningSender(), miner.address, MINING_REWARD)
+
+	v2 := sealBlock(bc.Chain, []*Transaction{coinbase}, 1)
+	v1 := sealBlock(bc.Chain, []*Transaction{coinbase}, 1)
+	v1.Version, v1.Height, v1.MerkleRoot = BLOCK_VERSION_1, 0, [32]byte{}
+	v1.invalidateHash()
+
+	for _, b := range []*Block{v1, v2} {
+		m, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded Block
+		if err := json.Unmarshal(m, &decoded); err != nil {
+			t.Fatalf("version %d: %v", b.Version, err)
+		}
+		if decoded.Version != b.Version || decoded.Height != b.Height || decoded.MerkleRoot != b.MerkleRoot {
+			t.Errorf("version %d: decoded as version %d, height %d, merkle root %x", b.Version, decoded.Version, decoded.Height, decoded.MerkleRoot)
+		}
+		if decoded.Hash() != b.Hash() {
+			t.Errorf("version %d: hash changed in the round trip", b.Version)
+		}
+		if err := verifyBlock(&decoded, 1, bc.Params()); err != nil {
+			t.Errorf("version %d: %v", b.Version, err)
+		}
+	}
+
+	m, _ := json.Marshal(v2)
+	var stripped map[string]interface{}
+	if err := json.Unmarshal(m, &stripped); err != nil {
+		t.Fatal(err)
+	}
+	stripped["version"] = BLOCK_VERSION_1
+	m, _ = json.Marshal(stripped)
+	var legacy Block
+	if err := json.Unmarshal(m, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Height != 0 || legacy.MerkleRoot != ([32]byte{}) {
+		t.Error("a version 1 block kept version 2 fields")
+	}
+
+	v3 := sealBlock(bc.Chain, []*Transaction{coinbase}, 1)
+	v3.Version = BLOCK_VERSION_2 + 1
+	if err := verifyBlock(v3, 1, bc.Params()); err == nil {
+		t.Error("a block of an unknown version validated")
+	}
+}
@@ -0,0 +1,59 @@
+package block
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// blockOverhead is an upper bound on the encoded size of the block at height
+// holding only a coinbase transaction to address.
+func blockOverhead(address string, miningSender string, height int) int {
+	transactions := []*Transaction{NewTransaction(miningSender, address, math.MaxInt64)}
+	b := &Block{
+		Version:           BLOCK_VERSION,
+		Nonce:             math.MaxInt64,
+		Timestamp:         math.MaxInt64,
+		Transactions:      transactions,
+		Proposer:          address,
+		ProposerPublicKey: strings.Repeat("f", 128),
+		ProposerSignature: strings.Repeat("f", 128),
+		Height:            height,
+		MerkleRoot:        merkleRoot(transactions),
+	}
+	return b.Size()
+}
+
+// takeOverflow removes from the pool, and returns, the transactions that
+// would push the next block past params.MaxBlockBytes or
+// params.MaxTransactionsPerBlock once the coinbase is added. They keep their
+// order so they can be put back after the block is mined. The caller must
+// hold bc.mux.
+func (bc *Blockchain) takeOverflow(params NetworkParams) []*Transaction {
+	maxBytes, maxTxs := params.MaxBlockBytes, params.MaxTransactionsPerBlock
+	if maxBytes <= 0 && maxTxs <= 0 {
+		return nil
+	}
+	size := blockOverhead(bc.BlockChainAddress, params.MiningSender(), len(bc.Chain))
+	for i, t := range bc.TransactionPool {
+		m, _ := json.Marshal(t)
+		size += len(m) + 1
+		if maxBytes > 0 && size > maxBytes || maxTxs > 0 && i+1 >= maxTxs {
+			overflow := append([]*Transaction(nil), bc.TransactionPool[i:]...)
+			bc.TransactionPool = bc.TransactionPool[:i]
+			bc.logger.Info("deferring transactions to a later block", "count", len(overflow), "maxBlockBytes", maxBytes, "maxTransactions", maxTxs)
+			return overflow
+		}
+	}
+	return nil
+}
+
+// restoreOverflow returns deferred transactions to the pool after a block
+// is mined. The caller must hold bc.mux.
+func (bc *Blockchain) restoreOverflow(overflow []*Transaction) {
+	if len(overflow) == 0 {
+		return
+	}
+	bc.TransactionPool = append(bc.TransactionPool, overflow...)
+	bc.pruneUnfundablePool()
+}
@@ -0,0 +1,41 @@
+package block
+
+import "testing"
+
+// TestTransactionsSpanBlocks pools 2500 transactions under the default cap
+// of 1000 per block, coinbase included. They must be mined over exactly
+// three blocks, the rest waiting in the pool each time.
+func TestTransactionsSpanBlocks(t *testing.T) {
+	recipient := newTestKey(t)
+	bc := newTestBlockchain(t, recipient.address)
+	const total = 2500
+	perSender := MAX_PENDING_PER_SENDER
+	senders := fundedKeys(t, bc, (total+perSender-1)/perSender)
+	start := bc.ChainLength()
+
+	for i := 0; i < total; i++ {
+		from := senders[i/perSender]
+		tx := NewTransaction(from.address, recipient.address, Amount(i%perSender+1))
+		if err := bc.AddSignedTransactionE(tx, &from.private.PublicKey, from.sign(t, tx)); err != nil {
+			t.Fatalf("transaction %d: %v", i, err)
+		}
+	}
+
+	maxTxs := bc.Params().MaxTransactionsPerBlock
+	for _, wantPooled := range []int{total - (maxTxs - 1), total - 2*(maxTxs-1), 0} {
+		mineBlocks(t, bc, 1)
+		if pooled := len(bc.CopyTransactionPool()); pooled != wantPooled {
+			t.Fatalf("after block %d: %d transactions pooled, want %d", bc.ChainLength()-1, pooled, wantPooled)
+		}
+	}
+	mined := 0
+	for _, b := range bc.Chain[start:] {
+		if len(b.Transactions) > maxTxs {
+			t.Errorf("a block carries %d transactions, over the cap of %d", len(b.Transactions), maxTxs)
+		}
+		mined += len(b.Transactions) - 1
+	}
+	if mined != total {
+		t.Fatalf("%d transactions mined, want %d", mined, total)
+	}
+}
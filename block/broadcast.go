@@ -0,0 +1,80 @@
+package block
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	BROADCAST_RETRIES = 3
+	BROADCAST_BACKOFF = 200 * time.Millisecond
+)
+
+// SetBroadcastRetries sets how many times a request to a neighbour is
+// retried after the first attempt fails, and the delay before the first
+// retry, which doubles with each further one.
+func (bc *Blockchain) SetBroadcastRetries(retries int, backoff time.Duration) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.broadcastRetries = retries
+	bc.broadcastBackoff = backoff
+}
+
+// broadcastToNeighbours sends the request to every neighbour in parallel
+// and returns once each has answered or run out of retries. Connection
+// errors and 5xx answers are retried; a neighbour that never succeeds is
+// logged and counted as a peer failure.
+func (bc *Blockchain) broadcastToNeighbours(method, path string, body []byte) {
+	var wg sync.WaitGroup
+	for _, n := range bc.peers() {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			if err := bc.sendWithRetry(method, fmt.Sprintf("http://%s%s", n, path), body); err != nil {
+				bc.logger.Warn("broadcast failed", "peer", n, "method", method, "path", path, "err", err)
+				bc.recordPeerFailure(n)
+				return
+			}
+			bc.recordPeerSuccess(n)
+		}(n)
+	}
+	wg.Wait()
+}
+
+func (bc *Blockchain) sendWithRetry(method, endpoint string, body []byte) error {
+	client, _ := bc.peerClient()
+	bc.mux.RLock()
+	retries, backoff := bc.broadcastRetries, bc.broadcastBackoff
+	bc.mux.RUnlock()
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-bc.done:
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		var req *http.Request
+		req, err = http.NewRequest(method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 500 {
+			err = fmt.Errorf("unexpected status %d", resp.StatusCode)
+			continue
+		}
+		return nil
+	}
+	return err
+}
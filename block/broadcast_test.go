@@ -0,0 +1,79 @@
+package block
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyPeer fails the first failures PUT requests with a 503 and accepts
+// the rest, recording when each arrived and what the last one carried.
+// Other requests, such as the pool clearing the genesis block triggers, are
+// ignored.
+type flakyPeer struct {
+	mux      sync.Mutex
+	failures int
+	arrivals []time.Time
+	method   string
+	path     string
+	body     string
+}
+
+func (p *flakyPeer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPut {
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.arrivals = append(p.arrivals, time.Now())
+	p.method, p.path, p.body = req.Method, req.URL.Path, string(body)
+	if len(p.arrivals) <= p.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+func TestBroadcastRetriesWithBackoff(t *testing.T) {
+	const backoff = 20 * time.Millisecond
+	for _, c := range []struct {
+		name     string
+		retries  int
+		attempts int
+		failed   int
+	}{
+		{"succeeds on the third attempt", 3, 3, 0},
+		{"gives up after one retry", 1, 2, 1},
+	} {
+		peer := &flakyPeer{failures: 2}
+		ts := httptest.NewServer(peer)
+		bc := newTestBlockchain(t, newTestKey(t).address)
+		bc.SetNeighbourScan(false)
+		bc.SetBroadcastRetries(c.retries, backoff)
+		address := strings.TrimPrefix(ts.URL, "http://")
+		if err := bc.AddNeighbour(address); err != nil {
+			t.Fatal(err)
+		}
+
+		bc.broadcastToNeighbours(http.MethodPut, "/transactions", []byte(`{"value":1}`))
+		ts.Close()
+
+		if len(peer.arrivals) != c.attempts {
+			t.Errorf("%s: %d attempts, want %d", c.name, len(peer.arrivals), c.attempts)
+		}
+		if peer.method != http.MethodPut || peer.path != "/transactions" || peer.body != `{"value":1}` {
+			t.Errorf("%s: peer got %s %s %q", c.name, peer.method, peer.path, peer.body)
+		}
+		for i := 1; i < len(peer.arrivals); i++ {
+			if gap, want := peer.arrivals[i].Sub(peer.arrivals[i-1]), backoff<<(i-1); gap < want {
+				t.Errorf("%s: retry %d came after %v, want at least %v", c.name, i, gap, want)
+			}
+		}
+		if got := bc.PeerFailures()[address]; got != c.failed {
+			t.Errorf("%s: %d failures recorded, want %d", c.name, got, c.failed)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package block
+
+import "sort"
+
+// Checkpoints pins the hashes of blocks at given heights. A chain whose
+// block at a checkpoint height has another hash is invalid, however long,
+// so no reorg can reach below the highest checkpoint the node knows.
+type Checkpoints map[int][32]byte
+
+// verifyCheckpoints reports the lowest checkpoint chain misses.
+func verifyCheckpoints(chain []*Block, checkpoints Checkpoints) error {
+	heights := make([]int, 0, len(checkpoints))
+	for height := range checkpoints {
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+	for _, height := range heights {
+		if hash := checkpoints[height]; height < len(chain) && chain[height].Hash() != hash {
+			return verifyErrorf(height, "hash %x does not match checkpoint %x", chain[height].Hash(), hash)
+		}
+	}
+	return nil
+}
+
+// SetCheckpoints replaces the checkpoints chains are validated against.
+// Every node of a network must agree on them.
+func (bc *Blockchain) SetCheckpoints(checkpoints Checkpoints) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.params.Checkpoints = checkpoints
+}
@@ -0,0 +1,40 @@
+package block
+
+import "testing"
+
+// TestCheckpoints pins block 3 and offers two longer forks: one branching
+// off after block 1, below the checkpoint, and one after block 4, above it.
+// Only the second may be adopted.
+func TestCheckpoints(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	early := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, bc, 3)
+	late := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, bc, 1)
+	bc.SetCheckpoints(Checkpoints{3: bc.Chain[3].Hash()})
+	bc.SetNeighbourScan(false)
+
+	mineBlocks(t, early, 5)
+	if bc.ValidChain(early.Chain) {
+		t.Fatal("a chain diverging below the checkpoint is valid")
+	}
+	if err := bc.AddNeighbour(servePeer(t, early)); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ResolveConflicts() {
+		t.Fatal("a chain diverging below the checkpoint was adopted")
+	}
+
+	mineBlocks(t, late, 2)
+	if err := bc.AddNeighbour(servePeer(t, late)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("a chain diverging above the checkpoint was not adopted")
+	}
+	if got := bc.LastBlock().Hash(); got != late.LastBlock().Hash() {
+		t.Fatal("the node did not move to the later fork's tip")
+	}
+}
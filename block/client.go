@@ -0,0 +1,36 @@
+package block
+
+import (
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	HTTP_DIAL_TIMEOUT            = 5 * time.Second
+	HTTP_MAX_IDLE_CONNS          = 64
+	HTTP_MAX_IDLE_CONNS_PER_HOST = 4
+	HTTP_IDLE_CONN_TIMEOUT       = 90 * time.Second
+)
+
+// NewPeerClient returns a client for talking to nodes that gives up on a
+// request after timeout, or never if it is zero. Connections to each peer
+// are kept alive between requests, up to HTTP_MAX_IDLE_CONNS_PER_HOST idle
+// ones.
+func NewPeerClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   HTTP_DIAL_TIMEOUT,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConns:          HTTP_MAX_IDLE_CONNS,
+			MaxIdleConnsPerHost:   HTTP_MAX_IDLE_CONNS_PER_HOST,
+			IdleConnTimeout:       HTTP_IDLE_CONN_TIMEOUT,
+			TLSHandshakeTimeout:   HTTP_DIAL_TIMEOUT,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package block
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPeerClientTimesOut(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer ts.Close()
+
+	const timeout = 100 * time.Millisecond
+	start := time.Now()
+	_, err := NewPeerClient(timeout).Get(ts.URL)
+	if err == nil {
+		t.Fatal("request to a hanging server succeeded")
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("got %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Fatalf("gave up after %v", elapsed)
+	}
+}
+
+func TestPeerClientReusesConnections(t *testing.T) {
+	var conns int32
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("{}"))
+	}))
+	ts.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	ts.Start()
+	defer ts.Close()
+
+	client := NewPeerClient(time.Second)
+	for i := 0; i < 5; i++ {
+		resp, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Fatalf("5 sequential requests opened %d connections, want 1", n)
+	}
+}
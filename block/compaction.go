@@ -0,0 +1,93 @@
+package block
+
+import "time"
+
+const COMPACTION_INTERVAL = 10 * time.Minute
+
+// SetCompactionInterval sets how often StartCompaction runs Compact. Zero
+// stops the periodic compaction.
+func (bc *Blockchain) SetCompactionInterval(d time.Duration) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.compactionInterval = d
+}
+
+// Compact drops expired nonce-gapped and pooled transactions, bookkeeping
+// for peers that are no longer neighbours, announced peers that keep
+// failing, and anything over the caps of the bounded histories. Each
+// structure is locked only while it is trimmed. It returns how many entries
+// were freed.
+func (bc *Blockchain) Compact() int {
+	bc.mux.Lock()
+	now := time.Now()
+	gapped := bc.evictGapped(now)
+	expired := len(bc.expirePool(now, bc.mempoolMaxAge))
+	samples := 0
+	if n := len(bc.confirmationSamples) - bc.confirmationSampleSize; n > 0 {
+		bc.confirmationSamples = append([]confirmationSample(nil), bc.confirmationSamples[n:]...)
+		samples = n
+	}
+	bc.mux.Unlock()
+
+	bc.rejectionsMux.Lock()
+	rejections := 0
+	if n := len(bc.rejections) - bc.rejectionHistory; n > 0 {
+		bc.rejections = append([]RejectionRecord(nil), bc.rejections[n:]...)
+		rejections = n
+	}
+	bc.rejectionsMux.Unlock()
+
+	bc.muxNeighbours.Lock()
+	// Announced peers that keep failing are no longer added back on the next
+	// neighbour scan, and the oldest go once there are more than
+	// MAX_ANNOUNCED_PEERS, which bootstrap replies can push past.
+	announced := len(bc.announcedPeers)
+	failing := make(map[string]bool)
+	for _, n := range bc.announcedPeers {
+		if bc.peerFailures[n] >= PEER_FAILURE_LIMIT {
+			failing[n] = true
+		}
+	}
+	bc.announcedPeers = withoutPeers(bc.announcedPeers, failing)
+	if n := len(bc.announcedPeers) - MAX_ANNOUNCED_PEERS; n > 0 {
+		bc.announcedPeers = append([]string(nil), bc.announcedPeers[n:]...)
+	}
+	peers := announced - len(bc.announcedPeers)
+
+	current := make(map[string]bool, len(bc.neighbours))
+	for _, n := range bc.neighbours {
+		current[n] = true
+	}
+	if bc.primary != "" {
+		current[bc.primary] = true
+	}
+	for n := range bc.mempoolPulled {
+		if !current[n] {
+			delete(bc.mempoolPulled, n)
+			peers++
+		}
+	}
+	for _, m := range []map[string]int{bc.peerFailures, bc.pingFailures} {
+		for n := range m {
+			if !current[n] {
+				delete(m, n)
+				peers++
+			}
+		}
+	}
+	bc.muxNeighbours.Unlock()
+
+	freed := gapped + expired + samples + rejections + peers
+	bc.logger.Info("compacted", "action", "compact", "gapped", gapped, "expired", expired, "samples", samples, "rejections", rejections, "peers", peers)
+	return freed
+}
+
+func (bc *Blockchain) StartCompaction() {
+	bc.mux.RLock()
+	interval := bc.compactionInterval
+	bc.mux.RUnlock()
+	if interval <= 0 {
+		return
+	}
+	bc.repeat(interval, func() { bc.Compact() })
+}
@@ -0,0 +1,166 @@
+package block
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+)
+
+// confirmationWatch tracks one transaction registered with OnConfirmed.
+// height is -1 while the transaction is not in the chain.
+type confirmationWatch struct {
+	confirmed func(height int, blockHash [32]byte)
+	reorged   func(height int, blockHash [32]byte)
+	height    int
+	blockHash [32]byte
+}
+
+// ID identifies a transaction by the fields its sender signed. Anyone
+// relaying it can re-encode the signature, so a transaction's ID must not
+// depend on it; ID is therefore the same as Hash.
+func (t *Transaction) ID() [32]byte {
+	return t.Hash()
+}
+
+// encodingHash is the hash of the transaction's full encoding, signature
+// included. Blocks commit to it so that no part of a confirmed transaction
+// can be altered without changing the block hash.
+func (t *Transaction) encodingHash() [32]byte {
+	m, _ := json.Marshal(t)
+	return sha256.Sum256(m)
+}
+
+// Hash identifies a transaction by what its sender signed, so it does not
+// change with the signature's encoding. Two transfers with identical
+// content, as when neither carries a nonce, share a hash.
+func (t *Transaction) Hash() [32]byte {
+	return sha256.Sum256(t.signedBytes())
+}
+
+// OnConfirmed registers callbacks for the transaction with the given ID.
+// confirmed is called when a block containing it joins the chain. If a reorg
+// later orphans that block, reorged is called with the orphaned height and
+// block hash and the transaction is watched again, so confirmed fires once
+// more when it is re-mined. Either callback may be nil.
+func (bc *Blockchain) OnConfirmed(txID [32]byte, confirmed func(height int, blockHash [32]byte), reorged func(height int, blockHash [32]byte)) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if bc.confirmations == nil {
+		bc.confirmations = make(map[[32]byte]*confirmationWatch)
+		bc.watchedHeights = make(map[int][][32]byte)
+	}
+	bc.unwatchHeight(txID)
+	w := &confirmationWatch{
+		confirmed: confirmed,
+		reorged:   reorged,
+		height:    -1,
+	}
+	bc.confirmations[txID] = w
+	if height, ok := bc.confirmedHeight(txID); ok {
+		bc.confirmWatch(txID, w, height)
+	}
+}
+
+// StopWatching drops the callbacks registered for txID.
+func (bc *Blockchain) StopWatching(txID [32]byte) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.unwatchHeight(txID)
+	delete(bc.confirmations, txID)
+}
+
+// confirmedHeight returns the height of the block confirming the
+// transaction with the given ID. The caller must hold bc.mux.
+func (bc *Blockchain) confirmedHeight(id [32]byte) (int, bool) {
+	if bc.archive != nil {
+		loc, ok := bc.archive.transactions[id]
+		return loc.height, ok
+	}
+	for height := len(bc.Chain) - 1; height >= 0; height-- {
+		for _, t := range bc.Chain[height].Transactions {
+			if t.ID() == id {
+				return height, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// confirmWatch records that the watched transaction id is confirmed at
+// height and calls its callback. The caller must hold bc.mux.
+func (bc *Blockchain) confirmWatch(id [32]byte, w *confirmationWatch, height int) {
+	w.height = height
+	w.blockHash = bc.Chain[height].Hash()
+	bc.watchedHeights[height] = append(bc.watchedHeights[height], id)
+	if w.confirmed != nil {
+		w.confirmed(w.height, w.blockHash)
+	}
+}
+
+// unwatchHeight removes id from the watches indexed under its confirming
+// height. The caller must hold bc.mux.
+func (bc *Blockchain) unwatchHeight(id [32]byte) {
+	w, ok := bc.confirmations[id]
+	if !ok || w.height < 0 {
+		return
+	}
+	ids := bc.watchedHeights[w.height]
+	for i, other := range ids {
+		if other == id {
+			ids = append(ids[:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(bc.watchedHeights, w.height)
+	} else {
+		bc.watchedHeights[w.height] = ids
+	}
+}
+
+// notifyConfirmations reconciles the watched transactions with the blocks
+// from height from on, the only ones that changed. Watches confirmed below
+// from are left alone, so it runs after a block is appended and after the
+// chain is replaced without rescanning the whole chain. The caller must
+// hold bc.mux.
+func (bc *Blockchain) notifyConfirmations(from int) {
+	if len(bc.confirmations) == 0 {
+		return
+	}
+	for height, ids := range bc.watchedHeights {
+		if height < from {
+			continue
+		}
+		var blockHash [32]byte
+		present := height < len(bc.Chain)
+		if present {
+			blockHash = bc.Chain[height].Hash()
+		}
+		var kept [][32]byte
+		for _, id := range ids {
+			w := bc.confirmations[id]
+			if present && w.blockHash == blockHash {
+				kept = append(kept, id)
+				continue
+			}
+			orphanedHash := w.blockHash
+			w.height = -1
+			w.blockHash = [32]byte{}
+			if w.reorged != nil {
+				w.reorged(height, orphanedHash)
+			}
+		}
+		if len(kept) == 0 {
+			delete(bc.watchedHeights, height)
+		} else {
+			bc.watchedHeights[height] = kept
+		}
+	}
+	for height := from; height < len(bc.Chain); height++ {
+		for _, t := range bc.Chain[height].Transactions {
+			id := t.ID()
+			if w, ok := bc.confirmations[id]; ok && w.height < 0 {
+				bc.confirmWatch(id, w, height)
+			}
+		}
+	}
+}
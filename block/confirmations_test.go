@@ -0,0 +1,92 @@
+package block
+
+import "testing"
+
+// TestTransactionIDIgnoresSignature re-encodes a transaction's signature,
+// as a relaying node could. Its ID must not change, but the hash blocks
+// commit to must.
+func TestTransactionIDIgnoresSignature(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	tx := NewTransaction(alice.address, bob.address, 1)
+	tx.Signature = alice.sign(t, tx).String()
+	altered := *tx
+	altered.Signature = alice.sign(t, tx).String()
+	if altered.Signature == tx.Signature {
+		t.Fatal("signing twice gave the same signature")
+	}
+	if altered.ID() != tx.ID() {
+		t.Fatal("the ID changed with the signature")
+	}
+	if altered.encodingHash() == tx.encodingHash() {
+		t.Fatal("the encoding hash ignores the signature")
+	}
+}
+
+// TestOnConfirmedReportsReorg watches a transaction through its block being
+// orphaned by a longer fork and the transaction being mined again.
+func TestOnConfirmedReportsReorg(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	fork := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, fork, 3)
+
+	tx := NewTransaction(alice.address, bob.address, 1)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	type event struct {
+		height    int
+		blockHash [32]byte
+	}
+	var confirmed, reorged []event
+	bc.OnConfirmed(tx.ID(),
+		func(height int, blockHash [32]byte) { confirmed = append(confirmed, event{height, blockHash}) },
+		func(height int, blockHash [32]byte) { reorged = append(reorged, event{height, blockHash}) })
+
+	mineBlocks(t, bc, 1)
+	if len(confirmed) != 1 || confirmed[0].height != 3 {
+		t.Fatalf("confirmations %v, want one at height 3", confirmed)
+	}
+	orphaned := bc.LastBlock().Hash()
+	if confirmed[0].blockHash != orphaned {
+		t.Fatal("confirmed with the wrong block hash")
+	}
+
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer fork was not adopted")
+	}
+	if len(reorged) != 1 || reorged[0] != (event{3, orphaned}) {
+		t.Fatalf("reorgs %v, want one at height 3 in block %x", reorged, orphaned)
+	}
+
+	mineBlocks(t, bc, 1)
+	if len(confirmed) != 2 || confirmed[1].height != 6 || confirmed[1].blockHash != bc.LastBlock().Hash() {
+		t.Fatalf("confirmations %v, want a second at height 6", confirmed)
+	}
+	if len(reorged) != 1 {
+		t.Fatalf("reorgs %v after re-mining, want still one", reorged)
+	}
+}
+
+// TestOnConfirmedFindsConfirmedTransaction watches a transaction that is
+// already in the chain; confirmed must fire at once.
+func TestOnConfirmedFindsConfirmedTransaction(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	tx := NewTransaction(alice.address, bob.address, 1)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 2)
+	height := -1
+	bc.OnConfirmed(tx.ID(), func(h int, _ [32]byte) { height = h }, nil)
+	if height != 2 {
+		t.Fatalf("confirmed at %d, want 2", height)
+	}
+}
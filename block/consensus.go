@@ -0,0 +1,206 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goblockchain/utils"
+	"sort"
+	"time"
+)
+
+type ConsensusMode int
+
+const (
+	// CONSENSUS_POW seals blocks with a proof-of-work nonce.
+	CONSENSUS_POW ConsensusMode = iota
+	// CONSENSUS_POS lets a proposer, picked with probability proportional to
+	// its confirmed balance, seal blocks with its signature. The network
+	// needs staked balances to start, e.g. from genesis allocations.
+	CONSENSUS_POS
+)
+
+// PROPOSER_TIMEOUT is how long a proof-of-stake slot waits for its proposer,
+// a few mining rounds, before passing to the next one drawn.
+const PROPOSER_TIMEOUT = 3 * MINING_TIMER_SEC * time.Second
+
+// SetProposerKey sets the key used to sign blocks under proof of stake. It
+// must belong to BlockChainAddress.
+func (bc *Blockchain) SetProposerKey(privateKey *ecdsa.PrivateKey) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.proposerKey = privateKey
+}
+
+// SelectProposer returns the address entitled to propose the block following
+// chain if it were sealed now. Each address with a positive balance is
+// picked with probability proportional to that balance. The draw is seeded
+// by the hash of the block below the tip and the height, never by the tip's
+// own hash: the tip's proposer could otherwise re-sign it until it won the
+// next slot too. Every ProposerTimeout without a block the slot passes to a
+// fresh draw, so an address that runs no node cannot stall the chain.
+func SelectProposer(chain []*Block, params NetworkParams) (string, error) {
+	return selectProposerAt(chain, params, time.Now().UnixNano())
+}
+
+// selectProposerAt is SelectProposer for a block sealed at timestamp.
+func selectProposerAt(chain []*Block, params NetworkParams, timestamp int64) (string, error) {
+	if len(chain) == 0 {
+		return "", errors.New("select proposer: empty chain")
+	}
+	height := len(chain)
+	round := proposerRound(chain[height-1].Timestamp, timestamp, params.At(height))
+	return selectProposer(chainBalances(chain), proposerSeed(chain, height, round), params)
+}
+
+// proposerRound is how many times the slot of a block sealed at timestamp
+// has passed on since the block before it, sealed at previous.
+func proposerRound(previous, timestamp int64, params NetworkParams) uint64 {
+	if params.ProposerTimeout <= 0 || timestamp <= previous {
+		return 0
+	}
+	return uint64((timestamp - previous) / int64(params.ProposerTimeout))
+}
+
+// proposerSeed seeds the draw for the block at height in round. It commits
+// to the chain below the block at height-1, which that block's proposer
+// cannot change.
+func proposerSeed(chain []*Block, height int, round uint64) [32]byte {
+	var seed [48]byte
+	previous := chain[height-1].PreviousHash
+	copy(seed[:32], previous[:])
+	binary.BigEndian.PutUint64(seed[32:40], uint64(height))
+	binary.BigEndian.PutUint64(seed[40:], round)
+	return sha256.Sum256(seed[:])
+}
+
+func selectProposer(balances map[string]Amount, seed [32]byte, params NetworkParams) (string, error) {
+	addresses := make([]string, 0, len(balances))
+	var total float64
+	for addr, stake := range balances {
+		if stake > 0 && !params.isCoinbase(addr) {
+			addresses = append(addresses, addr)
+			total += float64(stake)
+		}
+	}
+	if total == 0 {
+		return "", errors.New("no address holds stake")
+	}
+	sort.Strings(addresses)
+
+	h := sha256.Sum256(seed[:])
+	target := float64(binary.BigEndian.Uint64(h[:8])) / (1 << 64) * total
+	var cumulative float64
+	for _, addr := range addresses {
+		cumulative += float64(balances[addr])
+		if target < cumulative {
+			return addr, nil
+		}
+	}
+	return addresses[len(addresses)-1], nil
+}
+
+// proposeBlock seals a block paying rewardAddress with the proposer key if
+// this node is the selected proposer for the next height. The caller must
+// hold bc.mux.
+func (bc *Blockchain) proposeBlock(rewardAddress string) bool {
+	bc.addCoinbase(bc.params.At(len(bc.Chain)), rewardAddress)
+	block := bc.newBlock(0, bc.lastBlock().Hash())
+	// The slot depends on the timestamp the block ends up with.
+	proposer, err := selectProposerAt(bc.Chain, bc.params, block.Timestamp)
+	if err != nil {
+		bc.logger.Warn("select proposer failed", "err", err)
+		bc.TransactionPool = bc.TransactionPool[1:]
+		return false
+	}
+	if proposer != bc.BlockChainAddress || bc.proposerKey == nil {
+		bc.logger.Debug("not the proposer", "height", len(bc.Chain), "proposer", proposer)
+		bc.TransactionPool = bc.TransactionPool[1:]
+		return false
+	}
+	if err := signBlock(block, bc.BlockChainAddress, bc.proposerKey); err != nil {
+		bc.logger.Error("sign block failed", "err", err)
+		bc.TransactionPool = bc.TransactionPool[1:]
+		return false
+	}
+	bc.appendBlock(block)
+	return true
+}
+
+// sealHash is the digest the proposer signs: the block without its
+// signature.
+func (b *Block) sealHash() [32]byte {
+	unsigned := &Block{
+		Version:           b.Version,
+		Nonce:             b.Nonce,
+		PreviousHash:      b.PreviousHash,
+		Timestamp:         b.Timestamp,
+		Transactions:      b.Transactions,
+		Proposer:          b.Proposer,
+		ProposerPublicKey: b.ProposerPublicKey,
+		Height:            b.Height,
+		MerkleRoot:        b.MerkleRoot,
+	}
+	m, _ := json.Marshal(unsigned)
+	return sha256.Sum256(m)
+}
+
+func signBlock(b *Block, proposer string, privateKey *ecdsa.PrivateKey) error {
+	b.Proposer = proposer
+	b.ProposerPublicKey = fmt.Sprintf("%064x%064x", privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes())
+	h := b.sealHash()
+	r, s, err := ecdsa.Sign(rand.Reader, privateKey, h[:])
+	if err != nil {
+		return err
+	}
+	b.ProposerSignature = (&utils.Signature{R: r, S: s}).String()
+	b.invalidateHash()
+	return nil
+}
+
+func verifyProposerSignature(b *Block) error {
+	publicKey, err := utils.ParsePublicKey(b.ProposerPublicKey)
+	if err != nil {
+		return fmt.Errorf("proposer: %v", err)
+	}
+	if utils.AddressFromPublicKey(publicKey) != b.Proposer {
+		return errors.New("proposer public key does not match proposer address")
+	}
+	signature, err := utils.ParseSignature(b.ProposerSignature)
+	if err != nil {
+		return fmt.Errorf("proposer: %v", err)
+	}
+	h := b.sealHash()
+	if !ecdsa.Verify(publicKey, h[:], signature.R, signature.S) {
+		return errors.New("invalid proposer signature")
+	}
+	return nil
+}
+
+// verifyProposers checks that every block after genesis whose height runs
+// under proof of stake was proposed by the address selected from the
+// balances before it, in the round its timestamp falls in.
+func verifyProposers(chain []*Block, params NetworkParams) error {
+	balances := make(map[string]Amount)
+	applyBlock(balances, chain[0])
+	for i := 1; i < len(chain); i++ {
+		if params.At(i).Consensus != CONSENSUS_POS {
+			applyBlock(balances, chain[i])
+			continue
+		}
+		round := proposerRound(chain[i-1].Timestamp, chain[i].Timestamp, params.At(i))
+		want, err := selectProposer(balances, proposerSeed(chain, i, round), params)
+		if err != nil {
+			return verifyErrorf(i, "%v", err)
+		}
+		if chain[i].Proposer != want {
+			return verifyErrorf(i, "proposer %q is not eligible, want %q", chain[i].Proposer, want)
+		}
+		applyBlock(balances, chain[i])
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package block
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+// newPOSBlockchain returns a proof-of-stake node for keys[0] on a chain whose
+// genesis stakes 100 coins to each of keys.
+func newPOSBlockchain(t testing.TB, keys ...testKey) *Blockchain {
+	t.Helper()
+	cfg := GenesisConfig{Timestamp: time.Now().Add(-time.Hour).UnixNano()}
+	for _, k := range keys {
+		cfg.Allocations = append(cfg.Allocations, GenesisAllocation{Address: k.address, Amount: 100 * COIN})
+	}
+	bc := NewBlockchainWithGenesis(keys[0].address, 0, NewGenesisBlock(cfg))
+	bc.SetLogger(NewLogger(io.Discard, LOG_ERROR, LOG_FORMAT_TEXT))
+	params := bc.Params()
+	params.Consensus = CONSENSUS_POS
+	bc.SetParams(params)
+	bc.SetProposerKey(keys[0].private)
+	return bc
+}
+
+// sealedBy returns a block on top of chain sealed at timestamp by k, whether
+// or not k is eligible.
+func sealedBy(t testing.TB, chain []*Block, k testKey, timestamp int64) *Block {
+	t.Helper()
+	b := newBlock(0, chain[len(chain)-1].Hash(), []*Transaction{NewTransaction(MINING_SENDER, k.address, MINING_REWARD)})
+	b.Height = len(chain)
+	b.Timestamp = timestamp
+	if err := signBlock(b, k.address, k.private); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestProofOfStakeEligibleProposer(t *testing.T) {
+	alice := newTestKey(t)
+	bc := newPOSBlockchain(t, alice)
+	mineBlocks(t, bc, 3)
+	if got := bc.LastBlock().Proposer; got != alice.address {
+		t.Fatalf("proposer %s, want %s", got, alice.address)
+	}
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProofOfStakeIneligibleProposer(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newPOSBlockchain(t, alice)
+	params := bc.Params()
+
+	// Bob holds no stake, so his node never proposes.
+	node := NewBlockchainWithGenesis(bob.address, 0, bc.Chain[0])
+	node.SetLogger(NewLogger(io.Discard, LOG_ERROR, LOG_FORMAT_TEXT))
+	node.SetParams(params)
+	node.SetProposerKey(bob.private)
+	if node.Mining() {
+		t.Fatal("a proposer without stake sealed a block")
+	}
+
+	now := time.Now().UnixNano()
+	forged := sealedBy(t, bc.Chain, bob, now)
+	if err := VerifyChain(append(bc.Chain[:1:1], forged), bc.Chain[0].Hash(), params); err == nil {
+		t.Fatal("a block sealed by an ineligible proposer passed verification")
+	}
+
+	// Claiming the eligible proposer does not help without its key.
+	forged.Proposer = alice.address
+	forged.invalidateHash()
+	if err := VerifyChain(append(bc.Chain[:1:1], forged), bc.Chain[0].Hash(), params); err == nil {
+		t.Fatal("a block signed by the wrong key passed verification")
+	}
+	if err := VerifyChain(append(bc.Chain[:1:1], sealedBy(t, bc.Chain, alice, now)), bc.Chain[0].Hash(), params); err != nil {
+		t.Fatalf("a block sealed by the eligible proposer: %v", err)
+	}
+}
+
+// TestProposerSeedIgnoresSignature re-signs the tip, which changes its hash.
+// The draw for the next slot must not change with it.
+func TestProposerSeedIgnoresSignature(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newPOSBlockchain(t, alice, bob, carol)
+	params := bc.Params()
+	now := time.Now().UnixNano()
+	tip := sealedBy(t, bc.Chain, alice, now)
+	chain := append(bc.Chain[:1:1], tip)
+
+	want, err := selectProposerAt(chain, params, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		hash := tip.Hash()
+		if err := signBlock(tip, alice.address, alice.private); err != nil {
+			t.Fatal(err)
+		}
+		if tip.Hash() == hash {
+			t.Fatal("re-signing did not change the tip hash")
+		}
+		if got, _ := selectProposerAt(chain, params, now); got != want {
+			t.Fatalf("re-signing the tip moved the next slot from %s to %s", want, got)
+		}
+	}
+}
+
+// TestProposerSlotPassesOnAfterTimeout checks that once ProposerTimeout
+// passes without a block, the slot goes to a fresh draw, and that a block is
+// held to the draw of the round its timestamp falls in.
+func TestProposerSlotPassesOnAfterTimeout(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newPOSBlockchain(t, alice, bob)
+	params := bc.Params()
+	genesis := bc.Chain[0]
+
+	rounds := make(map[string]int64)
+	for r := int64(0); r < 64 && len(rounds) < 2; r++ {
+		ts := genesis.Timestamp + r*int64(params.ProposerTimeout) + 1
+		proposer, err := selectProposerAt(bc.Chain, params, ts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := rounds[proposer]; !ok {
+			rounds[proposer] = ts
+		}
+	}
+	if len(rounds) != 2 {
+		t.Fatal("the slot never passed to the other staker")
+	}
+
+	for _, k := range []testKey{alice, bob} {
+		other := alice
+		if k == alice {
+			other = bob
+		}
+		if err := verifyProposers([]*Block{genesis, sealedBy(t, bc.Chain, k, rounds[k.address])}, params); err != nil {
+			t.Errorf("%s in its own round: %v", k.address, err)
+		}
+		if err := verifyProposers([]*Block{genesis, sealedBy(t, bc.Chain, k, rounds[other.address])}, params); err == nil {
+			t.Errorf("%s accepted in the other staker's round", k.address)
+		}
+	}
+
+	params.ProposerTimeout = 0
+	late := genesis.Timestamp + 10*int64(PROPOSER_TIMEOUT)
+	first, _ := selectProposerAt(bc.Chain, params, genesis.Timestamp+1)
+	if got, _ := selectProposerAt(bc.Chain, params, late); got != first {
+		t.Fatalf("without a timeout the slot passed from %s to %s", first, got)
+	}
+}
+
+func TestSelectProposerEmptyChain(t *testing.T) {
+	if _, err := SelectProposer(nil, DefaultNetworkParams()); err == nil {
+		t.Fatal("no error for an empty chain")
+	}
+}
@@ -0,0 +1,121 @@
+package block
+
+import (
+	"math"
+	"time"
+)
+
+// ExpectedHashes is the average number of attempts needed to find a nonce
+// whose hex hash starts with difficulty zero characters (16^difficulty).
+func ExpectedHashes(difficulty int) float64 {
+	return ExpectedHashesBits(4 * difficulty)
+}
+
+// ExpectedHashesBits is the average number of attempts needed to find a hash
+// with bits leading zero bits (2^bits).
+func ExpectedHashesBits(bits int) float64 {
+	if bits <= 0 {
+		return 1
+	}
+	return math.Pow(2, float64(bits))
+}
+
+// estimateHashRate derives hashes per second from the difficulty and the
+// average interval between the last few blocks.
+func estimateHashRate(chain []*Block, difficulty int) float64 {
+	n := len(chain) - 1
+	if n > STATS_RECENT_BLOCKS {
+		n = STATS_RECENT_BLOCKS
+	}
+	if n < 1 {
+		return 0
+	}
+	first := chain[len(chain)-1-n].Timestamp
+	last := chain[len(chain)-1].Timestamp
+	seconds := float64(last-first) / 1e9 / float64(n)
+	if seconds <= 0 {
+		return 0
+	}
+	return ExpectedHashes(difficulty) / seconds
+}
+
+const (
+	DIFFICULTY_RETARGET_WINDOW = 10
+	MIN_DIFFICULTY             = 1
+	MAX_DIFFICULTY             = 8
+)
+
+// AdjustDifficulty retargets Difficulty for the next block from the recent
+// block intervals and returns it. It runs after every block is added; with
+// no TargetBlockInterval set it just follows the params.
+func (bc *Blockchain) AdjustDifficulty() int {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.syncDifficulty()
+	return bc.Difficulty
+}
+
+// chainDifficulties returns the difficulty required at each height of chain
+// and, as the last element, at the height after it. Every node derives the
+// same values from the same chain, so retargeting stays consensus-safe.
+func chainDifficulties(chain []*Block, params NetworkParams) []int {
+	difficulties := make([]int, len(chain)+1)
+	for h := 1; h <= len(chain); h++ {
+		p := params.At(h)
+		difficulties[h] = p.Difficulty
+		if p.TargetBlockInterval > 0 && p.RetargetWindow > 0 && h > p.RetargetWindow {
+			difficulties[h] = retarget(difficulties[h-1], chain[h-p.RetargetWindow-1:h], p.TargetBlockInterval)
+		}
+	}
+	return difficulties
+}
+
+// retarget steps difficulty up when blocks arrive in under half the target
+// interval on average and down when they take over twice as long. Each step
+// changes the work by a factor of 16, hence the wide band.
+func retarget(difficulty int, window []*Block, target time.Duration) int {
+	intervals := int64(len(window) - 1)
+	average := time.Duration((window[len(window)-1].Timestamp - window[0].Timestamp) / intervals)
+	switch {
+	case average < target/2:
+		difficulty++
+	case average > target*2:
+		difficulty--
+	}
+	return clampDifficulty(difficulty)
+}
+
+// clampDifficulty brings difficulty into MIN_DIFFICULTY..MAX_DIFFICULTY.
+func clampDifficulty(difficulty int) int {
+	if difficulty < MIN_DIFFICULTY {
+		return MIN_DIFFICULTY
+	}
+	if difficulty > MAX_DIFFICULTY {
+		return MAX_DIFFICULTY
+	}
+	return difficulty
+}
+
+// clampParamsDifficulty clamps the difficulty of params and of each
+// scheduled change, warning about any value out of range. The schedule is
+// copied rather than changed in place.
+func (bc *Blockchain) clampParamsDifficulty(params NetworkParams) NetworkParams {
+	params.Difficulty = bc.clampedDifficulty(params.Difficulty)
+	if params.Schedule != nil {
+		schedule := make(ParamSchedule, len(params.Schedule))
+		for h, p := range params.Schedule {
+			p.Difficulty = bc.clampedDifficulty(p.Difficulty)
+			schedule[h] = p
+		}
+		params.Schedule = schedule
+	}
+	return params
+}
+
+func (bc *Blockchain) clampedDifficulty(difficulty int) int {
+	clamped := clampDifficulty(difficulty)
+	if clamped != difficulty {
+		bc.logger.Warn("difficulty out of range", "difficulty", difficulty, "clamped", clamped, "min", MIN_DIFFICULTY, "max", MAX_DIFFICULTY)
+	}
+	return clamped
+}
@@ -0,0 +1,82 @@
+package block
+
+import "testing"
+
+func TestDifficultyIsKeptInRange(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	tests := []struct {
+		set, want int
+	}{
+		{-5, MIN_DIFFICULTY},
+		{0, MIN_DIFFICULTY},
+		{MIN_DIFFICULTY, MIN_DIFFICULTY},
+		{2, 2},
+		{MAX_DIFFICULTY, MAX_DIFFICULTY},
+		{MAX_DIFFICULTY + 1, MAX_DIFFICULTY},
+		{1000, MAX_DIFFICULTY},
+	}
+	for _, tt := range tests {
+		bc.SetDifficulty(tt.set)
+		if got := bc.GetDifficulty(); got != tt.want {
+			t.Errorf("SetDifficulty(%d): difficulty %d, want %d", tt.set, got, tt.want)
+		}
+
+		params := bc.Params()
+		params.Difficulty = tt.set
+		params.Schedule = ParamSchedule{100: params}
+		bc.SetParams(params)
+		got := bc.Params()
+		if got.Difficulty != tt.want || got.Schedule[100].Difficulty != tt.want {
+			t.Errorf("SetParams with difficulty %d: got %d and scheduled %d, want %d", tt.set, got.Difficulty, got.Schedule[100].Difficulty, tt.want)
+		}
+		if params.Schedule[100].Difficulty != tt.set {
+			t.Errorf("SetParams changed the caller's schedule")
+		}
+	}
+
+	// A negative difficulty used to make validProof panic.
+	previousHash := (&Block{}).Hash()
+	for _, difficulty := range []int{-1, 0, MAX_DIFFICULTY + 1} {
+		for nonce := 0; nonce < 100; nonce++ {
+			if validProof(nonce, previousHash, nil, difficulty) {
+				t.Fatalf("nonce %d valid at out-of-range difficulty %d", nonce, difficulty)
+			}
+		}
+	}
+}
+
+func TestExpectedHashes(t *testing.T) {
+	for _, tt := range []struct {
+		difficulty int
+		want       float64
+	}{
+		{0, 1},
+		{1, 16},
+		{2, 256},
+		{3, 4096},
+	} {
+		if got := ExpectedHashes(tt.difficulty); got != tt.want {
+			t.Errorf("ExpectedHashes(%d) = %v, want %v", tt.difficulty, got, tt.want)
+		}
+		if got := ExpectedHashesBits(4 * tt.difficulty); got != tt.want {
+			t.Errorf("ExpectedHashesBits(%d) = %v, want %v", 4*tt.difficulty, got, tt.want)
+		}
+	}
+	if got := ExpectedHashesBits(1); got != 2 {
+		t.Errorf("ExpectedHashesBits(1) = %v, want 2", got)
+	}
+	if got := ExpectedHashesBits(-3); got != 1 {
+		t.Errorf("ExpectedHashesBits(-3) = %v, want 1", got)
+	}
+}
+
+func TestEstimateHashRateUsesExpectedHashes(t *testing.T) {
+	chain := []*Block{{Timestamp: 0}, {Timestamp: 2e9}, {Timestamp: 4e9}}
+	if got, want := estimateHashRate(chain, 2), ExpectedHashes(2)/2; got != want {
+		t.Fatalf("hash rate %v, want %v", got, want)
+	}
+	if got := estimateHashRate(chain[:1], 2); got != 0 {
+		t.Fatalf("hash rate of a lone genesis %v, want 0", got)
+	}
+}
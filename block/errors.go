@@ -0,0 +1,28 @@
+package block
+
+import "errors"
+
+var (
+	ErrInsufficientBalance   = errors.New("insufficient balance")
+	ErrInvalidSignature      = errors.New("invalid transaction signature")
+	ErrSenderKeyMismatch     = errors.New("public key does not belong to sender")
+	ErrNegativeFee           = errors.New("negative transaction fee")
+	ErrNegativeValue         = errors.New("negative transaction value")
+	ErrAmountOverflow        = errors.New("transaction value and fee overflow")
+	ErrReservedSender        = errors.New("sender address is reserved")
+	ErrTooManyPending        = errors.New("too many pending transactions from sender")
+	ErrTransactionCycle      = errors.New("transaction closes a zero-sum cycle")
+	ErrInvalidAddress        = errors.New("invalid blockchain address")
+	ErrStaleNonce            = errors.New("transaction nonce already used")
+	ErrMissingNonce          = errors.New("transaction carries no nonce")
+	ErrReplayedTransaction   = errors.New("transaction without a nonce is already confirmed")
+	ErrNonceGapQueueFull     = errors.New("too many transactions waiting on a nonce gap")
+	ErrSenderNotPermitted    = errors.New("sender is not permitted to transact")
+	ErrTransactionNotFound   = errors.New("transaction not found in chain")
+	ErrBlockNotFound         = errors.New("block not found in chain")
+	ErrUnknownRecentBlock    = errors.New("transaction references a block not in the chain")
+	ErrStaleRecentBlock      = errors.New("transaction references a block too far from the tip")
+	ErrMissingRecentBlock    = errors.New("transaction does not reference a recent block")
+	ErrInvalidPeerAddress    = errors.New("peer address must be host:port")
+	ErrTooManyAnnouncedPeers = errors.New("too many announced peers")
+)
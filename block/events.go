@@ -0,0 +1,45 @@
+package block
+
+// SUBSCRIBER_BUFFER is how many blocks a subscriber may fall behind before
+// further blocks are dropped for it.
+const SUBSCRIBER_BUFFER = 16
+
+// Subscribe returns a channel that receives every block joining the chain,
+// whether mined here or adopted from a neighbour; after a reorg it receives
+// the new branch from the fork point on. Delivery never blocks the
+// chain: a subscriber that falls more than SUBSCRIBER_BUFFER blocks behind
+// misses blocks until it catches up.
+func (bc *Blockchain) Subscribe() <-chan *Block {
+	bc.subscribersMux.Lock()
+	defer bc.subscribersMux.Unlock()
+	if bc.subscribers == nil {
+		bc.subscribers = make(map[<-chan *Block]chan *Block)
+	}
+	ch := make(chan *Block, SUBSCRIBER_BUFFER)
+	bc.subscribers[ch] = ch
+	return ch
+}
+
+// Unsubscribe stops delivery to ch and closes it.
+func (bc *Blockchain) Unsubscribe(ch <-chan *Block) {
+	bc.subscribersMux.Lock()
+	defer bc.subscribersMux.Unlock()
+	if c, ok := bc.subscribers[ch]; ok {
+		delete(bc.subscribers, ch)
+		close(c)
+	}
+}
+
+func (bc *Blockchain) publish(blocks ...*Block) {
+	bc.subscribersMux.Lock()
+	defer bc.subscribersMux.Unlock()
+	for _, c := range bc.subscribers {
+		for _, b := range blocks {
+			select {
+			case c <- b:
+			default:
+				bc.logger.Debug("subscriber lagging, block dropped", "height", b.Height)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package block
+
+import "testing"
+
+func TestSubscribe(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	ch := bc.Subscribe()
+	mineBlocks(t, bc, 2)
+	for height := 1; height <= 2; height++ {
+		select {
+		case b := <-ch:
+			if b != bc.Chain[height] {
+				t.Fatalf("received block %d, want block %d", b.Height, height)
+			}
+		default:
+			t.Fatalf("block %d was not delivered", height)
+		}
+	}
+
+	// A subscriber that never reads must not hold up mining.
+	lagging := bc.Subscribe()
+	mineBlocks(t, bc, SUBSCRIBER_BUFFER+1)
+	if n := len(lagging); n != SUBSCRIBER_BUFFER {
+		t.Fatalf("lagging subscriber holds %d blocks, want %d", n, SUBSCRIBER_BUFFER)
+	}
+
+	// Unsubscribing closes the channel, and doing it twice is harmless.
+	bc.Unsubscribe(ch)
+	for range ch {
+	}
+	bc.Unsubscribe(ch)
+	mineBlocks(t, bc, 1)
+}
@@ -0,0 +1,49 @@
+package block
+
+import "time"
+
+const MEMPOOL_MAX_AGE = 24 * time.Hour
+
+// SetMempoolMaxAge sets how long a transaction may wait in the pool before
+// it is dropped. Zero keeps transactions until they are mined or can no
+// longer be funded.
+func (bc *Blockchain) SetMempoolMaxAge(d time.Duration) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.mempoolMaxAge = d
+}
+
+// PruneMempool drops, and returns, the pooled transactions that entered the
+// pool more than maxAge ago. Later nonces of their senders no longer follow
+// on and are dropped when the pool is next checked for mining. Mining and
+// Compact prune with the configured max age.
+func (bc *Blockchain) PruneMempool(maxAge time.Duration) []*Transaction {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.expirePool(time.Now(), maxAge)
+}
+
+// expirePool drops the transactions pooled before now-maxAge. The caller
+// must hold bc.mux.
+func (bc *Blockchain) expirePool(now time.Time, maxAge time.Duration) []*Transaction {
+	if maxAge <= 0 {
+		return nil
+	}
+	var expired []*Transaction
+	kept := bc.TransactionPool[:0]
+	for _, t := range bc.TransactionPool {
+		if !t.pooledAt.IsZero() && now.Sub(t.pooledAt) > maxAge {
+			expired = append(expired, t)
+			continue
+		}
+		kept = append(kept, t)
+	}
+	for i := len(kept); i < len(bc.TransactionPool); i++ {
+		bc.TransactionPool[i] = nil
+	}
+	bc.TransactionPool = kept
+	if len(expired) > 0 {
+		bc.logger.Info("expired pooled transactions", "action", "expire_pool", "count", len(expired), "max_age", maxAge)
+	}
+	return expired
+}
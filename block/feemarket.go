@@ -0,0 +1,59 @@
+package block
+
+import "sort"
+
+// FeeMarketInfo summarizes the fees on offer. The pending fields are zero
+// when the pool is empty, and MinRecentFee is only meaningful when
+// HasRecentFees is set.
+type FeeMarketInfo struct {
+	PendingCount     int    `json:"pendingCount"`
+	MinPendingFee    Amount `json:"minPendingFee"`
+	MedianPendingFee Amount `json:"medianPendingFee"`
+	MaxPendingFee    Amount `json:"maxPendingFee"`
+	HasRecentFees    bool   `json:"hasRecentFees"`
+	MinRecentFee     Amount `json:"minRecentFee"`
+}
+
+// FeeMarket reports the fee spread of the pool and the lowest fee accepted
+// into the last STATS_RECENT_BLOCKS blocks, so a client can pick a fee that
+// competes.
+func (bc *Blockchain) FeeMarket() FeeMarketInfo {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+
+	var info FeeMarketInfo
+	fees := make([]Amount, 0, len(bc.TransactionPool))
+	for _, t := range bc.TransactionPool {
+		if !bc.params.isCoinbase(t.SenderBlockchainAddress) {
+			fees = append(fees, t.Fee)
+		}
+	}
+	if len(fees) > 0 {
+		sort.Slice(fees, func(i, j int) bool { return fees[i] < fees[j] })
+		info.PendingCount = len(fees)
+		info.MinPendingFee = fees[0]
+		info.MaxPendingFee = fees[len(fees)-1]
+		if len(fees)%2 == 1 {
+			info.MedianPendingFee = fees[len(fees)/2]
+		} else {
+			info.MedianPendingFee = (fees[len(fees)/2-1] + fees[len(fees)/2]) / 2
+		}
+	}
+
+	start := len(bc.Chain) - STATS_RECENT_BLOCKS
+	if start < 1 {
+		start = 1
+	}
+	for _, b := range bc.Chain[start:] {
+		for _, t := range b.Transactions {
+			if bc.params.isCoinbase(t.SenderBlockchainAddress) {
+				continue
+			}
+			if !info.HasRecentFees || t.Fee < info.MinRecentFee {
+				info.MinRecentFee = t.Fee
+			}
+			info.HasRecentFees = true
+		}
+	}
+	return info
+}
@@ -0,0 +1,38 @@
+package block
+
+import "testing"
+
+func TestFeeMarket(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	if info := bc.FeeMarket(); info != (FeeMarketInfo{}) {
+		t.Fatalf("empty chain and pool: %+v", info)
+	}
+
+	keys := fundedKeys(t, bc, 2)
+	pay := func(fee Amount) {
+		t.Helper()
+		tx := NewTransaction(keys[0].address, keys[1].address, COIN/100)
+		tx.Fee = fee
+		if err := bc.AddSignedTransactionE(tx, &keys[0].private.PublicKey, keys[0].sign(t, tx)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pay(5)
+	pay(3)
+	mineBlocks(t, bc, 1)
+	for _, fee := range []Amount{10, 1, 6, 4} {
+		pay(fee)
+	}
+
+	want := FeeMarketInfo{
+		PendingCount:     4,
+		MinPendingFee:    1,
+		MedianPendingFee: 5,
+		MaxPendingFee:    10,
+		HasRecentFees:    true,
+		MinRecentFee:     3,
+	}
+	if info := bc.FeeMarket(); info != want {
+		t.Fatalf("got %+v, want %+v", info, want)
+	}
+}
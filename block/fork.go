@@ -0,0 +1,98 @@
+package block
+
+// ForkPoint returns the highest height at which the local chain and other
+// hold the same block. found is false when they share no block, not even
+// the genesis.
+func (bc *Blockchain) ForkPoint(other []*Block) (height int, found bool) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return forkPoint(bc.Chain, other)
+}
+
+func forkPoint(a, b []*Block) (int, bool) {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	// Block hashes commit to their parents, so a match at some height means
+	// every height below matches too and the fork point can be bisected.
+	lo, hi := 0, n
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if a[mid].Hash() == b[mid].Hash() {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo - 1, lo > 0
+}
+
+// reinstateOrphans re-admits to the pool the transactions of orphaned, the
+// blocks a reorg dropped, that adopted, the blocks replacing them, does not
+// also hold. Those that no longer pass admission, for instance because the
+// new chain already spends the funds, are dropped. The caller must hold
+// bc.mux.
+func (bc *Blockchain) reinstateOrphans(orphaned, adopted []*Block) {
+	kept := make(map[[32]byte]bool)
+	for _, b := range adopted {
+		for _, t := range b.Transactions {
+			kept[t.ID()] = true
+		}
+	}
+	reinstated := 0
+	for _, b := range orphaned {
+		for _, t := range b.Transactions {
+			if bc.params.isCoinbase(t.SenderBlockchainAddress) || kept[t.ID()] {
+				continue
+			}
+			publicKey, signature, err := parseStoredSignature(t)
+			if err == nil {
+				err = bc.addTransaction(t, publicKey, signature)
+			}
+			if err != nil {
+				bc.logger.Debug("dropped orphaned transaction", "sender", t.SenderBlockchainAddress, "err", err)
+				continue
+			}
+			reinstated++
+		}
+	}
+	if reinstated > 0 {
+		bc.logger.Info("reinstated orphaned transactions", "action", "reorg", "count", reinstated)
+	}
+}
+
+// dropConfirmed removes from the pool and the nonce gap queue the
+// transactions that adopted, the blocks a reorg brought in, already
+// confirm, so they are not mined a second time. The caller must hold
+// bc.mux.
+func (bc *Blockchain) dropConfirmed(adopted []*Block) {
+	confirmed := make(map[[32]byte]bool)
+	for _, b := range adopted {
+		for _, t := range b.Transactions {
+			confirmed[t.ID()] = true
+		}
+	}
+	pool := []*Transaction{}
+	for _, t := range bc.TransactionPool {
+		if !confirmed[t.ID()] {
+			pool = append(pool, t)
+		}
+	}
+	dropped := len(bc.TransactionPool) - len(pool)
+	bc.TransactionPool = pool
+	for sender, queue := range bc.gapped {
+		for nonce, g := range queue {
+			if confirmed[g.transaction.ID()] {
+				delete(queue, nonce)
+				dropped++
+			}
+		}
+		if len(queue) == 0 {
+			delete(bc.gapped, sender)
+		}
+	}
+	if dropped > 0 {
+		bc.logger.Info("dropped transactions confirmed by the new chain", "action", "reorg", "count", dropped)
+	}
+}
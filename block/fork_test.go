@@ -0,0 +1,27 @@
+package block
+
+import "testing"
+
+func TestForkPoint(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 3)
+	fork := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, fork, 2)
+	mineBlocks(t, bc, 1)
+
+	if height, found := bc.ForkPoint(fork.Chain); !found || height != 3 {
+		t.Fatalf("fork point %d, %v; want 3, true", height, found)
+	}
+	if height, found := bc.ForkPoint(bc.Chain[:2]); !found || height != 1 {
+		t.Fatalf("fork point with own prefix %d, %v; want 1, true", height, found)
+	}
+	other := newTestBlockchain(t, bob.address)
+	mineBlocks(t, other, 1)
+	if _, found := bc.ForkPoint(other.Chain); found {
+		t.Fatal("found a fork point with an unrelated chain")
+	}
+	if _, found := bc.ForkPoint(nil); found {
+		t.Fatal("found a fork point with an empty chain")
+	}
+}
@@ -0,0 +1,65 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+const GENESIS_SENDER = "THE GENESIS"
+
+type GenesisAllocation struct {
+	Address string `json:"address"`
+	Amount  Amount `json:"amount"`
+}
+
+// GenesisConfig describes a genesis block that every node of a network
+// builds identically: a fixed timestamp and a list of premined balances.
+type GenesisConfig struct {
+	Timestamp   int64               `json:"timestamp"`
+	Allocations []GenesisAllocation `json:"allocations"`
+}
+
+// LoadGenesisConfig reads a GenesisConfig from the JSON file at path.
+func LoadGenesisConfig(path string) (GenesisConfig, error) {
+	var cfg GenesisConfig
+	m, err := ioutil.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(m, &cfg); err != nil {
+		return cfg, fmt.Errorf("load genesis: %v", err)
+	}
+	return cfg, nil
+}
+
+// NewGenesisBlock materializes cfg as a block whose transactions pay each
+// allocation from GENESIS_SENDER. Such transactions are only valid here.
+func NewGenesisBlock(cfg GenesisConfig) *Block {
+	transactions := make([]*Transaction, 0, len(cfg.Allocations))
+	for _, a := range cfg.Allocations {
+		transactions = append(transactions, NewTransaction(GENESIS_SENDER, a.Address, a.Amount))
+	}
+	b := &Block{}
+	return &Block{
+		PreviousHash: b.Hash(),
+		Timestamp:    cfg.Timestamp,
+		Transactions: transactions,
+	}
+}
+
+// NewBlockchainWithGenesis starts a chain from genesis instead of an empty
+// block. Chains received from neighbours must share the same genesis.
+func NewBlockchainWithGenesis(blockChainAddress string, port uint16, genesis *Block) *Blockchain {
+	bc := newBlockchain(blockChainAddress, port)
+	bc.Chain = []*Block{genesis}
+	bc.syncDifficulty()
+	bc.genesisHash = genesis.Hash()
+	bc.totalTransactions = len(genesis.Transactions)
+	applyBlock(bc.balanceIndex, genesis)
+	return bc
+}
+
+func isCoinbaseSender(sender string, miningSender string) bool {
+	return sender == miningSender || sender == GENESIS_SENDER
+}
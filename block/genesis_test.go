@@ -0,0 +1,56 @@
+package block
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPremine(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	genesis := NewGenesisBlock(GenesisConfig{
+		Timestamp: time.Now().Add(-time.Hour).UnixNano(),
+		Allocations: []GenesisAllocation{
+			{Address: alice.address, Amount: 50 * COIN},
+			{Address: bob.address, Amount: 25 * COIN},
+		},
+	})
+	bc := NewBlockchainWithGenesis(carol.address, 0, genesis)
+	bc.SetLogger(NewLogger(io.Discard, LOG_ERROR, LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+
+	for addr, want := range map[string]Amount{alice.address: 50 * COIN, bob.address: 25 * COIN, carol.address: 0} {
+		if got := bc.Balance(addr); got != want {
+			t.Errorf("balance %s, want %s", got, want)
+		}
+		if got := bc.CalculateTotalAmount(addr); got != want {
+			t.Errorf("recomputed balance %s, want %s", got, want)
+		}
+	}
+
+	// Premined funds can be spent.
+	tx := NewTransaction(alice.address, carol.address, 10*COIN)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bc.Balance(carol.address), 10*COIN+MINING_REWARD; got != want {
+		t.Fatalf("carol's balance %s, want %s", got, want)
+	}
+
+	// An allocation anywhere but the genesis block is refused.
+	params := bc.Params()
+	forged := append(cloneChain(t, bc.Chain), nil)
+	forged[len(forged)-1] = sealBlock(forged[:len(forged)-1], []*Transaction{
+		NewTransaction(params.MiningSender(), carol.address, MINING_REWARD),
+		NewTransaction(GENESIS_SENDER, carol.address, 100*COIN),
+	}, params.Difficulty)
+	err := VerifyChain(forged, genesis.Hash(), params)
+	if err == nil || !strings.Contains(err.Error(), "genesis allocation") {
+		t.Fatalf("got %v, want a genesis allocation error", err)
+	}
+}
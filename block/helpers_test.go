@@ -0,0 +1,122 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"goblockchain/utils"
+)
+
+// testKey is a wallet key pair for building signed transactions in tests.
+type testKey struct {
+	private *ecdsa.PrivateKey
+	address string
+}
+
+func newTestKey(t testing.TB) testKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testKey{private: private, address: utils.AddressFromPublicKey(&private.PublicKey)}
+}
+
+func (k testKey) sign(t testing.TB, tx *Transaction) *utils.Signature {
+	t.Helper()
+	h := sha256.Sum256(tx.signedBytes())
+	r, s, err := ecdsa.Sign(rand.Reader, k.private, h[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &utils.Signature{R: r, S: s}
+}
+
+// publicKey returns the public key encoded as transactions carry it.
+func (k testKey) publicKey() string {
+	return fmt.Sprintf("%064x%064x", k.private.PublicKey.X.Bytes(), k.private.PublicKey.Y.Bytes())
+}
+
+// newTestBlockchain returns a quiet chain with only its genesis block that
+// mines its rewards to miner.
+func newTestBlockchain(t testing.TB, miner string) *Blockchain {
+	t.Helper()
+	bc := NewBlockchain(miner, 0)
+	bc.SetLogger(NewLogger(io.Discard, LOG_ERROR, LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+	return bc
+}
+
+// mineBlocks mines n blocks on bc and fails the test if any is not added.
+func mineBlocks(t testing.TB, bc *Blockchain, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if !bc.Mining() {
+			t.Fatalf("mining block %d failed", i+1)
+		}
+	}
+}
+
+// sealBlock builds a block of transactions on chain's tip with a valid proof
+// of work at difficulty, whatever the transactions themselves hold.
+func sealBlock(chain []*Block, transactions []*Transaction, difficulty int) *Block {
+	previousHash := chain[len(chain)-1].Hash()
+	nonce := 0
+	for !validProof(nonce, previousHash, transactions, difficulty) {
+		nonce++
+	}
+	b := newBlock(nonce, previousHash, transactions)
+	b.Height = len(chain)
+	return b
+}
+
+// forkBlockchain returns an independent copy of bc, sharing its blocks up to
+// now, that mines its rewards to miner.
+func forkBlockchain(t testing.TB, bc *Blockchain, miner string) *Blockchain {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fork.json")
+	if err := bc.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+	fork, err := LoadFromFile(path, bc.Params())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fork.BlockChainAddress = miner
+	fork.SetLogger(NewLogger(io.Discard, LOG_ERROR, LOG_FORMAT_TEXT))
+	return fork
+}
+
+// servePeer serves bc's chain at /chain and its tip at /tip like a
+// neighbour's server and returns its host:port. Every other request is
+// answered with 200.
+func servePeer(t testing.TB, bc *Blockchain) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			return
+		}
+		switch req.URL.Path {
+		case "/chain":
+			m, _ := bc.MarshalJSON()
+			w.Header().Add("Content-Type", "application/json")
+			w.Write(m)
+		case "/tip":
+			m, _ := json.Marshal(bc.Tip())
+			w.Header().Add("Content-Type", "application/json")
+			w.Write(m)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return strings.TrimPrefix(ts.URL, "http://")
+}
@@ -0,0 +1,68 @@
+package block
+
+import "time"
+
+const CONFIRMATION_SAMPLES = 100
+
+type confirmationSample struct {
+	dwell  time.Duration
+	blocks int
+}
+
+// SetConfirmationSamples sets how many recently mined transactions the
+// confirmation averages in Stats are taken over. Zero or less stops
+// sampling.
+func (bc *Blockchain) SetConfirmationSamples(n int) {
+	if n < 0 {
+		n = 0
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.confirmationSampleSize = n
+	if len(bc.confirmationSamples) > n {
+		bc.confirmationSamples = bc.confirmationSamples[len(bc.confirmationSamples)-n:]
+	}
+}
+
+// markPooled records when and at which height t entered the pool.
+func (bc *Blockchain) markPooled(t *Transaction) {
+	if t.pooledAt.IsZero() {
+		t.pooledAt = time.Now()
+		t.pooledHeight = len(bc.Chain)
+	}
+}
+
+// sampleConfirmations records how long each pooled transaction in b, mined
+// at height, waited.
+func (bc *Blockchain) sampleConfirmations(b *Block, height int) {
+	if bc.confirmationSampleSize <= 0 {
+		return
+	}
+	minedAt := time.Unix(0, b.Timestamp)
+	for _, t := range b.Transactions {
+		if t.pooledAt.IsZero() {
+			continue
+		}
+		bc.confirmationSamples = append(bc.confirmationSamples, confirmationSample{
+			dwell:  minedAt.Sub(t.pooledAt),
+			blocks: height - t.pooledHeight + 1,
+		})
+	}
+	if n := len(bc.confirmationSamples) - bc.confirmationSampleSize; n > 0 {
+		bc.confirmationSamples = bc.confirmationSamples[n:]
+	}
+}
+
+func (bc *Blockchain) averageConfirmation() (time.Duration, float64) {
+	if len(bc.confirmationSamples) == 0 {
+		return 0, 0
+	}
+	var dwell time.Duration
+	var blocks int
+	for _, s := range bc.confirmationSamples {
+		dwell += s.dwell
+		blocks += s.blocks
+	}
+	n := len(bc.confirmationSamples)
+	return dwell / time.Duration(n), float64(blocks) / float64(n)
+}
@@ -0,0 +1,48 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+// TestConfirmationAverages pools two transactions with known dwell times
+// and pool heights, mines them, and checks the averages Stats reports.
+func TestConfirmationAverages(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+
+	var txs []*Transaction
+	for i := 1; i <= 2; i++ {
+		tx := NewTransaction(alice.address, bob.address, Amount(i))
+		if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+			t.Fatal(err)
+		}
+		txs = append(txs, tx)
+	}
+	now := time.Now()
+	bc.mux.Lock()
+	txs[0].pooledAt, txs[0].pooledHeight = now.Add(-10*time.Second), 3
+	txs[1].pooledAt, txs[1].pooledHeight = now.Add(-20*time.Second), 1
+	bc.mux.Unlock()
+	mineBlocks(t, bc, 1)
+
+	s := bc.Stats()
+	if s.AverageConfirmationBlocks != 2 {
+		t.Fatalf("average confirmation blocks %v, want 2", s.AverageConfirmationBlocks)
+	}
+	if d := s.AverageConfirmationTime; d < 15*time.Second || d > 16*time.Second {
+		t.Fatalf("average confirmation time %v, want about 15s", d)
+	}
+
+	// Shrinking the window keeps the latest sample.
+	bc.SetConfirmationSamples(1)
+	if s := bc.Stats(); s.AverageConfirmationBlocks != 3 || s.AverageConfirmationTime < 20*time.Second {
+		t.Fatalf("latest sample: %v blocks, %v", s.AverageConfirmationBlocks, s.AverageConfirmationTime)
+	}
+
+	bc.SetConfirmationSamples(-1)
+	if s := bc.Stats(); s.AverageConfirmationBlocks != 0 || s.AverageConfirmationTime != 0 {
+		t.Fatalf("without samples: %v blocks, %v", s.AverageConfirmationBlocks, s.AverageConfirmationTime)
+	}
+}
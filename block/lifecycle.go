@@ -0,0 +1,54 @@
+package block
+
+import "time"
+
+// Stop shuts the node's background work down. The mining, neighbour sync,
+// primary following and compaction loops exit, a block being mined is
+// abandoned, and a chain file set up by NewBlockchainFromFile is saved one
+// last time. Calling it again has no effect.
+func (bc *Blockchain) Stop() {
+	stopping := false
+	bc.stopOnce.Do(func() {
+		close(bc.done)
+		stopping = true
+	})
+	if !stopping {
+		return
+	}
+	bc.cancelMining()
+	bc.mux.Lock()
+	bc.persist()
+	bc.mux.Unlock()
+	bc.logger.Info("blockchain stopped")
+}
+
+func (bc *Blockchain) Stopped() bool {
+	select {
+	case <-bc.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// repeat runs fn now, then again interval after each run returns, until the
+// node is stopped.
+func (bc *Blockchain) repeat(interval time.Duration, fn func()) {
+	if bc.Stopped() {
+		return
+	}
+	fn()
+	go func() {
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-bc.done:
+				return
+			case <-timer.C:
+				fn()
+				timer.Reset(interval)
+			}
+		}
+	}()
+}
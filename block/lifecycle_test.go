@@ -0,0 +1,49 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStopBeforeScheduledMine(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+
+	bc.repeat(10*time.Millisecond, func() { bc.Mining() })
+	bc.Stop()
+	length := bc.ChainLength()
+	time.Sleep(50 * time.Millisecond)
+	if got := bc.ChainLength(); got != length {
+		t.Errorf("length after stop = %d, want %d", got, length)
+	}
+
+	if bc.Mining() {
+		t.Error("Mining succeeded on a stopped node")
+	}
+	bc.repeat(time.Millisecond, func() { t.Error("repeat ran after stop") })
+	bc.Stop()
+}
+
+// TestRunThenStop starts the node's loops, which mine a block straight
+// away, then stops it. No further block may be mined, by the loops or on
+// request, and stopping twice is harmless.
+func TestRunThenStop(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	bc.SetNeighbourScan(false)
+	bc.Run()
+	if bc.Stopped() {
+		t.Fatal("stopped before Stop")
+	}
+	bc.Stop()
+	bc.Stop()
+	if !bc.Stopped() {
+		t.Fatal("not stopped after Stop")
+	}
+	length := bc.ChainLength()
+	if length != 2 {
+		t.Fatalf("chain length %d after Run, want 2", length)
+	}
+	if bc.Mining() || bc.ChainLength() != length {
+		t.Fatal("a block was mined after Stop")
+	}
+}
@@ -0,0 +1,166 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logger is a leveled logger taking alternating key/value pairs, e.g.
+// Info("mined block", "height", 12, "duration", d).
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+type LogLevel int
+
+const (
+	LOG_DEBUG LogLevel = iota
+	LOG_INFO
+	LOG_WARN
+	LOG_ERROR
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LOG_DEBUG:
+		return "debug"
+	case LOG_INFO:
+		return "info"
+	case LOG_WARN:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+type LogFormat int
+
+const (
+	LOG_FORMAT_TEXT LogFormat = iota
+	LOG_FORMAT_JSON
+)
+
+type logger struct {
+	mux    sync.Mutex
+	out    io.Writer
+	std    *log.Logger
+	level  LogLevel
+	format LogFormat
+}
+
+// NewLogger writes entries at or above level to w. A nil w writes through
+// the standard log package so its prefix and flags apply.
+func NewLogger(w io.Writer, level LogLevel, format LogFormat) Logger {
+	l := &logger{out: w, level: level, format: format}
+	if w == nil {
+		l.std = log.Default()
+	}
+	return l
+}
+
+func (l *logger) Debug(msg string, keyvals ...interface{}) { l.log(LOG_DEBUG, msg, keyvals) }
+func (l *logger) Info(msg string, keyvals ...interface{})  { l.log(LOG_INFO, msg, keyvals) }
+func (l *logger) Warn(msg string, keyvals ...interface{})  { l.log(LOG_WARN, msg, keyvals) }
+func (l *logger) Error(msg string, keyvals ...interface{}) { l.log(LOG_ERROR, msg, keyvals) }
+
+func (l *logger) log(level LogLevel, msg string, keyvals []interface{}) {
+	if level < l.level {
+		return
+	}
+	var line string
+	if l.format == LOG_FORMAT_JSON {
+		line = l.formatJSON(level, msg, keyvals)
+	} else {
+		line = formatText(level, msg, keyvals)
+	}
+	if l.std != nil {
+		l.std.Println(line)
+		return
+	}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	io.WriteString(l.out, line+"\n")
+}
+
+func (l *logger) formatJSON(level LogLevel, msg string, keyvals []interface{}) string {
+	entry := make(map[string]interface{}, len(keyvals)/2+3)
+	if l.std == nil {
+		entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	entry["level"] = level.String()
+	entry["msg"] = msg
+	for i := 0; i < len(keyvals); i += 2 {
+		entry[logKey(keyvals, i)] = logValue(keyvals, i)
+	}
+	m, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Sprintf(`{"level":"error","msg":"log marshal failed: %v"}`, err)
+	}
+	return string(m)
+}
+
+func formatText(level LogLevel, msg string, keyvals []interface{}) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", strings.ToUpper(level.String()), msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		fmt.Fprintf(&b, ", %s=%v", logKey(keyvals, i), logValue(keyvals, i))
+	}
+	return b.String()
+}
+
+func logKey(keyvals []interface{}, i int) string {
+	return fmt.Sprint(keyvals[i])
+}
+
+func logValue(keyvals []interface{}, i int) interface{} {
+	if i+1 >= len(keyvals) {
+		return "MISSING"
+	}
+	switch v := keyvals[i+1].(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return v
+	}
+}
+
+// SetLogger replaces the logger used by the blockchain.
+func (bc *Blockchain) SetLogger(l Logger) {
+	bc.logger.set(l)
+}
+
+// swapLogger is the node's logger. SetLogger may replace what it writes to
+// while other goroutines log through it.
+type swapLogger struct {
+	mux sync.RWMutex
+	l   Logger
+}
+
+func (s *swapLogger) set(l Logger) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.l = l
+}
+
+func (s *swapLogger) get() Logger {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.l
+}
+
+func (s *swapLogger) Debug(msg string, keyvals ...interface{}) { s.get().Debug(msg, keyvals...) }
+func (s *swapLogger) Info(msg string, keyvals ...interface{})  { s.get().Info(msg, keyvals...) }
+func (s *swapLogger) Warn(msg string, keyvals ...interface{})  { s.get().Warn(msg, keyvals...) }
+func (s *swapLogger) Error(msg string, keyvals ...interface{}) { s.get().Error(msg, keyvals...) }
@@ -0,0 +1,48 @@
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJSONLogger(t *testing.T) {
+	var out bytes.Buffer
+	l := NewLogger(&out, LOG_INFO, LOG_FORMAT_JSON)
+	l.Debug("below the level", "action", "noise")
+	l.Info("mined block", "action", "mining", "height", 3, "duration", 1500*time.Millisecond)
+	l.Warn("fetch chain failed", "peer", "10.0.0.1:5000", "err", errors.New("unexpected status 503"), "dangling")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %q", len(lines), out.String())
+	}
+	var mined, failed map[string]interface{}
+	for i, v := range []*map[string]interface{}{&mined, &failed} {
+		if err := json.Unmarshal([]byte(lines[i]), v); err != nil {
+			t.Fatalf("line %d is not JSON: %v", i+1, err)
+		}
+	}
+	for key, want := range map[string]interface{}{
+		"level": "info", "msg": "mined block", "action": "mining", "height": 3.0, "duration": "1.5s",
+	} {
+		if mined[key] != want {
+			t.Errorf("mined[%q] = %v, want %v", key, mined[key], want)
+		}
+	}
+	if stamp, _ := mined["time"].(string); stamp == "" {
+		t.Error("no time field")
+	} else if _, err := time.Parse(time.RFC3339Nano, stamp); err != nil {
+		t.Errorf("time %v: %v", mined["time"], err)
+	}
+	for key, want := range map[string]interface{}{
+		"level": "warn", "peer": "10.0.0.1:5000", "err": "unexpected status 503", "dangling": "MISSING",
+	} {
+		if failed[key] != want {
+			t.Errorf("failed[%q] = %v, want %v", key, failed[key], want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"goblockchain/utils"
+	"io"
+	"net/http"
+)
+
+// PullMempool fetches the pending transactions of neighbour and adds each
+// one that passes the usual validation to the local pool. It returns how
+// many were accepted.
+func (bc *Blockchain) PullMempool(neighbour string) (int, error) {
+	transactions, err := bc.fetchMempool(neighbour)
+	if err != nil {
+		return 0, err
+	}
+	params := bc.Params()
+	accepted := 0
+	for _, t := range transactions {
+		if params.isCoinbase(t.SenderBlockchainAddress) {
+			continue
+		}
+		publicKey, err := utils.ParsePublicKey(t.SenderPublicKey)
+		if err != nil {
+			bc.rejectTransaction(t, nil, nil, ErrInvalidSignature)
+			continue
+		}
+		signature, err := utils.ParseSignature(t.Signature)
+		if err != nil {
+			bc.rejectTransaction(t, publicKey, nil, ErrInvalidSignature)
+			continue
+		}
+		if bc.AddSignedTransaction(t, publicKey, signature) {
+			accepted++
+		}
+	}
+	bc.logger.Info("pulled mempool", "peer", neighbour, "received", len(transactions), "accepted", accepted)
+	return accepted, nil
+}
+
+// pullNewMempools pulls the mempool of every neighbour it has not pulled
+// from yet, so a fresh node learns pending transactions without waiting for
+// them to be gossiped again.
+func (bc *Blockchain) pullNewMempools() {
+	bc.muxNeighbours.Lock()
+	var fresh []string
+	for _, n := range bc.neighbours {
+		if !bc.mempoolPulled[n] {
+			fresh = append(fresh, n)
+		}
+	}
+	bc.muxNeighbours.Unlock()
+
+	for _, n := range fresh {
+		if _, err := bc.PullMempool(n); err != nil {
+			bc.logger.Warn("pull mempool failed", "peer", n, "err", err)
+			bc.recordPeerFailure(n)
+			continue
+		}
+		bc.recordPeerSuccess(n)
+		bc.muxNeighbours.Lock()
+		bc.mempoolPulled[n] = true
+		bc.muxNeighbours.Unlock()
+	}
+}
+
+func (bc *Blockchain) fetchMempool(neighbour string) ([]*Transaction, error) {
+	client, maxBytes := bc.peerClient()
+	resp, err := client.Get(fmt.Sprintf("http://%s/transactions", neighbour))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("response larger than %d bytes", maxBytes)
+	}
+	var pool struct {
+		Transactions []*Transaction `json:"transactions"`
+	}
+	if err := json.Unmarshal(body, &pool); err != nil {
+		return nil, err
+	}
+	return pool.Transactions, nil
+}
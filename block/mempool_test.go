@@ -0,0 +1,161 @@
+package block
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// serveMempool serves pool at /transactions like a neighbour's server,
+// counting the requests in pulls, and returns its host:port.
+func serveMempool(t *testing.T, pool []*Transaction, pulls *int32) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/transactions" {
+			return
+		}
+		atomic.AddInt32(pulls, 1)
+		m, _ := json.Marshal(struct {
+			Transactions []*Transaction `json:"transactions"`
+		}{pool})
+		w.Write(m)
+	}))
+	t.Cleanup(ts.Close)
+	return strings.TrimPrefix(ts.URL, "http://")
+}
+
+// TestNewPeerPullsMempool lets a fresh node sync with an established one
+// holding two pending transactions and a tampered one, as the sync loop
+// does. It must pull the pool once, keeping only the transactions that
+// validate.
+func TestNewPeerPullsMempool(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	established := newTestBlockchain(t, alice.address)
+	mineBlocks(t, established, 2)
+	fresh := forkBlockchain(t, established, carol.address)
+	for i := uint64(1); i <= 2; i++ {
+		if err := addNonced(t, established, alice, bob.address, COIN/10, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pool := established.CopyTransactionPool()
+	tampered := *pool[0]
+	tampered.Nonce = 3
+	tampered.Value = COIN
+	var pulls int32
+	peer := serveMempool(t, append(pool, &tampered), &pulls)
+
+	fresh.SetNeighbourScan(false)
+	if err := fresh.AddNeighbour(peer); err != nil {
+		t.Fatal(err)
+	}
+	fresh.SyncNeighbours()
+	fresh.pullNewMempools()
+	got := fresh.CopyTransactionPool()
+	if len(got) != 2 {
+		t.Fatalf("pulled %d transactions, want 2", len(got))
+	}
+	for i := range got {
+		if got[i].ID() != pool[i].ID() {
+			t.Errorf("transaction %d differs from the established pool", i)
+		}
+	}
+	if rejected := fresh.RecentRejections(); len(rejected) != 1 {
+		t.Errorf("%d rejections, want the tampered transaction", len(rejected))
+	}
+
+	fresh.SyncNeighbours()
+	fresh.pullNewMempools()
+	if n := atomic.LoadInt32(&pulls); n != 1 {
+		t.Fatalf("mempool pulled %d times, want once", n)
+	}
+}
+
+func TestPendingTransactionsLimit(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	fees := []Amount{1, 5, 3, 5, 2}
+	for i, fee := range fees {
+		tx := NewTransaction(alice.address, bob.address, COIN/10)
+		tx.Fee = fee
+		tx.Nonce = uint64(i + 1)
+		if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	top, total := bc.PendingTransactions(3)
+	if total != len(fees) || len(top) != 3 {
+		t.Fatalf("%d transactions of %d, want 3 of %d", len(top), total, len(fees))
+	}
+	// Highest fee first, arrival order among equal fees.
+	for i, nonce := range []uint64{2, 4, 3} {
+		if top[i].Nonce != nonce {
+			t.Errorf("transaction %d has nonce %d, want %d", i, top[i].Nonce, nonce)
+		}
+	}
+
+	for _, limit := range []int{0, -1, len(fees), 100} {
+		all, total := bc.PendingTransactions(limit)
+		if total != len(fees) || len(all) != len(fees) {
+			t.Fatalf("limit %d: %d transactions of %d, want all %d", limit, len(all), total, len(fees))
+		}
+		for i, tx := range all {
+			if tx.Nonce != uint64(i+1) {
+				t.Fatalf("limit %d: transaction %d has nonce %d, want arrival order", limit, i, tx.Nonce)
+			}
+		}
+	}
+}
+
+// TestPruneMempool backdates one of two pooled transactions. PruneMempool
+// must drop only that one, and mining under a max age must leave a stale
+// transaction out of the block.
+func TestPruneMempool(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	age := func(to string, by time.Duration) {
+		t.Helper()
+		bc.mux.Lock()
+		defer bc.mux.Unlock()
+		for _, tx := range bc.TransactionPool {
+			if tx.RecipientBlockchainAddress == to {
+				tx.pooledAt = tx.pooledAt.Add(-by)
+			}
+		}
+	}
+
+	if err := addNonced(t, bc, alice, bob.address, COIN/10, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, alice, carol.address, COIN/10, 0); err != nil {
+		t.Fatal(err)
+	}
+	age(bob.address, 2*time.Hour)
+	if pruned := bc.PruneMempool(0); len(pruned) != 0 {
+		t.Fatal("a max age of zero pruned transactions")
+	}
+	pruned := bc.PruneMempool(time.Hour)
+	if len(pruned) != 1 || pruned[0].RecipientBlockchainAddress != bob.address {
+		t.Fatalf("pruned %d transactions, want the backdated one", len(pruned))
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 1 || pool[0].RecipientBlockchainAddress != carol.address {
+		t.Fatal("the fresh transaction left the pool")
+	}
+
+	age(carol.address, 2*time.Hour)
+	bc.SetMempoolMaxAge(time.Hour)
+	mineBlocks(t, bc, 1)
+	if n := len(bc.LastBlock().Transactions); n != 1 {
+		t.Fatalf("mined block carries %d transactions, want only the coinbase", n)
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 0 {
+		t.Fatalf("pool holds %d transactions after mining", len(pool))
+	}
+}
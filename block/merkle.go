@@ -0,0 +1,27 @@
+package block
+
+import "crypto/sha256"
+
+// merkleRoot hashes the transactions' encoding hashes pairwise up to a
+// single root, pairing the last hash of an odd level with itself. No
+// transactions give the zero hash.
+func merkleRoot(transactions []*Transaction) [32]byte {
+	if len(transactions) == 0 {
+		return [32]byte{}
+	}
+	level := make([][32]byte, len(transactions))
+	for i, t := range transactions {
+		level[i] = t.encodingHash()
+	}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		next := make([][32]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, sha256.Sum256(append(level[i][:], level[i+1][:]...)))
+		}
+		level = next
+	}
+	return level[0]
+}
@@ -0,0 +1,46 @@
+package block
+
+import (
+	"sync"
+	"time"
+)
+
+// Metrics receives the events a node counts, for export to a monitoring
+// system such as Prometheus. Gauges like the height or the pool size are
+// better read from Stats when scraped.
+type Metrics interface {
+	BlockMined()
+	ProofOfWorkDone(d time.Duration)
+}
+
+type noMetrics struct{}
+
+func (noMetrics) BlockMined()                   {}
+func (noMetrics) ProofOfWorkDone(time.Duration) {}
+
+// SetMetrics sends the node's counters to m. By default they are dropped.
+func (bc *Blockchain) SetMetrics(m Metrics) {
+	bc.metrics.set(m)
+}
+
+// swapMetrics is the node's Metrics. SetMetrics may replace where it counts
+// while the miner is counting.
+type swapMetrics struct {
+	mux sync.RWMutex
+	m   Metrics
+}
+
+func (s *swapMetrics) set(m Metrics) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.m = m
+}
+
+func (s *swapMetrics) get() Metrics {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.m
+}
+
+func (s *swapMetrics) BlockMined()                     { s.get().BlockMined() }
+func (s *swapMetrics) ProofOfWorkDone(d time.Duration) { s.get().ProofOfWorkDone(d) }
@@ -0,0 +1,85 @@
+package block
+
+import (
+	"goblockchain/utils"
+	"sort"
+)
+
+type MinerStat struct {
+	Address     string `json:"address"`
+	BlocksMined int    `json:"blocksMined"`
+	TotalReward Amount `json:"totalReward"`
+}
+
+// MinerStats attributes each block to the recipient of its coinbase and sums
+// the rewards they were paid.
+func (bc *Blockchain) MinerStats() map[string]MinerStat {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	stats := make(map[string]MinerStat)
+	miningSender := bc.params.MiningSender()
+	for _, b := range bc.Chain {
+		miners := make(map[string]bool)
+		for _, t := range b.Transactions {
+			if t.SenderBlockchainAddress != miningSender {
+				continue
+			}
+			s := stats[t.RecipientBlockchainAddress]
+			s.Address = t.RecipientBlockchainAddress
+			s.TotalReward += t.Value
+			if !miners[s.Address] {
+				miners[s.Address] = true
+				s.BlocksMined++
+			}
+			stats[s.Address] = s
+		}
+	}
+	return stats
+}
+
+// MinerLeaderboard orders stats by blocks mined, then total reward, then
+// address.
+func MinerLeaderboard(stats map[string]MinerStat) []MinerStat {
+	board := make([]MinerStat, 0, len(stats))
+	for _, s := range stats {
+		board = append(board, s)
+	}
+	sort.Slice(board, func(i, j int) bool {
+		if board[i].BlocksMined != board[j].BlocksMined {
+			return board[i].BlocksMined > board[j].BlocksMined
+		}
+		if board[i].TotalReward != board[j].TotalReward {
+			return board[i].TotalReward > board[j].TotalReward
+		}
+		return board[i].Address < board[j].Address
+	})
+	return board
+}
+
+// SetMiningSender changes the sender label of coinbase transactions, which
+// balance replay treats as minting rather than spending. Every node of a
+// network must agree on it, and it is not for a chain that already holds
+// coinbases under another label.
+func (bc *Blockchain) SetMiningSender(label string) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.params.CoinbaseSender = label
+	if bc.utxo != nil {
+		bc.rebuildUTXO()
+	}
+}
+
+// RotateMiningAddress switches the coinbase recipient under the mining lock,
+// so a block being mined concurrently finishes with the old address and the
+// next one pays newAddress. It returns the previous address.
+func (bc *Blockchain) RotateMiningAddress(newAddress string) (string, error) {
+	if !utils.IsValidBlockchainAddress(newAddress) {
+		return "", ErrInvalidAddress
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	old := bc.BlockChainAddress
+	bc.BlockChainAddress = newAddress
+	bc.logger.Info("rotated mining address", "action", "rotate_mining_address", "old", old, "new", newAddress)
+	return old, nil
+}
@@ -0,0 +1,133 @@
+package block
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestMinerStats(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 3)
+	for i := 0; i < 2; i++ {
+		if _, err := bc.MineTo(bob.address); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := bc.MinerStats()
+	for _, want := range []MinerStat{
+		{Address: alice.address, BlocksMined: 3, TotalReward: 3 * MINING_REWARD},
+		{Address: bob.address, BlocksMined: 2, TotalReward: 2 * MINING_REWARD},
+	} {
+		if got := stats[want.Address]; got != want {
+			t.Errorf("stats %+v, want %+v", got, want)
+		}
+	}
+
+	board := MinerLeaderboard(stats)
+	if len(board) < 2 || board[0].Address != alice.address || board[1].Address != bob.address {
+		t.Fatalf("leaderboard %+v, want alice then bob first", board)
+	}
+}
+
+// TestRotateMiningAddress rotates the payout address while a block is being
+// mined. That block must still pay the old address and the next one the new.
+func TestRotateMiningAddress(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	if _, err := bc.RotateMiningAddress("not an address"); !errors.Is(err, ErrInvalidAddress) {
+		t.Fatalf("got %v, want ErrInvalidAddress", err)
+	}
+
+	// A block can be mined before the test sees the search start; if so,
+	// it pays alice too and the test tries again on the next one.
+	bc.SetMiningThreads(1)
+	bc.SetDifficulty(3)
+	var mined chan bool
+	var height int
+	for running := false; !running; {
+		height = bc.ChainLength()
+		mined = make(chan bool, 1)
+		go func() { mined <- bc.Mining() }()
+		for !running {
+			bc.miningMux.Lock()
+			running = bc.mining != nil
+			bc.miningMux.Unlock()
+			if len(mined) > 0 {
+				if !<-mined {
+					t.Fatal("no block was mined")
+				}
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	old, err := bc.RotateMiningAddress(bob.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if old != alice.address {
+		t.Fatalf("old address %s, want %s", old, alice.address)
+	}
+	if !<-mined {
+		t.Fatal("the block in progress was not mined")
+	}
+	mineBlocks(t, bc, 1)
+
+	for h, want := range map[int]string{height: alice.address, height + 1: bob.address} {
+		if got := bc.Chain[h].Transactions[0].RecipientBlockchainAddress; got != want {
+			t.Errorf("block %d pays %s, want %s", h, got, want)
+		}
+	}
+}
+
+// TestMiningThreads searches with one and with four workers. Both must find
+// a valid nonce, a single worker the lowest one, and a search must not run
+// more workers than the cap.
+func TestMiningThreads(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	mineBlocks(t, bc, 1)
+	previousHash := bc.LastBlock().Hash()
+	const difficulty = 2
+	bc.SetDifficulty(difficulty)
+	pool := bc.CopyTransactionPool()
+
+	for _, threads := range []int{1, 4} {
+		bc.SetMiningThreads(threads)
+		nonce := bc.ProofOfWork()
+		if !bc.ValidProof(nonce, previousHash, pool, difficulty) {
+			t.Errorf("%d threads: nonce %d is not valid", threads, nonce)
+		}
+		if threads == 1 {
+			for lower := 0; lower < nonce; lower++ {
+				if bc.ValidProof(lower, previousHash, pool, difficulty) {
+					t.Errorf("1 thread: nonce %d found, but %d is lower", nonce, lower)
+					break
+				}
+			}
+		}
+
+		// A search at the maximum difficulty runs until cancelled.
+		before := runtime.NumGoroutine()
+		ctx, cancel := context.WithCancel(context.Background())
+		stopped := make(chan error)
+		go func() {
+			_, err := bc.proofOfWork(ctx, pool, previousHash, MAX_DIFFICULTY, threads)
+			stopped <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		// The search's own goroutine counts beside its workers.
+		if running := runtime.NumGoroutine() - before; running > threads+1 {
+			t.Errorf("%d threads: %d goroutines running", threads, running)
+		}
+		cancel()
+		if err := <-stopped; !errors.Is(err, context.Canceled) {
+			t.Errorf("%d threads: cancelled search returned %v", threads, err)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package block
+
+import "context"
+
+// miningAttempt is the proof-of-work search currently running in mine.
+type miningAttempt struct {
+	cancel context.CancelFunc
+}
+
+func (bc *Blockchain) beginMiningAttempt(cancel context.CancelFunc) {
+	bc.miningMux.Lock()
+	defer bc.miningMux.Unlock()
+	bc.mining = &miningAttempt{cancel: cancel}
+}
+
+func (bc *Blockchain) endMiningAttempt() {
+	bc.miningMux.Lock()
+	defer bc.miningMux.Unlock()
+	bc.mining = nil
+}
+
+// cancelMining cancels the running attempt, if any.
+func (bc *Blockchain) cancelMining() {
+	bc.miningMux.Lock()
+	defer bc.miningMux.Unlock()
+	if bc.mining != nil {
+		bc.mining.cancel()
+	}
+}
@@ -0,0 +1,218 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"goblockchain/utils"
+	"math"
+	"time"
+)
+
+type gappedTransaction struct {
+	transaction     *Transaction
+	senderPublicKey *ecdsa.PublicKey
+	signature       *utils.Signature
+	receivedAt      time.Time
+}
+
+// SetNonceGapTimeout sets how long a transaction waits for the nonces before
+// it to arrive before it is evicted.
+func (bc *Blockchain) SetNonceGapTimeout(d time.Duration) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.nonceGapTimeout = d
+}
+
+// SetNonceGapLimits caps how many transactions wait on a nonce gap, per
+// sender and in total. Zero lifts a cap.
+func (bc *Blockchain) SetNonceGapLimits(perSender, total int) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.maxGappedPerSender = perSender
+	bc.maxGappedTotal = total
+}
+
+// SetRequireNonce makes the node refuse transactions without a nonce, so
+// that every transfer it admits is protected against replay. Senders then
+// number their transactions 1, 2, 3 and so on. Without it, a transaction
+// without a nonce is still refused once an identical one is confirmed.
+func (bc *Blockchain) SetRequireNonce(require bool) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.requireNonce = require
+}
+
+// verifyNonces checks that each sender's nonced transactions count up by
+// one along the chain, so none can be replayed or reordered, and that no
+// transaction without a nonce is confirmed twice. Checking starts at height
+// from, with the last nonces used below it and the hashes of the nonce-less
+// transactions confirmed below it in confirmed, which is added to.
+func verifyNonces(chain []*Block, params NetworkParams, from int, last map[string]uint64, confirmed map[[32]byte]bool) error {
+	for h := from; h < len(chain); h++ {
+		for i, t := range chain[h].Transactions {
+			if t.Nonce == 0 {
+				if params.isCoinbase(t.SenderBlockchainAddress) {
+					continue
+				}
+				hash := t.Hash()
+				if confirmed[hash] {
+					return verifyErrorf(h, "transaction %d: replays a confirmed transaction from %s", i, t.SenderBlockchainAddress)
+				}
+				confirmed[hash] = true
+				continue
+			}
+			if want := last[t.SenderBlockchainAddress] + 1; t.Nonce != want {
+				return verifyErrorf(h, "transaction %d: nonce %d from %s, want %d", i, t.Nonce, t.SenderBlockchainAddress, want)
+			}
+			last[t.SenderBlockchainAddress] = t.Nonce
+		}
+	}
+	return nil
+}
+
+// lastNonces returns a copy of the highest nonce each sender has used in the
+// chain. The caller must hold bc.mux.
+func (bc *Blockchain) lastNonces() map[string]uint64 {
+	last := make(map[string]uint64, len(bc.nonceIndex))
+	for sender, n := range bc.nonceIndex {
+		last[sender] = n
+	}
+	return last
+}
+
+func recordNonces(last map[string]uint64, b *Block) {
+	for _, t := range b.Transactions {
+		if t.Nonce > last[t.SenderBlockchainAddress] {
+			last[t.SenderBlockchainAddress] = t.Nonce
+		}
+	}
+}
+
+// NextNonce returns the nonce sender's next transaction should carry, one
+// past the highest it has used in the chain or the pool.
+func (bc *Blockchain) NextNonce(sender string) uint64 {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.nextNonce(sender)
+}
+
+// indexConfirmed records the hashes of b's transactions that carry no nonce,
+// which would otherwise be accepted again if resubmitted, and the nonces the
+// rest use. The caller must hold bc.mux.
+func (bc *Blockchain) indexConfirmed(b *Block) {
+	recordNonces(bc.nonceIndex, b)
+	for _, t := range b.Transactions {
+		if t.Nonce == 0 && !bc.params.isCoinbase(t.SenderBlockchainAddress) {
+			bc.confirmedHashes[t.Hash()] = true
+		}
+	}
+}
+
+// nextNonce is one past the highest nonce the sender has used in the chain
+// or the pool.
+func (bc *Blockchain) nextNonce(sender string) uint64 {
+	last := bc.nonceIndex[sender]
+	for _, t := range bc.TransactionPool {
+		if t.SenderBlockchainAddress == sender && t.Nonce > last {
+			last = t.Nonce
+		}
+	}
+	return last + 1
+}
+
+// checkGapLimits reports whether t may wait on a nonce gap without
+// exceeding the per-sender or total queue caps. Replacing a queued
+// transaction with the same nonce takes no extra room. The caller must hold
+// bc.mux.
+func (bc *Blockchain) checkGapLimits(t *Transaction) error {
+	queue := bc.gapped[t.SenderBlockchainAddress]
+	if _, ok := queue[t.Nonce]; ok {
+		return nil
+	}
+	if bc.maxGappedPerSender > 0 && len(queue) >= bc.maxGappedPerSender {
+		return ErrNonceGapQueueFull
+	}
+	if bc.maxGappedTotal > 0 && bc.gappedCount() >= bc.maxGappedTotal {
+		return ErrNonceGapQueueFull
+	}
+	return nil
+}
+
+// gappedCount is how many transactions wait on a nonce gap. The caller must
+// hold bc.mux.
+func (bc *Blockchain) gappedCount() int {
+	n := 0
+	for _, queue := range bc.gapped {
+		n += len(queue)
+	}
+	return n
+}
+
+// gappedSpend is what the sender's queued transactions other than the one
+// with nonce would spend, or math.MaxInt64 if the sum overflows. The caller
+// must hold bc.mux.
+func (bc *Blockchain) gappedSpend(sender string, nonce uint64) Amount {
+	var spend Amount
+	for n, g := range bc.gapped[sender] {
+		if n == nonce {
+			continue
+		}
+		cost, ok := g.transaction.cost()
+		if ok {
+			spend, ok = addAmounts(spend, cost)
+		}
+		if !ok {
+			return math.MaxInt64
+		}
+	}
+	return spend
+}
+
+func (bc *Blockchain) queueGapped(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) {
+	queue, ok := bc.gapped[t.SenderBlockchainAddress]
+	if !ok {
+		queue = make(map[uint64]*gappedTransaction)
+		bc.gapped[t.SenderBlockchainAddress] = queue
+	}
+	queue[t.Nonce] = &gappedTransaction{
+		transaction:     t,
+		senderPublicKey: senderPublicKey,
+		signature:       s,
+		receivedAt:      time.Now(),
+	}
+	bc.logger.Debug("queued transaction behind nonce gap", "sender", t.SenderBlockchainAddress, "nonce", t.Nonce)
+}
+
+// promoteGapped moves the sender's queued transaction that now follows the
+// pool into it, which in turn promotes the one after that.
+func (bc *Blockchain) promoteGapped(sender string) {
+	queue := bc.gapped[sender]
+	next := bc.nextNonce(sender)
+	g, ok := queue[next]
+	if !ok {
+		return
+	}
+	delete(queue, next)
+	if len(queue) == 0 {
+		delete(bc.gapped, sender)
+	}
+	if err := bc.addTransaction(g.transaction, g.senderPublicKey, g.signature); err != nil {
+		bc.logger.Warn("queued transaction rejected", "sender", sender, "nonce", next, "err", err)
+		bc.rejectTransaction(g.transaction, g.senderPublicKey, g.signature, err)
+	}
+}
+
+func (bc *Blockchain) evictGapped(now time.Time) int {
+	evicted := 0
+	for sender, queue := range bc.gapped {
+		for nonce, g := range queue {
+			if now.Sub(g.receivedAt) > bc.nonceGapTimeout {
+				delete(queue, nonce)
+				evicted++
+			}
+		}
+		if len(queue) == 0 {
+			delete(bc.gapped, sender)
+		}
+	}
+	return evicted
+}
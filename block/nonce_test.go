@@ -0,0 +1,174 @@
+package block
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func addNonced(t *testing.T, bc *Blockchain, from testKey, to string, value Amount, nonce uint64) error {
+	t.Helper()
+	tx := NewTransaction(from.address, to, value)
+	tx.Nonce = nonce
+	return bc.AddSignedTransactionE(tx, &from.private.PublicKey, from.sign(t, tx))
+}
+
+func TestNonceGapQueueIsChecked(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	if _, err := bc.MineTo(carol.address); err != nil {
+		t.Fatal(err)
+	}
+
+	// Balance is checked before a transaction is queued, counting the rest
+	// of the sender's queue.
+	if err := addNonced(t, bc, alice, bob.address, 3*COIN, 3); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("overdrawing gapped transaction: got %v, want ErrInsufficientBalance", err)
+	}
+	if err := addNonced(t, bc, alice, bob.address, COIN, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, alice, bob.address, COIN+1, 4); !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("queue overdrawing together: got %v, want ErrInsufficientBalance", err)
+	}
+
+	// The per-sender and total caps.
+	bc.SetNonceGapLimits(2, 3)
+	if err := addNonced(t, bc, alice, bob.address, 1, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, alice, bob.address, 1, 5); !errors.Is(err, ErrNonceGapQueueFull) {
+		t.Fatalf("over the per-sender cap: got %v, want ErrNonceGapQueueFull", err)
+	}
+	if err := addNonced(t, bc, alice, bob.address, 2, 4); err != nil {
+		t.Fatalf("replacing a queued nonce: %v", err)
+	}
+	if err := addNonced(t, bc, carol, bob.address, 1, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, carol, bob.address, 1, 4); !errors.Is(err, ErrNonceGapQueueFull) {
+		t.Fatalf("over the total cap: got %v, want ErrNonceGapQueueFull", err)
+	}
+
+	// The queue counts toward the pending limit.
+	bc.SetMaxPendingPerSender(3)
+	if err := addNonced(t, bc, alice, bob.address, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, alice, bob.address, 1, 2); !errors.Is(err, ErrTooManyPending) {
+		t.Fatalf("over the pending limit: got %v, want ErrTooManyPending", err)
+	}
+
+	// Compaction expires the queue.
+	bc.SetNonceGapTimeout(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	bc.Compact()
+	bc.mux.RLock()
+	queued := bc.gappedCount()
+	bc.mux.RUnlock()
+	if queued != 0 {
+		t.Fatalf("%d transactions still queued after compaction", queued)
+	}
+	if err := addNonced(t, bc, alice, bob.address, 1, 2); err != nil {
+		t.Fatalf("after the queue expired: %v", err)
+	}
+}
+
+func TestReplayedTransactionWithoutNonceIsRejected(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+
+	tx := NewTransaction(alice.address, bob.address, COIN/2)
+	signature := alice.sign(t, tx)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, signature); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+
+	replay := NewTransaction(alice.address, bob.address, COIN/2)
+	if err := bc.AddSignedTransactionE(replay, &alice.private.PublicKey, signature); !errors.Is(err, ErrReplayedTransaction) {
+		t.Fatalf("replayed transaction: got %v, want ErrReplayedTransaction", err)
+	}
+
+	// The same transfer with a nonce is a new transaction.
+	if got := bc.NextNonce(alice.address); got != 1 {
+		t.Fatalf("next nonce %d, want 1", got)
+	}
+	if err := addNonced(t, bc, alice, bob.address, COIN/2, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.NextNonce(alice.address); got != 2 {
+		t.Fatalf("next nonce with one pooled %d, want 2", got)
+	}
+}
+
+// TestChainReplayingTransactionWithoutNonceIsInvalid has a neighbour mine a
+// nonce-less transfer a second time. Its chain must fail validation.
+func TestChainReplayingTransactionWithoutNonceIsInvalid(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	tx := NewTransaction(alice.address, bob.address, COIN/2)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+
+	fork := forkBlockchain(t, bc, bob.address)
+	replay := *tx
+	fork.mux.Lock()
+	fork.TransactionPool = append(fork.TransactionPool, &replay)
+	fork.mux.Unlock()
+	mineBlocks(t, fork, 1)
+
+	if err := VerifyChain(fork.Chain, [32]byte{}, fork.Params()); err == nil {
+		t.Fatal("a chain confirming the same transfer twice passed verification")
+	}
+	if bc.ValidChain(fork.Chain) {
+		t.Fatal("a chain confirming the same transfer twice was accepted")
+	}
+}
+
+// TestNextNonceFollowsReorg checks the per-sender nonce index as blocks are
+// mined and a fork that used fewer nonces replaces the chain.
+func TestNextNonceFollowsReorg(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	fork := forkBlockchain(t, bc, bob.address)
+
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		if err := addNonced(t, bc, alice, bob.address, 1, nonce); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mineBlocks(t, bc, 1)
+	if got := bc.NextNonce(alice.address); got != 3 {
+		t.Fatalf("next nonce after mining %d, want 3", got)
+	}
+
+	if err := addNonced(t, fork, alice, bob.address, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, fork, 3)
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer fork was not adopted")
+	}
+	// The orphaned nonce 2 is reinstated into the pool on top of the
+	// fork's nonce 1.
+	if got := bc.NextNonce(alice.address); got != 3 {
+		t.Fatalf("next nonce after the reorg %d, want 3", got)
+	}
+	bc.mux.RLock()
+	confirmed := bc.nonceIndex[alice.address]
+	bc.mux.RUnlock()
+	if confirmed != 1 {
+		t.Fatalf("confirmed nonce after the reorg %d, want 1", confirmed)
+	}
+}
@@ -0,0 +1,116 @@
+package block
+
+import (
+	"runtime"
+	"time"
+)
+
+type NetworkParams struct {
+	Difficulty     int           `json:"difficulty"`
+	MaxFutureDrift time.Duration `json:"maxFutureDrift"`
+	// VerifyWorkers is the number of goroutines used to check proof of work
+	// when validating a chain. Values below 2 verify serially.
+	VerifyWorkers int `json:"verifyWorkers"`
+	// RewardPolicy sets the coinbase reward per height. A nil policy pays
+	// MINING_REWARD at every height.
+	RewardPolicy RewardPolicy `json:"-"`
+	// MedianTimeSpan is how many preceding blocks form the median-time-past
+	// a new block's timestamp must exceed. Zero disables the rule.
+	MedianTimeSpan int `json:"medianTimeSpan"`
+	// MaxBlockBytes caps the serialized size of a block. Zero disables the
+	// cap.
+	MaxBlockBytes int `json:"maxBlockBytes"`
+	// MaxTransactionsPerBlock caps how many transactions a block carries,
+	// coinbase included. Zero disables the cap.
+	MaxTransactionsPerBlock int `json:"maxTransactionsPerBlock"`
+	// CoinbaseFirst requires every block after the genesis to carry exactly
+	// one coinbase transaction, at index 0.
+	CoinbaseFirst bool `json:"coinbaseFirst"`
+	// VerifyTransactionSignatures requires every transaction after the
+	// genesis, other than the coinbase, to carry a valid signature by a key
+	// that derives its sender's address. Transactions confirmed before they
+	// stored their key and signature cannot pass; a network with such blocks
+	// turns the rule off and schedules it on from a later height.
+	VerifyTransactionSignatures bool `json:"verifyTransactionSignatures"`
+	// TargetBlockInterval turns on difficulty retargeting: Difficulty is then
+	// only the starting point, and each block's difficulty moves by one step
+	// to keep the average interval over the last RetargetWindow blocks near
+	// the target. Zero keeps Difficulty fixed.
+	TargetBlockInterval time.Duration `json:"targetBlockInterval"`
+	RetargetWindow      int           `json:"retargetWindow"`
+	// RecentBlockWindow is how many blocks back from the tip a transaction's
+	// RecentBlockHash may point.
+	RecentBlockWindow int `json:"recentBlockWindow"`
+	// CoinbaseSender labels the sender of coinbase transactions; empty means
+	// MINING_SENDER. It applies at every height, whatever the Schedule says.
+	CoinbaseSender string `json:"coinbaseSender,omitempty"`
+	// Consensus selects how blocks are sealed and validated.
+	Consensus ConsensusMode `json:"consensus"`
+	// ProposerTimeout is how long a proof-of-stake slot waits for its
+	// proposer before passing to the next one drawn. Zero never passes it on.
+	ProposerTimeout time.Duration `json:"proposerTimeout"`
+	// Checkpoints pin the hashes of blocks at given heights. Like the
+	// coinbase sender, they are not scheduled.
+	Checkpoints Checkpoints `json:"-"`
+	// Schedule switches to other params from given heights on. Every node
+	// of a network must carry the same schedule.
+	Schedule ParamSchedule `json:"-"`
+}
+
+// ParamSchedule maps an activation height to the params that govern blocks
+// from that height on, until the next scheduled height.
+type ParamSchedule map[int]NetworkParams
+
+func DefaultNetworkParams() NetworkParams {
+	return NetworkParams{
+		Difficulty:                  MINING_DIFFICULTY,
+		MaxFutureDrift:              MAX_FUTURE_DRIFT,
+		VerifyWorkers:               runtime.NumCPU(),
+		RewardPolicy:                ConstantReward(MINING_REWARD),
+		MedianTimeSpan:              MEDIAN_TIME_SPAN,
+		MaxBlockBytes:               MAX_BLOCK_BYTES,
+		MaxTransactionsPerBlock:     MAX_BLOCK_TRANSACTIONS,
+		CoinbaseFirst:               true,
+		VerifyTransactionSignatures: true,
+		RetargetWindow:              DIFFICULTY_RETARGET_WINDOW,
+		RecentBlockWindow:           RECENT_BLOCK_WINDOW,
+		ProposerTimeout:             PROPOSER_TIMEOUT,
+	}
+}
+
+func (p NetworkParams) Reward(height int) Amount {
+	if p.RewardPolicy == nil {
+		return MINING_REWARD
+	}
+	return p.RewardPolicy.Reward(height)
+}
+
+// MiningSender returns the sender label of coinbase transactions.
+func (p NetworkParams) MiningSender() string {
+	if p.CoinbaseSender == "" {
+		return MINING_SENDER
+	}
+	return p.CoinbaseSender
+}
+
+// isCoinbase reports whether sender mints rather than spends: the coinbase
+// or a genesis allocation.
+func (p NetworkParams) isCoinbase(sender string) bool {
+	return isCoinbaseSender(sender, p.MiningSender())
+}
+
+// At returns the params that govern the block at height: those of the
+// highest scheduled height not above it, or p itself if none applies. The
+// result keeps p's schedule, coinbase sender and checkpoints.
+func (p NetworkParams) At(height int) NetworkParams {
+	active, activeHeight := p, -1
+	for h, params := range p.Schedule {
+		if h <= height && h > activeHeight {
+			active, activeHeight = params, h
+		}
+	}
+	active.Schedule = p.Schedule
+	active.CoinbaseSender = p.CoinbaseSender
+	active.Checkpoints = p.Checkpoints
+	return active
+}
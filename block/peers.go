@@ -0,0 +1,195 @@
+package block
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+)
+
+// PEER_FAILURE_LIMIT is how many failed responses in a row make a neighbour
+// unhealthy, leaving it out of the saved peers until it answers again.
+const PEER_FAILURE_LIMIT = 3
+
+// recordPeerFailure counts a failed response from neighbour.
+func (bc *Blockchain) recordPeerFailure(neighbour string) {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	if bc.peerFailures == nil {
+		bc.peerFailures = make(map[string]int)
+	}
+	bc.peerFailures[neighbour]++
+}
+
+// recordPeerSuccess clears neighbour's failures once it answers.
+func (bc *Blockchain) recordPeerSuccess(neighbour string) {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	delete(bc.peerFailures, neighbour)
+}
+
+// PeerFailures returns how many failed responses in a row each neighbour
+// has produced since it last answered.
+func (bc *Blockchain) PeerFailures() map[string]int {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	failures := make(map[string]int, len(bc.peerFailures))
+	for n, c := range bc.peerFailures {
+		failures[n] = c
+	}
+	return failures
+}
+
+// SetPeersFile enables peer persistence. Peers saved in path are merged with
+// freshly discovered neighbours, and the healthy neighbour set is written
+// back after every sync.
+func (bc *Blockchain) SetPeersFile(path string) {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	bc.peersFile = path
+}
+
+func (bc *Blockchain) loadPersistedPeers() {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	if bc.peersFile == "" {
+		return
+	}
+	peers, err := LoadPeers(bc.peersFile)
+	if err != nil {
+		bc.logger.Error("load peers failed", "path", bc.peersFile, "err", err)
+		return
+	}
+	bc.persistedPeers = peers
+	bc.neighbours = mergePeers(bc.neighbours, peers)
+}
+
+type PeerRequest struct {
+	Address string `json:"address"`
+}
+
+type PeersResponse struct {
+	Peers []string `json:"peers"`
+}
+
+// ValidatePeerAddress checks that addr is a host:port with a usable port.
+func ValidatePeerAddress(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return ErrInvalidPeerAddress
+	}
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return ErrInvalidPeerAddress
+	}
+	return nil
+}
+
+// AddNeighbour registers addr, a host:port, as a neighbour for networks the
+// IP scan cannot reach. Registered neighbours survive rescans and are merged
+// with the scanned ones, or used alone once SetNeighbourScan is off.
+func (bc *Blockchain) AddNeighbour(addr string) error {
+	if err := ValidatePeerAddress(addr); err != nil {
+		return err
+	}
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	bc.explicitPeers = mergePeers(bc.explicitPeers, []string{addr})
+	bc.neighbours = mergePeers(bc.neighbours, []string{addr})
+	bc.logger.Info("neighbour added", "action", "add_neighbour", "peer", addr)
+	return nil
+}
+
+// RemoveNeighbour forgets addr however it was learned and reports whether it
+// was known. A scanned neighbour comes back on the next rescan.
+func (bc *Blockchain) RemoveNeighbour(addr string) bool {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	drop := map[string]bool{addr: true}
+	n := len(bc.neighbours) + len(bc.explicitPeers) + len(bc.persistedPeers) + len(bc.announcedPeers)
+	bc.neighbours = withoutPeers(bc.neighbours, drop)
+	bc.explicitPeers = withoutPeers(bc.explicitPeers, drop)
+	bc.persistedPeers = withoutPeers(bc.persistedPeers, drop)
+	bc.announcedPeers = withoutPeers(bc.announcedPeers, drop)
+	removed := n != len(bc.neighbours)+len(bc.explicitPeers)+len(bc.persistedPeers)+len(bc.announcedPeers)
+	if removed {
+		bc.logger.Info("neighbour removed", "action", "remove_neighbour", "peer", addr)
+	}
+	return removed
+}
+
+// SetNeighbourScan turns the IP range scan for neighbours on or off. With it
+// off, the neighbours are the registered, persisted and announced peers.
+func (bc *Blockchain) SetNeighbourScan(enabled bool) {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	bc.noScan = !enabled
+}
+
+// Neighbours returns the current neighbours.
+func (bc *Blockchain) Neighbours() []string {
+	return bc.peers()
+}
+
+// peers returns a copy of the neighbours that stays valid while the
+// neighbour set is rescanned.
+func (bc *Blockchain) peers() []string {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	return append([]string(nil), bc.neighbours...)
+}
+
+// healthyPeers returns the neighbours that have not failed
+// PEER_FAILURE_LIMIT times in a row. The caller must hold muxNeighbours.
+func (bc *Blockchain) healthyPeers() []string {
+	peers := make([]string, 0, len(bc.neighbours))
+	for _, n := range bc.neighbours {
+		if bc.peerFailures[n] < PEER_FAILURE_LIMIT {
+			peers = append(peers, n)
+		}
+	}
+	return peers
+}
+
+func SavePeers(path string, peers []string) error {
+	m, err := json.Marshal(struct {
+		Peers []string `json:"peers"`
+	}{
+		Peers: peers,
+	})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, m, 0644)
+}
+
+// LoadPeers reads a peer list written by SavePeers. A missing file yields an
+// empty list.
+func LoadPeers(path string) ([]string, error) {
+	m, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var v struct {
+		Peers []string `json:"peers"`
+	}
+	if err := json.Unmarshal(m, &v); err != nil {
+		return nil, err
+	}
+	return v.Peers, nil
+}
+
+func mergePeers(a []string, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	merged := make([]string, 0, len(a)+len(b))
+	for _, p := range append(append([]string{}, a...), b...) {
+		if !seen[p] {
+			seen[p] = true
+			merged = append(merged, p)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,146 @@
+package block
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func healthy(bc *Blockchain) map[string]bool {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	peers := make(map[string]bool)
+	for _, n := range bc.healthyPeers() {
+		peers[n] = true
+	}
+	return peers
+}
+
+func TestPeerFailuresResetOnSuccess(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	var failing int32 = 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		m, _ := bc.MarshalJSON()
+		w.Write(m)
+	}))
+	defer ts.Close()
+	peer := strings.TrimPrefix(ts.URL, "http://")
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(peer); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= PEER_FAILURE_LIMIT; i++ {
+		bc.ResolveConflicts()
+		if got := bc.PeerFailures()[peer]; got != i {
+			t.Fatalf("after %d failures the count is %d", i, got)
+		}
+		if want := i < PEER_FAILURE_LIMIT; healthy(bc)[peer] != want {
+			t.Fatalf("after %d failures healthy = %v, want %v", i, !want, want)
+		}
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	bc.ResolveConflicts()
+	if got := bc.PeerFailures()[peer]; got != 0 {
+		t.Fatalf("failures after a success: %d, want 0", got)
+	}
+	if !healthy(bc)[peer] {
+		t.Fatal("peer still unhealthy after it answered")
+	}
+}
+
+func TestCompactDropsFailuresOfFormerNeighbours(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	bc.SetNeighbourScan(false)
+	for _, p := range []string{"127.0.0.1:1", "127.0.0.1:2"} {
+		if err := bc.AddNeighbour(p); err != nil {
+			t.Fatal(err)
+		}
+		bc.recordPeerFailure(p)
+	}
+	bc.muxNeighbours.Lock()
+	bc.pingFailures = map[string]int{"127.0.0.1:1": 1, "127.0.0.1:2": 1}
+	bc.muxNeighbours.Unlock()
+
+	bc.RemoveNeighbour("127.0.0.1:2")
+	bc.Compact()
+
+	if failures := bc.PeerFailures(); failures["127.0.0.1:2"] != 0 || failures["127.0.0.1:1"] != 1 {
+		t.Fatalf("peer failures after compaction: %v", failures)
+	}
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	if _, ok := bc.pingFailures["127.0.0.1:2"]; ok || bc.pingFailures["127.0.0.1:1"] != 1 {
+		t.Fatalf("ping failures after compaction: %v", bc.pingFailures)
+	}
+}
+
+func TestCompactTrimsAnnouncedPeers(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	bc.SetNeighbourScan(false)
+	bc.muxNeighbours.Lock()
+	for i := 0; i < MAX_ANNOUNCED_PEERS+10; i++ {
+		bc.announcedPeers = append(bc.announcedPeers, fmt.Sprintf("10.0.%d.%d:5001", i/256, i%256))
+	}
+	failing := bc.announcedPeers[len(bc.announcedPeers)-1]
+	bc.muxNeighbours.Unlock()
+	for i := 0; i < PEER_FAILURE_LIMIT; i++ {
+		bc.recordPeerFailure(failing)
+	}
+
+	bc.Compact()
+
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	if got := len(bc.announcedPeers); got != MAX_ANNOUNCED_PEERS {
+		t.Fatalf("%d announced peers after compaction, want %d", got, MAX_ANNOUNCED_PEERS)
+	}
+	for _, p := range bc.announcedPeers {
+		if p == failing {
+			t.Fatalf("failing peer %s still announced", p)
+		}
+	}
+	if bc.announcedPeers[0] != "10.0.0.9:5001" {
+		t.Fatalf("oldest announced peer kept is %s, want 10.0.0.9:5001", bc.announcedPeers[0])
+	}
+}
+
+// TestPingDropsUnreachableExplicitPeer adds a neighbour that never answers.
+// Once it has missed enough pings it must be gone, and stay gone after a
+// rescan merges the explicit peers back in.
+func TestPingDropsUnreachableExplicitPeer(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	peer := strings.TrimPrefix(closed.URL, "http://")
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(peer); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < PING_FAILURE_LIMIT; i++ {
+		if removed := bc.PingNeighbours(); len(removed) != 0 {
+			t.Fatalf("dropped %v after %d failures", removed, i)
+		}
+	}
+	if removed := bc.PingNeighbours(); len(removed) != 1 || removed[0] != peer {
+		t.Fatalf("dropped %v, want [%s]", removed, peer)
+	}
+	bc.SyncNeighbours()
+	for _, n := range bc.Neighbours() {
+		if n == peer {
+			t.Fatal("the unreachable peer was merged back on rescan")
+		}
+	}
+}
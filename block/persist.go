@@ -0,0 +1,131 @@
+package block
+
+import (
+	"encoding/json"
+	"fmt"
+	"goblockchain/utils"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+type chainFile struct {
+	Chain           []*Block       `json:"chain"`
+	TransactionPool []*Transaction `json:"transactionPool"`
+	Snapshot        *pruneSnapshot `json:"snapshot,omitempty"`
+}
+
+// SaveToFile writes the chain, the transaction pool and any prune snapshot
+// to path, replacing the file atomically.
+func (bc *Blockchain) SaveToFile(path string) error {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.saveToFile(path)
+}
+
+// saveToFile is SaveToFile for callers that hold bc.mux.
+func (bc *Blockchain) saveToFile(path string) error {
+	m, err := json.Marshal(chainFile{Chain: bc.Chain, TransactionPool: bc.TransactionPool, Snapshot: bc.snapshot})
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(m); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFromFile reads a chain written by SaveToFile. The chain must validate
+// under params, the ones the node runs with, with its own genesis block
+// trusted and pinned. Pooled transactions are re-admitted one by one and
+// dropped if they no longer pass. The caller sets the address and port.
+func LoadFromFile(path string, params NetworkParams) (*Blockchain, error) {
+	m, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f chainFile
+	if err := json.Unmarshal(m, &f); err != nil {
+		return nil, fmt.Errorf("load chain: %v", err)
+	}
+	if len(f.Chain) == 0 {
+		return nil, fmt.Errorf("load chain: %s holds no blocks", path)
+	}
+	bc := newBlockchain("", 0)
+	bc.params = bc.clampParamsDifficulty(params)
+	bc.genesisHash = f.Chain[0].Hash()
+	bc.snapshot = f.Snapshot
+	if !bc.ValidChain(f.Chain) {
+		return nil, fmt.Errorf("load chain: %s holds an invalid chain", path)
+	}
+	bc.replaceChain(f.Chain)
+	for _, t := range f.TransactionPool {
+		if bc.params.isCoinbase(t.SenderBlockchainAddress) {
+			continue
+		}
+		publicKey, err := utils.ParsePublicKey(t.SenderPublicKey)
+		if err != nil {
+			continue
+		}
+		signature, err := utils.ParseSignature(t.Signature)
+		if err != nil {
+			continue
+		}
+		if err := bc.addTransaction(t, publicKey, signature); err != nil {
+			bc.logger.Warn("dropped saved transaction", "sender", t.SenderBlockchainAddress, "err", err)
+		}
+	}
+	return bc, nil
+}
+
+// NewBlockchainFromFile rehydrates the chain saved at path if there is one,
+// and otherwise starts a new chain from genesis like
+// NewBlockchainWithGenesis, or like NewBlockchain if genesis is nil. A saved
+// chain must start with genesis when one is given and is validated under
+// params, which the chain keeps either way. The chain is saved back to path
+// after every block.
+func NewBlockchainFromFile(blockChainAddress string, port uint16, path string, genesis *Block, params NetworkParams) (*Blockchain, error) {
+	var bc *Blockchain
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if genesis != nil {
+			bc = NewBlockchainWithGenesis(blockChainAddress, port, genesis)
+		} else {
+			bc = NewBlockchain(blockChainAddress, port)
+		}
+		bc.params = bc.clampParamsDifficulty(params)
+		bc.syncDifficulty()
+	} else {
+		bc, err = LoadFromFile(path, params)
+		if err != nil {
+			return nil, err
+		}
+		if genesis != nil && bc.genesisHash != genesis.Hash() {
+			return nil, fmt.Errorf("load chain: %s does not start with the configured genesis", path)
+		}
+		bc.BlockChainAddress = blockChainAddress
+		bc.Port = port
+	}
+	bc.chainFile = path
+	return bc, nil
+}
+
+// persist saves the chain to the configured chain file, if any. The caller
+// must hold bc.mux.
+func (bc *Blockchain) persist() {
+	if bc.chainFile == "" {
+		return
+	}
+	if err := bc.saveToFile(bc.chainFile); err != nil {
+		bc.logger.Error("save chain failed", "path", bc.chainFile, "err", err)
+	}
+}
@@ -0,0 +1,41 @@
+package block
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveAndReloadUnderNonDefaultParams(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	params := bc.Params()
+	params.Difficulty = 1
+	params.CoinbaseSender = "POOL REWARDS"
+	params.RewardPolicy = HalvingReward{Base: MINING_REWARD, Interval: 2}
+	bc.SetParams(params)
+	mineBlocks(t, bc, 5)
+
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := bc.SaveToFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := NewBlockchainFromFile(miner.address, 0, path, nil, params)
+	if err != nil {
+		t.Fatalf("reload under the saving node's params: %v", err)
+	}
+	if got, want := len(loaded.Chain), len(bc.Chain); got != want {
+		t.Fatalf("reloaded %d blocks, want %d", got, want)
+	}
+	if got, want := loaded.Balance(miner.address), bc.Balance(miner.address); got != want {
+		t.Fatalf("reloaded balance %s, want %s", got, want)
+	}
+	if got := loaded.Params().MiningSender(); got != "POOL REWARDS" {
+		t.Fatalf("reloaded mining sender %q, want the configured one", got)
+	}
+	mineBlocks(t, loaded, 1)
+
+	if _, err := LoadFromFile(path, DefaultNetworkParams()); err == nil {
+		t.Fatal("chain mined under custom params validated under the defaults")
+	}
+}
@@ -0,0 +1,94 @@
+package block
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// PING_FAILURE_LIMIT is how many pings in a row a neighbour may miss before
+// PingNeighbours drops it.
+const PING_FAILURE_LIMIT = 3
+
+type PingResponse struct {
+	Port uint16 `json:"port"`
+	// PublicKey is the node key, which announcements are checked against.
+	PublicKey string `json:"publicKey,omitempty"`
+}
+
+func (bc *Blockchain) ping(neighbour string) error {
+	client, _ := bc.peerClient()
+	resp, err := client.Get(fmt.Sprintf("http://%s/ping", neighbour))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// PingNeighbours pings every neighbour and drops those that have missed
+// PING_FAILURE_LIMIT pings in a row, including from the explicitly added,
+// persisted and announced peers, so they are not merged back on the next
+// rescan. A scanned neighbour that answers again is found by the next
+// rescan; one added with AddNeighbour must be added again. It returns the
+// neighbours dropped.
+func (bc *Blockchain) PingNeighbours() []string {
+	peers := bc.peers()
+	failed := make([]bool, len(peers))
+	var wg sync.WaitGroup
+	for i, n := range peers {
+		wg.Add(1)
+		go func(i int, n string) {
+			defer wg.Done()
+			if err := bc.ping(n); err != nil {
+				bc.logger.Debug("ping failed", "action", "ping", "peer", n, "err", err)
+				failed[i] = true
+			}
+		}(i, n)
+	}
+	wg.Wait()
+
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	if bc.pingFailures == nil {
+		bc.pingFailures = make(map[string]int)
+	}
+	dead := make(map[string]bool)
+	for i, n := range peers {
+		if !failed[i] {
+			delete(bc.pingFailures, n)
+			continue
+		}
+		bc.pingFailures[n]++
+		if bc.pingFailures[n] >= PING_FAILURE_LIMIT {
+			delete(bc.pingFailures, n)
+			dead[n] = true
+		}
+	}
+	if len(dead) == 0 {
+		return nil
+	}
+	bc.neighbours = withoutPeers(bc.neighbours, dead)
+	bc.explicitPeers = withoutPeers(bc.explicitPeers, dead)
+	bc.persistedPeers = withoutPeers(bc.persistedPeers, dead)
+	bc.announcedPeers = withoutPeers(bc.announcedPeers, dead)
+	removed := make([]string, 0, len(dead))
+	for n := range dead {
+		removed = append(removed, n)
+		bc.logger.Warn("dropped unresponsive neighbour", "action", "ping", "peer", n, "failures", PING_FAILURE_LIMIT)
+	}
+	return removed
+}
+
+func withoutPeers(peers []string, drop map[string]bool) []string {
+	kept := make([]string, 0, len(peers))
+	for _, p := range peers {
+		if !drop[p] {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
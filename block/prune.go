@@ -0,0 +1,185 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+)
+
+// pruneSnapshot is what Prune keeps of the blocks it collapses: the state
+// they leave behind and the hash of the last of them. Confirmed lists the
+// hashes of their transactions without a nonce, which must not be confirmed
+// again.
+type pruneSnapshot struct {
+	Height       int               `json:"height"`
+	Hash         string            `json:"hash"`
+	Balances     map[string]Amount `json:"balances"`
+	Nonces       map[string]uint64 `json:"nonces"`
+	Confirmed    []string          `json:"confirmed,omitempty"`
+	Transactions int               `json:"transactions"`
+}
+
+// start returns the first height to replay and copies of the balances and
+// nonces to replay from. A nil snapshot replays the whole chain from empty
+// state.
+func (s *pruneSnapshot) start() (from int, balances map[string]Amount, nonces map[string]uint64) {
+	balances = make(map[string]Amount)
+	nonces = make(map[string]uint64)
+	if s == nil {
+		return 0, balances, nonces
+	}
+	for addr, v := range s.Balances {
+		balances[addr] = v
+	}
+	for addr, n := range s.Nonces {
+		nonces[addr] = n
+	}
+	return s.Height + 1, balances, nonces
+}
+
+// confirmed returns a set of the hashes in s.Confirmed the caller may
+// modify. Hashes that do not parse are skipped.
+func (s *pruneSnapshot) confirmed() map[[32]byte]bool {
+	confirmed := make(map[[32]byte]bool)
+	if s == nil {
+		return confirmed
+	}
+	for _, h := range s.Confirmed {
+		if hash, err := ParseHash(h); err == nil {
+			confirmed[hash] = true
+		}
+	}
+	return confirmed
+}
+
+// hollow returns a copy of b's header without its transactions. It keeps
+// b's hash, which can no longer be recomputed.
+func (b *Block) hollow() *Block {
+	h := b.Hash()
+	return &Block{
+		Version:           b.Version,
+		Nonce:             b.Nonce,
+		PreviousHash:      b.PreviousHash,
+		Timestamp:         b.Timestamp,
+		Proposer:          b.Proposer,
+		ProposerPublicKey: b.ProposerPublicKey,
+		ProposerSignature: b.ProposerSignature,
+		Height:            b.Height,
+		MerkleRoot:        b.MerkleRoot,
+		pruned:            true,
+		hash:              &h,
+	}
+}
+
+// Pruned reports whether b has had its transactions dropped by Prune.
+func (b *Block) Pruned() bool {
+	return b.pruned
+}
+
+// Prune collapses every block more than keepDepth below the tip into a
+// snapshot of the balances and nonces they leave behind. Pruned blocks keep
+// their headers, so heights, hashes and difficulty are unaffected, but drop
+// their transactions; per-block statistics only cover the blocks kept.
+//
+// Afterwards the node only accepts chains that contain the last pruned
+// block, so keepDepth also bounds the deepest reorg it can follow, and
+// neighbours without the same snapshot cannot sync from it. Archive and UTXO
+// mode and proof-of-stake chains need the full history and cannot be pruned.
+func (bc *Blockchain) Prune(keepDepth int) error {
+	if keepDepth < 0 {
+		return fmt.Errorf("prune: negative keep depth %d", keepDepth)
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if bc.archive != nil {
+		return errors.New("prune: archive mode keeps the full history")
+	}
+	if bc.utxo != nil {
+		return errors.New("prune: utxo mode replays the full history")
+	}
+	if usesProofOfStake(bc.params) {
+		return errors.New("prune: proof of stake needs the full history")
+	}
+	height := len(bc.Chain) - 1 - keepDepth
+	from, balances, nonces := bc.snapshot.start()
+	if height < from {
+		return nil
+	}
+	transactions := 0
+	var confirmed []string
+	if bc.snapshot != nil {
+		transactions = bc.snapshot.Transactions
+		confirmed = append(confirmed, bc.snapshot.Confirmed...)
+	}
+	for h := from; h <= height; h++ {
+		b := bc.Chain[h]
+		applyBlock(balances, b)
+		recordNonces(nonces, b)
+		for _, t := range b.Transactions {
+			if t.Nonce == 0 && !bc.params.isCoinbase(t.SenderBlockchainAddress) {
+				confirmed = append(confirmed, fmt.Sprintf("%x", t.Hash()))
+			}
+		}
+		transactions += len(b.Transactions)
+		bc.Chain[h] = b.hollow()
+	}
+	bc.snapshot = &pruneSnapshot{
+		Height:       height,
+		Hash:         fmt.Sprintf("%x", bc.Chain[height].Hash()),
+		Balances:     balances,
+		Nonces:       nonces,
+		Confirmed:    confirmed,
+		Transactions: transactions,
+	}
+	bc.logger.Info("pruned chain", "action", "prune", "height", height, "pruned", height-from+1)
+	bc.persist()
+	return nil
+}
+
+// PrunedHeight returns the height of the last pruned block, or -1 if the
+// chain has not been pruned.
+func (bc *Blockchain) PrunedHeight() int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if bc.snapshot == nil {
+		return -1
+	}
+	return bc.snapshot.Height
+}
+
+// hollowPruned replaces the blocks of chain at or below the snapshot with
+// their headers, for a chain that may carry them in full.
+func (bc *Blockchain) hollowPruned(chain []*Block) {
+	if bc.snapshot == nil {
+		return
+	}
+	for h := 0; h <= bc.snapshot.Height; h++ {
+		if !chain[h].pruned {
+			chain[h] = chain[h].hollow()
+		}
+	}
+}
+
+// balancesBefore returns every address's balance once the blocks below
+// height are applied. The caller must hold bc.mux.
+func (bc *Blockchain) balancesBefore(height int) (map[string]Amount, error) {
+	from, balances, _ := bc.snapshot.start()
+	if height < from {
+		return nil, fmt.Errorf("height %d is pruned", height-1)
+	}
+	for _, b := range bc.Chain[from:height] {
+		applyBlock(balances, b)
+	}
+	return balances, nil
+}
+
+func usesProofOfStake(params NetworkParams) bool {
+	if params.Consensus == CONSENSUS_POS {
+		return true
+	}
+	for _, p := range params.Schedule {
+		if p.Consensus == CONSENSUS_POS {
+			return true
+		}
+	}
+	return false
+}
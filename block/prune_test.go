@@ -0,0 +1,96 @@
+package block
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestPrunedNodeRejectsReplayAfterReorg prunes the block holding a
+// nonce-less transfer, then adopts a longer fork. The transfer must still be
+// refused when replayed.
+func TestPrunedNodeRejectsReplayAfterReorg(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	tx := NewTransaction(alice.address, bob.address, COIN/2)
+	signature := alice.sign(t, tx)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, signature); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 3)
+	fork := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, fork, 2)
+
+	if err := bc.Prune(1); err != nil {
+		t.Fatal(err)
+	}
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer fork was not adopted")
+	}
+
+	replay := NewTransaction(alice.address, bob.address, COIN/2)
+	if err := bc.AddSignedTransactionE(replay, &alice.private.PublicKey, signature); !errors.Is(err, ErrReplayedTransaction) {
+		t.Fatalf("replay after the reorg: got %v, want ErrReplayedTransaction", err)
+	}
+}
+
+// TestPruneKeepsBalances prunes all but the last two blocks of a chain
+// with transfers on both sides of the cut. Balances, cached and replayed,
+// must be unchanged, the chain must keep its length and still verify, and
+// a longer fork from below the cut must be refused.
+func TestPruneKeepsBalances(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	early := forkBlockchain(t, bc, carol.address)
+	for _, to := range []string{bob.address, carol.address} {
+		if err := addNonced(t, bc, alice, to, COIN/4, 0); err != nil {
+			t.Fatal(err)
+		}
+		mineBlocks(t, bc, 2)
+	}
+	addresses := []string{alice.address, bob.address, carol.address}
+	before := make(map[string]Amount)
+	for _, addr := range addresses {
+		before[addr] = bc.Balance(addr)
+	}
+	length := bc.ChainLength()
+
+	if err := bc.Prune(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := bc.PrunedHeight(); got != length-3 {
+		t.Fatalf("pruned height %d, want %d", got, length-3)
+	}
+	if bc.ChainLength() != length {
+		t.Fatalf("chain length %d after pruning, want %d", bc.ChainLength(), length)
+	}
+	for _, addr := range addresses {
+		if got := bc.Balance(addr); got != before[addr] {
+			t.Errorf("cached balance %s after pruning, want %s", got, before[addr])
+		}
+		if got := bc.CalculateTotalAmount(addr); got != before[addr] {
+			t.Errorf("recomputed balance %s after pruning, want %s", got, before[addr])
+		}
+	}
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatalf("pruned chain: %v", err)
+	}
+
+	mineBlocks(t, early, length)
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, early)); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ResolveConflicts() {
+		t.Fatal("a fork from below the pruned height was adopted")
+	}
+	mineBlocks(t, bc, 1)
+	if got, want := bc.Balance(alice.address), before[alice.address]+MINING_REWARD; got != want {
+		t.Fatalf("balance after mining on the pruned chain %s, want %s", got, want)
+	}
+}
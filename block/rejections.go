@@ -0,0 +1,100 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"goblockchain/utils"
+	"time"
+)
+
+const REJECTION_HISTORY = 100
+
+// RejectionRecord is a refused transaction kept for inspection.
+type RejectionRecord struct {
+	Request *TransactionRequest
+	Reason  error
+	Time    time.Time
+}
+
+// OnTransactionRejected registers fn to be called with the offending request
+// and the reason (one of the Err* values) whenever a transaction is refused.
+func (bc *Blockchain) OnTransactionRejected(fn func(req *TransactionRequest, reason error)) {
+	bc.rejectionsMux.Lock()
+	defer bc.rejectionsMux.Unlock()
+	bc.onTransactionRejected = fn
+}
+
+// SetRejectionHistory sets how many of the most recent rejections
+// RecentRejections keeps. Zero keeps none.
+func (bc *Blockchain) SetRejectionHistory(n int) {
+	bc.rejectionsMux.Lock()
+	defer bc.rejectionsMux.Unlock()
+	bc.rejectionHistory = n
+	if len(bc.rejections) > n {
+		bc.rejections = bc.rejections[len(bc.rejections)-n:]
+	}
+}
+
+// RecentRejections returns the most recently refused transactions, oldest
+// first.
+func (bc *Blockchain) RecentRejections() []RejectionRecord {
+	bc.rejectionsMux.Lock()
+	defer bc.rejectionsMux.Unlock()
+	return append([]RejectionRecord(nil), bc.rejections...)
+}
+
+func (bc *Blockchain) rejectTransaction(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature, reason error) {
+	req := newTransactionRequest(t, senderPublicKey, s)
+	bc.rejectionsMux.Lock()
+	fn := bc.onTransactionRejected
+	bc.rejectionsMux.Unlock()
+	bc.recordRejection(RejectionRecord{Request: req, Reason: reason, Time: time.Now()})
+	if fn == nil {
+		return
+	}
+	fn(req, reason)
+}
+
+func (bc *Blockchain) recordRejection(r RejectionRecord) {
+	bc.rejectionsMux.Lock()
+	defer bc.rejectionsMux.Unlock()
+	if bc.rejectionHistory <= 0 {
+		return
+	}
+	if len(bc.rejections) >= bc.rejectionHistory {
+		bc.rejections = append(bc.rejections[:0], bc.rejections[len(bc.rejections)-bc.rejectionHistory+1:]...)
+	}
+	bc.rejections = append(bc.rejections, r)
+}
+
+func newTransactionRequest(t *Transaction, senderPublicKey *ecdsa.PublicKey, s *utils.Signature) *TransactionRequest {
+	sender := t.SenderBlockchainAddress
+	recipient := t.RecipientBlockchainAddress
+	value := t.Value
+	req := &TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: &recipient,
+		Value:                      &value,
+	}
+	if t.Fee != 0 {
+		fee := t.Fee
+		req.Fee = &fee
+	}
+	if t.Nonce != 0 {
+		nonce := t.Nonce
+		req.Nonce = &nonce
+	}
+	if t.RecentBlockHash != "" {
+		recent := t.RecentBlockHash
+		req.RecentBlockHash = &recent
+	}
+	if senderPublicKey != nil {
+		publicKeyStr := fmt.Sprintf("%064x%064x", senderPublicKey.X.Bytes(), senderPublicKey.Y.Bytes())
+		req.SenderPublicKey = &publicKeyStr
+	}
+	if s != nil {
+		signatureStr := s.String()
+		req.Signature = &signatureStr
+	}
+	return req
+}
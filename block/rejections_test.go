@@ -0,0 +1,94 @@
+package block
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOnTransactionRejected(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+
+	var requests []*TransactionRequest
+	var reasons []error
+	bc.OnTransactionRejected(func(req *TransactionRequest, reason error) {
+		requests = append(requests, req)
+		reasons = append(reasons, reason)
+	})
+
+	tx := NewTransaction(alice.address, bob.address, 2*MINING_REWARD)
+	err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx))
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Fatalf("got %v, want ErrInsufficientBalance", err)
+	}
+	if len(reasons) != 1 || !errors.Is(reasons[0], ErrInsufficientBalance) {
+		t.Fatalf("callback reasons %v, want one ErrInsufficientBalance", reasons)
+	}
+	req := requests[0]
+	if *req.SenderBlockchainAddress != alice.address || *req.RecipientBlockchainAddress != bob.address || *req.Value != 2*MINING_REWARD {
+		t.Fatalf("callback request does not describe the refused transaction")
+	}
+	if req.SenderPublicKey == nil || *req.SenderPublicKey != alice.publicKey() || req.Signature == nil {
+		t.Fatal("callback request lacks the key or signature")
+	}
+
+	ok := NewTransaction(alice.address, bob.address, COIN/10)
+	if err := bc.AddSignedTransactionE(ok, &alice.private.PublicKey, alice.sign(t, ok)); err != nil {
+		t.Fatal(err)
+	}
+	if len(reasons) != 1 {
+		t.Fatalf("callback fired %d times, want only for the refused transaction", len(reasons))
+	}
+}
+
+func TestRecentRejections(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+
+	overdraw := NewTransaction(alice.address, bob.address, 2*MINING_REWARD)
+	forged := NewTransaction(alice.address, bob.address, COIN)
+	negative := NewTransaction(alice.address, bob.address, -COIN)
+	for _, c := range []struct {
+		tx     *Transaction
+		signer testKey
+	}{
+		{overdraw, alice},
+		{forged, bob},
+		{negative, alice},
+	} {
+		if err := bc.AddSignedTransactionE(c.tx, &c.signer.private.PublicKey, c.signer.sign(t, c.tx)); err == nil {
+			t.Fatalf("transaction of %s was accepted", c.tx.Value)
+		}
+	}
+
+	want := []struct {
+		value  Amount
+		reason error
+	}{
+		{2 * MINING_REWARD, ErrInsufficientBalance},
+		{COIN, ErrSenderKeyMismatch},
+		{-COIN, ErrNegativeValue},
+	}
+	records := bc.RecentRejections()
+	if len(records) != len(want) {
+		t.Fatalf("%d rejections recorded, want %d", len(records), len(want))
+	}
+	for i, r := range records {
+		if *r.Request.Value != want[i].value || !errors.Is(r.Reason, want[i].reason) {
+			t.Errorf("rejection %d: value %s for %v, want %s for %v", i, *r.Request.Value, r.Reason, want[i].value, want[i].reason)
+		}
+	}
+
+	bc.SetRejectionHistory(2)
+	if records := bc.RecentRejections(); len(records) != 2 || *records[0].Request.Value != COIN {
+		t.Fatalf("after shrinking the history: %d rejections, want the last 2", len(records))
+	}
+	if err := bc.AddSignedTransactionE(overdraw, &alice.private.PublicKey, alice.sign(t, overdraw)); err == nil {
+		t.Fatal("overdraw was accepted")
+	}
+	if records := bc.RecentRejections(); len(records) != 2 || *records[0].Request.Value != -COIN || *records[1].Request.Value != 2*MINING_REWARD {
+		t.Fatal("a full history did not drop its oldest rejection")
+	}
+}
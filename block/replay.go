@@ -0,0 +1,69 @@
+package block
+
+import "fmt"
+
+const RECENT_BLOCK_WINDOW = 100
+
+// SetRequireRecentBlock makes the node refuse transactions that carry no
+// RecentBlockHash. Transactions that do carry one are always checked.
+func (bc *Blockchain) SetRequireRecentBlock(require bool) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.requireRecentBlock = require
+}
+
+// checkRecentBlockHash checks t's reference against the local chain. The
+// caller must hold bc.mux.
+func (bc *Blockchain) checkRecentBlockHash(t *Transaction) error {
+	if t.RecentBlockHash == "" {
+		if bc.requireRecentBlock {
+			return ErrMissingRecentBlock
+		}
+		return nil
+	}
+	window := bc.params.At(len(bc.Chain)).RecentBlockWindow
+	return checkBlockReference(blockHashes(bc.Chain), t.RecentBlockHash, window)
+}
+
+// verifyBlockReferences checks that every transaction's RecentBlockHash
+// names a block shortly before the one that includes it on this chain.
+func verifyBlockReferences(chain []*Block, params NetworkParams) error {
+	var hashes []string
+	for h := 1; h < len(chain); h++ {
+		for i, t := range chain[h].Transactions {
+			if t.RecentBlockHash == "" {
+				continue
+			}
+			if hashes == nil {
+				hashes = blockHashes(chain)
+			}
+			if err := checkBlockReference(hashes[:h], t.RecentBlockHash, params.At(h).RecentBlockWindow); err != nil {
+				return verifyErrorf(h, "transaction %d: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+func blockHashes(chain []*Block) []string {
+	hashes := make([]string, len(chain))
+	for i, b := range chain {
+		hashes[i] = fmt.Sprintf("%x", b.Hash())
+	}
+	return hashes
+}
+
+// checkBlockReference reports whether ref is one of the last window hashes.
+// A window of zero or less allows any of them.
+func checkBlockReference(hashes []string, ref string, window int) error {
+	for h := len(hashes) - 1; h >= 0; h-- {
+		if hashes[h] != ref {
+			continue
+		}
+		if window > 0 && len(hashes)-h > window {
+			return ErrStaleRecentBlock
+		}
+		return nil
+	}
+	return ErrUnknownRecentBlock
+}
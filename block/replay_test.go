@@ -0,0 +1,45 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRecentBlockReference(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	params := bc.Params()
+	params.RecentBlockWindow = 2
+	bc.SetParams(params)
+	mineBlocks(t, bc, 3)
+
+	add := func(ref string) error {
+		tx := NewTransaction(alice.address, bob.address, COIN/10)
+		tx.RecentBlockHash = ref
+		return bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx))
+	}
+	for _, c := range []struct {
+		name string
+		ref  string
+		want error
+	}{
+		{"tip", fmt.Sprintf("%x", bc.Chain[3].Hash()), nil},
+		{"within the window", fmt.Sprintf("%x", bc.Chain[2].Hash()), nil},
+		{"too old", fmt.Sprintf("%x", bc.Chain[1].Hash()), ErrStaleRecentBlock},
+		{"unknown", fmt.Sprintf("%x", [32]byte{1}), ErrUnknownRecentBlock},
+		{"none", "", nil},
+	} {
+		if err := add(c.ref); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	bc.SetRequireRecentBlock(true)
+	if err := add(""); !errors.Is(err, ErrMissingRecentBlock) {
+		t.Fatalf("required but missing: got %v, want ErrMissingRecentBlock", err)
+	}
+	if err := add(fmt.Sprintf("%x", bc.Chain[3].Hash())); err != nil {
+		t.Fatalf("required and present: %v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package block
+
+// RewardPolicy decides the coinbase reward paid for the block at height.
+type RewardPolicy interface {
+	Reward(height int) Amount
+}
+
+// ConstantReward pays the same reward at every height.
+type ConstantReward Amount
+
+func (r ConstantReward) Reward(height int) Amount {
+	return Amount(r)
+}
+
+// HalvingReward halves Base every Interval blocks.
+type HalvingReward struct {
+	Base     Amount `json:"base"`
+	Interval int    `json:"interval"`
+}
+
+func (r HalvingReward) Reward(height int) Amount {
+	if r.Interval <= 0 || height < 0 {
+		return r.Base
+	}
+	halvings := height / r.Interval
+	if halvings >= 64 {
+		return 0
+	}
+	return r.Base >> uint(halvings)
+}
+
+// SetRewardHalving pays base for the block at height 0 and halves it every
+// interval blocks; an interval of 0 pays base at every height. Every node of
+// a network must agree on it.
+func (bc *Blockchain) SetRewardHalving(base Amount, interval int) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.params.RewardPolicy = HalvingReward{Base: base, Interval: interval}
+}
+
+// RewardAt returns the coinbase reward, before fees, for the block at
+// height.
+func (bc *Blockchain) RewardAt(height int) Amount {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return bc.params.At(height).Reward(height)
+}
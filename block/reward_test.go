@@ -0,0 +1,130 @@
+package block
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRewardPolicies(t *testing.T) {
+	constant := ConstantReward(5 * COIN)
+	halving := HalvingReward{Base: 8 * COIN, Interval: 10}
+	for _, tc := range []struct {
+		height            int
+		constant, halving Amount
+	}{
+		{0, 5 * COIN, 8 * COIN},
+		{9, 5 * COIN, 8 * COIN},
+		{10, 5 * COIN, 4 * COIN},
+		{25, 5 * COIN, 2 * COIN},
+		{30, 5 * COIN, 1 * COIN},
+		{1000000, 5 * COIN, 0},
+	} {
+		if got := constant.Reward(tc.height); got != tc.constant {
+			t.Errorf("constant reward at %d: %s, want %s", tc.height, got, tc.constant)
+		}
+		if got := halving.Reward(tc.height); got != tc.halving {
+			t.Errorf("halving reward at %d: %s, want %s", tc.height, got, tc.halving)
+		}
+	}
+}
+
+// TestMiningReadsRewardPolicy mines under a constant policy other than the
+// default and checks the coinbase and validation both follow it.
+func TestMiningReadsRewardPolicy(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	params := bc.Params()
+	params.RewardPolicy = ConstantReward(3 * COIN)
+	bc.SetParams(params)
+	mineBlocks(t, bc, 2)
+
+	if got := bc.Chain[2].Transactions[0].Value; got != 3*COIN {
+		t.Fatalf("coinbase %s, want %s", got, 3*COIN)
+	}
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+	// A node paying the default reward would overpay under this policy.
+	bc.Chain[2].Transactions[0].Value = 4 * COIN
+	bc.Chain[2].invalidateHash()
+	if err := verifyChain(bc.Chain, bc.genesisHash, params, nil); err == nil {
+		t.Fatal("a coinbase above the policy's reward passed validation")
+	}
+}
+
+// TestScheduledRewardChange schedules a new reward from height 10. Blocks on
+// either side must pay their own height's reward, and a block before the
+// switch paying the new reward must fail validation.
+func TestScheduledRewardChange(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	params := bc.Params()
+	upgraded := params
+	upgraded.RewardPolicy = ConstantReward(2 * MINING_REWARD)
+	params.Schedule = ParamSchedule{10: upgraded}
+	bc.SetParams(params)
+	mineBlocks(t, bc, 12)
+
+	for height := 1; height <= 12; height++ {
+		want := MINING_REWARD
+		if height >= 10 {
+			want = 2 * MINING_REWARD
+		}
+		if got := bc.RewardAt(height); got != want {
+			t.Errorf("RewardAt(%d) = %s, want %s", height, got, want)
+		}
+		if got := bc.Chain[height].Transactions[0].Value; got != want {
+			t.Errorf("block %d pays %s, want %s", height, got, want)
+		}
+	}
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+
+	params = bc.Params()
+	early := append(cloneChain(t, bc.Chain[:9]), nil)
+	early[9] = sealBlock(early[:9], []*Transaction{NewTransaction(params.MiningSender(), miner.address, 2*MINING_REWARD)}, params.Difficulty)
+	err := VerifyChain(early, bc.Chain[0].Hash(), params)
+	var be *BlockError
+	if !errors.As(err, &be) || be.Height != 9 {
+		t.Fatalf("got %v, want an error for block 9", err)
+	}
+}
+
+// TestRewardAt configures halving on a chain and mines until the reward,
+// halved in whole units, rounds down to zero. Each coinbase must pay what
+// RewardAt reports for its height.
+func TestRewardAt(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	bc.SetRewardHalving(COIN, 210000)
+	for _, tc := range []struct {
+		height int
+		want   Amount
+	}{
+		{0, COIN},
+		{209999, COIN},
+		{210000, COIN / 2},
+		{420000, COIN / 4},
+		{64 * 210000, 0},
+	} {
+		if got := bc.RewardAt(tc.height); got != tc.want {
+			t.Errorf("RewardAt(%d) = %s, want %s", tc.height, got, tc.want)
+		}
+	}
+
+	bc.SetRewardHalving(5, 2)
+	want := []Amount{5, 5, 2, 2, 1, 1, 0, 0}
+	for height, reward := range want {
+		if got := bc.RewardAt(height); got != reward {
+			t.Errorf("RewardAt(%d) = %s, want %s", height, got, reward)
+		}
+	}
+	mineBlocks(t, bc, len(want)-1)
+	for height := 1; height < len(want); height++ {
+		if got := bc.Chain[height].Transactions[0].Value; got != want[height] {
+			t.Errorf("coinbase at height %d pays %s, want %s", height, got, want[height])
+		}
+	}
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,67 @@
+package block
+
+// SetSenderDenylist refuses transactions from the given addresses. A nil or
+// empty list clears it.
+func (bc *Blockchain) SetSenderDenylist(addresses []string) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.senderDenylist = addressSet(addresses)
+}
+
+// SetSenderAllowlist only accepts transactions from the given addresses. A
+// nil or empty list turns allowlist mode off.
+func (bc *Blockchain) SetSenderAllowlist(addresses []string) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.senderAllowlist = addressSet(addresses)
+}
+
+// SetStrictSenderPolicy makes ValidChain also reject chains that contain
+// transactions from senders the lists would refuse.
+func (bc *Blockchain) SetStrictSenderPolicy(strict bool) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.strictSenderPolicy = strict
+}
+
+func addressSet(addresses []string) map[string]bool {
+	if len(addresses) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(addresses))
+	for _, a := range addresses {
+		set[a] = true
+	}
+	return set
+}
+
+func (bc *Blockchain) senderPermitted(sender string) bool {
+	return senderPermitted(sender, bc.senderDenylist, bc.senderAllowlist)
+}
+
+func senderPermitted(sender string, denylist, allowlist map[string]bool) bool {
+	if denylist[sender] {
+		return false
+	}
+	if allowlist != nil && !allowlist[sender] {
+		return false
+	}
+	return true
+}
+
+// verifySenders checks that the lists permit every sender in chain. The
+// lists are replaced rather than modified, so they may be used without
+// bc.mux once read.
+func verifySenders(chain []*Block, params NetworkParams, denylist, allowlist map[string]bool) error {
+	for height, b := range chain {
+		for _, t := range b.Transactions {
+			if params.isCoinbase(t.SenderBlockchainAddress) {
+				continue
+			}
+			if !senderPermitted(t.SenderBlockchainAddress, denylist, allowlist) {
+				return verifyErrorf(height, "%s: %w", t.SenderBlockchainAddress, ErrSenderNotPermitted)
+			}
+		}
+	}
+	return nil
+}
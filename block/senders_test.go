@@ -0,0 +1,52 @@
+package block
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSenderLists(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	keys := fundedKeys(t, bc, 3)
+	alice, bob, carol := keys[0], keys[1], keys[2]
+	send := func(from testKey) error {
+		return addNonced(t, bc, from, carol.address, COIN/10, 0)
+	}
+
+	bc.SetSenderDenylist([]string{alice.address})
+	if err := send(alice); !errors.Is(err, ErrSenderNotPermitted) {
+		t.Fatalf("denylisted sender: got %v, want ErrSenderNotPermitted", err)
+	}
+	if err := send(bob); err != nil {
+		t.Fatalf("sender not on the denylist: %v", err)
+	}
+
+	bc.SetSenderDenylist(nil)
+	bc.SetSenderAllowlist([]string{alice.address})
+	if err := send(alice); err != nil {
+		t.Fatalf("allowlisted sender: %v", err)
+	}
+	if err := send(carol); !errors.Is(err, ErrSenderNotPermitted) {
+		t.Fatalf("sender not on the allowlist: got %v, want ErrSenderNotPermitted", err)
+	}
+
+	// A chain confirming bob's transfer is only refused in strict mode.
+	mineBlocks(t, bc, 1)
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatalf("lenient mode: %v", err)
+	}
+	bc.mux.RLock()
+	valid := bc.ValidChain(bc.Chain)
+	bc.mux.RUnlock()
+	if !valid {
+		t.Fatal("lenient mode refused a chain with a sender off the allowlist")
+	}
+	bc.SetStrictSenderPolicy(true)
+	if err := bc.VerifyOwnChain(); err == nil {
+		t.Fatal("strict mode accepted a chain with a sender off the allowlist")
+	}
+	bc.SetSenderAllowlist(nil)
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatalf("strict mode without lists: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package block
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+const SHORT_HASH_WIDTH = 8
+
+var shortHashWidth int32 = SHORT_HASH_WIDTH
+
+// SetShortHashWidth sets how many hex characters ShortHash keeps, between 1
+// and 64.
+func SetShortHashWidth(width int) {
+	if width < 1 {
+		width = 1
+	}
+	if width > 64 {
+		width = 64
+	}
+	atomic.StoreInt32(&shortHashWidth, int32(width))
+}
+
+// ShortHash abbreviates h for logs and display. Abbreviations can collide,
+// so anything that identifies a block or transaction must use the full hash.
+func ShortHash(h [32]byte) string {
+	return fmt.Sprintf("%x", h)[:atomic.LoadInt32(&shortHashWidth)]
+}
@@ -0,0 +1,35 @@
+package block
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestShortHash(t *testing.T) {
+	defer SetShortHashWidth(SHORT_HASH_WIDTH)
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	h := bc.LastBlock().Hash()
+	full := fmt.Sprintf("%x", h)
+
+	for _, c := range []struct{ width, want int }{
+		{SHORT_HASH_WIDTH, SHORT_HASH_WIDTH},
+		{4, 4},
+		{0, 1},
+		{64, 64},
+		{100, 64},
+	} {
+		SetShortHashWidth(c.width)
+		short := ShortHash(h)
+		if len(short) != c.want || !strings.HasPrefix(full, short) {
+			t.Errorf("width %d: ShortHash = %q, want the first %d characters of %s", c.width, short, c.want, full)
+		}
+	}
+
+	// Truncation is for display only; hashes stay whole everywhere else.
+	SetShortHashWidth(4)
+	if len(h) != 32 || len(bc.Tip().Hash) != 64 {
+		t.Errorf("full hash is %d bytes and tip hash %d characters", len(h), len(bc.Tip().Hash))
+	}
+}
@@ -0,0 +1,73 @@
+package block
+
+// SetMaxPendingPerSender caps how many transactions one sender may have in
+// the pool at once. Zero disables the cap.
+func (bc *Blockchain) SetMaxPendingPerSender(n int) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.maxPendingPerSender = n
+}
+
+// SetCycleDetectionDepth sets the longest ring of equal-value pooled
+// transactions (A->B->C->...->A) that is rejected as zero-sum spam. A
+// two-party exchange (A->B->A) is an ordinary refund and never counts, so
+// values below 3 disable the check.
+func (bc *Blockchain) SetCycleDetectionDepth(depth int) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.cycleDetectionDepth = depth
+}
+
+func (bc *Blockchain) checkSpam(t *Transaction) error {
+	if bc.maxPendingPerSender > 0 {
+		// Transactions queued behind a nonce gap are pending too.
+		pending := len(bc.gapped[t.SenderBlockchainAddress])
+		if _, ok := bc.gapped[t.SenderBlockchainAddress][t.Nonce]; ok {
+			pending--
+		}
+		for _, p := range bc.TransactionPool {
+			if p.SenderBlockchainAddress == t.SenderBlockchainAddress {
+				pending++
+			}
+		}
+		if pending >= bc.maxPendingPerSender {
+			return ErrTooManyPending
+		}
+	}
+	if bc.cycleDetectionDepth >= 3 && bc.closesCycle(t) {
+		return ErrTransactionCycle
+	}
+	return nil
+}
+
+// closesCycle reports whether adding t completes a ring of three to
+// cycleDetectionDepth pooled transfers of the same value that starts and
+// ends at t's sender.
+func (bc *Blockchain) closesCycle(t *Transaction) bool {
+	target := t.SenderBlockchainAddress
+	visited := map[string]bool{t.RecipientBlockchainAddress: true}
+	frontier := []string{t.RecipientBlockchainAddress}
+	for hops := 1; hops < bc.cycleDetectionDepth && len(frontier) > 0; hops++ {
+		var next []string
+		for _, addr := range frontier {
+			for _, p := range bc.TransactionPool {
+				if p.SenderBlockchainAddress != addr || p.Value != t.Value {
+					continue
+				}
+				if p.RecipientBlockchainAddress == target {
+					// One hop back to the sender is a refund.
+					if hops >= 2 {
+						return true
+					}
+					continue
+				}
+				if !visited[p.RecipientBlockchainAddress] {
+					visited[p.RecipientBlockchainAddress] = true
+					next = append(next, p.RecipientBlockchainAddress)
+				}
+			}
+		}
+		frontier = next
+	}
+	return false
+}
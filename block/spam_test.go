@@ -0,0 +1,57 @@
+package block
+
+import (
+	"errors"
+	"testing"
+)
+
+// fundedKeys returns n keys that each hold one mining reward on bc.
+func fundedKeys(t *testing.T, bc *Blockchain, n int) []testKey {
+	t.Helper()
+	keys := make([]testKey, n)
+	for i := range keys {
+		keys[i] = newTestKey(t)
+		if _, err := bc.MineTo(keys[i].address); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys
+}
+
+func TestThreePartyCycleIsRejected(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	keys := fundedKeys(t, bc, 3)
+	a, b, c := keys[0], keys[1], keys[2]
+
+	if err := addNonced(t, bc, a, b.address, COIN/2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, b, c.address, COIN/2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, c, a.address, COIN/2, 0); !errors.Is(err, ErrTransactionCycle) {
+		t.Fatalf("closing A->B->C->A: got %v, want ErrTransactionCycle", err)
+	}
+	// A different value does not close the ring.
+	if err := addNonced(t, bc, c, a.address, COIN/4, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	bc.SetCycleDetectionDepth(2)
+	if err := addNonced(t, bc, c, a.address, COIN/2, 0); err != nil {
+		t.Fatalf("depth 2 still rejects a three-party cycle: %v", err)
+	}
+}
+
+func TestRefundIsNotACycle(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	keys := fundedKeys(t, bc, 2)
+	a, b := keys[0], keys[1]
+
+	if err := addNonced(t, bc, a, b.address, COIN/2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := addNonced(t, bc, b, a.address, COIN/2, 0); err != nil {
+		t.Fatalf("refund rejected: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package block
+
+import "time"
+
+const STALE_TIP_THRESHOLD = 10 * time.Minute
+
+// TipAge is how long ago the last block was timestamped.
+func (bc *Blockchain) TipAge() time.Duration {
+	return time.Since(time.Unix(0, bc.LastBlock().Timestamp))
+}
+
+// SetStaleTipThreshold sets the tip age past which OnStaleTip fires. Zero
+// disables the check.
+func (bc *Blockchain) SetStaleTipThreshold(d time.Duration) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.staleTipThreshold = d
+}
+
+// OnStaleTip registers fn to be called with the tip's age when no block has
+// arrived for longer than the stale tip threshold. It fires once per tip.
+func (bc *Blockchain) OnStaleTip(fn func(age time.Duration)) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.onStaleTip = fn
+}
+
+// CheckStaleTip reports whether the tip is stale, firing OnStaleTip the
+// first time a given tip is found to be. It runs with every neighbour sync.
+func (bc *Blockchain) CheckStaleTip() bool {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if bc.staleTipThreshold <= 0 {
+		return false
+	}
+	last := bc.lastBlock()
+	age := time.Since(time.Unix(0, last.Timestamp))
+	if age <= bc.staleTipThreshold {
+		return false
+	}
+	tip := last.Hash()
+	if tip != bc.staleTipAlerted {
+		bc.staleTipAlerted = tip
+		bc.logger.Warn("chain tip is stale", "height", len(bc.Chain)-1, "age", age)
+		if bc.onStaleTip != nil {
+			bc.onStaleTip(age)
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStaleTip(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	mineBlocks(t, bc, 1)
+
+	var ages []time.Duration
+	bc.OnStaleTip(func(age time.Duration) { ages = append(ages, age) })
+	if bc.CheckStaleTip() {
+		t.Fatal("stale with the check disabled")
+	}
+	bc.SetStaleTipThreshold(time.Minute)
+	if bc.CheckStaleTip() {
+		t.Fatal("a fresh tip is stale")
+	}
+
+	bc.mux.Lock()
+	bc.lastBlock().Timestamp = time.Now().Add(-time.Hour).UnixNano()
+	bc.mux.Unlock()
+	if age := bc.TipAge(); age < time.Hour {
+		t.Fatalf("TipAge = %v, want at least an hour", age)
+	}
+	if !bc.CheckStaleTip() || !bc.CheckStaleTip() {
+		t.Fatal("an hour-old tip is not stale")
+	}
+	if len(ages) != 1 || ages[0] < time.Hour {
+		t.Fatalf("OnStaleTip fired with %v, want once with the tip's age", ages)
+	}
+
+	mineBlocks(t, bc, 1)
+	if bc.CheckStaleTip() {
+		t.Fatal("stale after a new block")
+	}
+}
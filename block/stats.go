@@ -0,0 +1,54 @@
+package block
+
+import "time"
+
+const STATS_RECENT_BLOCKS = 10
+
+type Stats struct {
+	Height              int   `json:"height"`
+	Synced              bool  `json:"synced"`
+	TotalTransactions   int   `json:"totalTransactions"`
+	PendingTransactions int   `json:"pendingTransactions"`
+	Difficulty          int   `json:"difficulty"`
+	LastBlockTimestamp  int64 `json:"lastBlockTimestamp"`
+	// TotalMined is every coinbase payout, block fees included.
+	TotalMined        Amount   `json:"totalMined"`
+	TotalFees         Amount   `json:"totalFees"`
+	RecentBlockFees   []Amount `json:"recentBlockFees"`
+	EstimatedHashRate float64  `json:"estimatedHashRate"`
+	// AverageConfirmationTime and AverageConfirmationBlocks describe how
+	// long recently mined transactions waited in this node's pool.
+	AverageConfirmationTime   time.Duration `json:"averageConfirmationTime"`
+	AverageConfirmationBlocks float64       `json:"averageConfirmationBlocks"`
+	Neighbours                int           `json:"neighbours"`
+}
+
+func (bc *Blockchain) Stats() *Stats {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	s := &Stats{
+		Height:              len(bc.Chain) - 1,
+		Synced:              bc.synced,
+		TotalTransactions:   bc.totalTransactions,
+		RecentBlockFees:     make([]Amount, 0, STATS_RECENT_BLOCKS),
+		EstimatedHashRate:   estimateHashRate(bc.Chain, bc.Difficulty),
+		PendingTransactions: len(bc.TransactionPool),
+		Difficulty:          bc.Difficulty,
+		LastBlockTimestamp:  bc.lastBlock().Timestamp,
+		Neighbours:          len(bc.peers()),
+	}
+	s.AverageConfirmationTime, s.AverageConfirmationBlocks = bc.averageConfirmation()
+	for i, b := range bc.Chain {
+		for _, t := range b.Transactions {
+			if t.SenderBlockchainAddress == bc.params.MiningSender() {
+				s.TotalMined += t.Value
+			}
+		}
+		fees := blockFees(b, bc.params)
+		s.TotalFees += fees
+		if i >= len(bc.Chain)-STATS_RECENT_BLOCKS {
+			s.RecentBlockFees = append(s.RecentBlockFees, fees)
+		}
+	}
+	return s
+}
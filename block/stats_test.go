@@ -0,0 +1,44 @@
+package block
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	before := bc.Stats()
+	mineBlocks(t, bc, 2)
+	if err := addNonced(t, bc, alice, bob.address, COIN/10, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	s := bc.Stats()
+	if s.Height != before.Height+2 {
+		t.Errorf("height %d after mining two blocks, want %d", s.Height, before.Height+2)
+	}
+	if s.PendingTransactions != 1 {
+		t.Errorf("%d pending transactions, want 1", s.PendingTransactions)
+	}
+	if s.TotalMined != before.TotalMined+2*MINING_REWARD {
+		t.Errorf("total mined %s, want %s", s.TotalMined, before.TotalMined+2*MINING_REWARD)
+	}
+	if s.Difficulty != 1 || s.LastBlockTimestamp != bc.LastBlock().Timestamp {
+		t.Errorf("difficulty %d and last timestamp %d do not describe the tip", s.Difficulty, s.LastBlockTimestamp)
+	}
+
+	m, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(m, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"height", "pendingTransactions", "difficulty", "totalMined", "lastBlockTimestamp"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("stats JSON lacks %q", name)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package block
+
+import (
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+type BlockSummary struct {
+	Height           int    `json:"height"`
+	Hash             string `json:"hash"`
+	Timestamp        int64  `json:"timestamp"`
+	TransactionCount int    `json:"transactionCount"`
+	Miner            string `json:"miner"`
+}
+
+func summarizeBlock(b *Block, height int, miningSender string) BlockSummary {
+	s := BlockSummary{
+		Height:           height,
+		Hash:             fmt.Sprintf("%x", b.Hash()),
+		Timestamp:        b.Timestamp,
+		TransactionCount: len(b.Transactions),
+	}
+	for _, t := range b.Transactions {
+		if t.SenderBlockchainAddress == miningSender {
+			s.Miner = t.RecipientBlockchainAddress
+			break
+		}
+	}
+	return s
+}
+
+// ChainSummary returns summaries of up to limit blocks starting at height
+// offset, along with the chain length for pagination.
+func (bc *Blockchain) ChainSummary(offset, limit int) ([]BlockSummary, int, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	total := len(bc.Chain)
+	if offset < 0 || offset > total {
+		return nil, total, fmt.Errorf("offset %d out of range [0, %d]", offset, total)
+	}
+	if limit <= 0 {
+		return nil, total, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	summaries := make([]BlockSummary, 0, end-offset)
+	for i := offset; i < end; i++ {
+		summaries = append(summaries, summarizeBlock(bc.Chain[i], i, bc.params.MiningSender()))
+	}
+	return summaries, total, nil
+}
+
+// MAX_BLOCKS_PAGE caps how many blocks GetBlocks returns at once.
+const MAX_BLOCKS_PAGE = 100
+
+// GetBlocks returns up to limit blocks starting at height offset, in height
+// order. A limit above MAX_BLOCKS_PAGE is cut to it.
+func (bc *Blockchain) GetBlocks(offset, limit int) ([]*Block, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	total := len(bc.Chain)
+	if offset < 0 || offset > total {
+		return nil, fmt.Errorf("offset %d out of range [0, %d]", offset, total)
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("limit must be positive, got %d", limit)
+	}
+	if limit > MAX_BLOCKS_PAGE {
+		limit = MAX_BLOCKS_PAGE
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	blocks := make([]*Block, end-offset)
+	copy(blocks, bc.Chain[offset:end])
+	return blocks, nil
+}
+
+// ChainLength returns the number of blocks in the chain, genesis included.
+func (bc *Blockchain) ChainLength() int {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return len(bc.Chain)
+}
+
+// BlocksInTimeRange returns the blocks timestamped within [from, to], in
+// chain order. Block timestamps never decrease along a valid chain, so the
+// bounds are found by binary search.
+func (bc *Blockchain) BlocksInTimeRange(from, to int64) []*Block {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if from > to {
+		return nil
+	}
+	start := sort.Search(len(bc.Chain), func(i int) bool { return bc.Chain[i].Timestamp >= from })
+	end := sort.Search(len(bc.Chain), func(i int) bool { return bc.Chain[i].Timestamp > to })
+	if start >= end {
+		return nil
+	}
+	return append([]*Block(nil), bc.Chain[start:end]...)
+}
+
+// GetBlockByHash returns the block with the given hash and its height.
+func (bc *Blockchain) GetBlockByHash(hash [32]byte) (*Block, int, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	for i, b := range bc.Chain {
+		if b.Hash() == hash {
+			return b, i, nil
+		}
+	}
+	return nil, 0, ErrBlockNotFound
+}
+
+// ParseHash decodes a block hash written as hex, as in previousHash.
+func ParseHash(s string) ([32]byte, error) {
+	var hash [32]byte
+	h, err := hex.DecodeString(s)
+	if err != nil {
+		return hash, fmt.Errorf("invalid hash %q: %v", s, err)
+	}
+	if len(h) != len(hash) {
+		return hash, fmt.Errorf("invalid hash %q: want %d bytes, got %d", s, len(hash), len(h))
+	}
+	copy(hash[:], h)
+	return hash, nil
+}
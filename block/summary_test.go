@@ -0,0 +1,104 @@
+package block
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBlocksInTimeRange(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	mineBlocks(t, bc, 4)
+	ts := make([]int64, len(bc.Chain))
+	for i, b := range bc.Chain {
+		ts[i] = b.Timestamp
+	}
+
+	heights := func(blocks []*Block) []int {
+		var hs []int
+		for _, b := range blocks {
+			for i, c := range bc.Chain {
+				if b == c {
+					hs = append(hs, i)
+				}
+			}
+		}
+		return hs
+	}
+	type rangeCase struct {
+		name     string
+		from, to int64
+		want     []int
+	}
+	cases := []rangeCase{
+		{"whole chain", ts[0], ts[4], []int{0, 1, 2, 3, 4}},
+		{"inclusive bounds", ts[1], ts[3], []int{1, 2, 3}},
+		{"single block", ts[2], ts[2], []int{2}},
+		{"before genesis", ts[0] - 10, ts[0] - 1, nil},
+		{"after tip", ts[4] + 1, ts[4] + 10, nil},
+		{"reversed", ts[3], ts[1], nil},
+	}
+	// Median time past may put a block a single nanosecond after its parent.
+	if ts[3]-ts[2] >= 2 {
+		cases = append(cases, rangeCase{"between blocks", ts[2] + 1, ts[3] - 1, nil})
+	}
+	for _, tt := range cases {
+		got := heights(bc.BlocksInTimeRange(tt.from, tt.to))
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: heights %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: heights %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestChainSummary(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 3)
+	tx := NewTransaction(alice.address, bob.address, COIN/2)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bc.MineTo(bob.address); err != nil {
+		t.Fatal(err)
+	}
+
+	page, total, err := bc.ChainSummary(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 5 || len(page) != 2 {
+		t.Fatalf("%d summaries of %d blocks, want 2 of 5", len(page), total)
+	}
+	for i, want := range []BlockSummary{
+		{Height: 2, Hash: fmt.Sprintf("%x", bc.Chain[2].Hash()), Timestamp: bc.Chain[2].Timestamp, TransactionCount: 1, Miner: alice.address},
+		{Height: 3, Hash: fmt.Sprintf("%x", bc.Chain[3].Hash()), Timestamp: bc.Chain[3].Timestamp, TransactionCount: 1, Miner: alice.address},
+	} {
+		if page[i] != want {
+			t.Errorf("summary %d: %+v, want %+v", i, page[i], want)
+		}
+	}
+
+	// The last page is cut short.
+	page, _, err = bc.ChainSummary(3, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != 2 || page[1].Height != 4 || page[1].TransactionCount != 2 || page[1].Miner != bob.address {
+		t.Fatalf("last page %+v, want blocks 3 and 4 with block 4 mined by bob", page)
+	}
+	// An offset at the end gives an empty page.
+	if page, _, err := bc.ChainSummary(5, 1); err != nil || len(page) != 0 {
+		t.Fatalf("offset at the end: %v, %v; want an empty page", page, err)
+	}
+	for _, tc := range []struct{ offset, limit int }{{-1, 1}, {6, 1}, {0, 0}, {0, -1}} {
+		if _, total, err := bc.ChainSummary(tc.offset, tc.limit); err == nil || total != 5 {
+			t.Errorf("ChainSummary(%d, %d): total %d, err %v; want 5 and an error", tc.offset, tc.limit, total, err)
+		}
+	}
+}
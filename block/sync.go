@@ -0,0 +1,164 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+type TipResponse struct {
+	Height int    `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+func (bc *Blockchain) Tip() *TipResponse {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	return &TipResponse{
+		Height: len(bc.Chain) - 1,
+		Hash:   fmt.Sprintf("%x", bc.lastBlock().Hash()),
+	}
+}
+
+// IsSynced reports whether the local tip is at least as high as the tips
+// reported by the majority of reachable neighbours.
+func (bc *Blockchain) IsSynced() bool {
+	height := bc.Tip().Height
+	responded, ahead := 0, 0
+	for _, n := range bc.peers() {
+		tip, err := bc.fetchTip(n)
+		if err != nil {
+			bc.logger.Warn("fetch tip failed", "peer", n, "err", err)
+			continue
+		}
+		responded++
+		if tip.Height > height {
+			ahead++
+		}
+	}
+	synced := ahead*2 <= responded || responded == 0
+	bc.mux.Lock()
+	bc.synced = synced
+	bc.mux.Unlock()
+	return synced
+}
+
+// CatchUp resolves conflicts immediately when the node is behind its
+// neighbours rather than waiting for the next sync cycle.
+func (bc *Blockchain) CatchUp() bool {
+	if bc.IsSynced() {
+		return false
+	}
+	bc.logger.Info("node out of sync", "action", "catch_up", "height", bc.Tip().Height)
+	replaced := bc.ResolveConflicts()
+	if replaced {
+		bc.IsSynced()
+	}
+	return replaced
+}
+
+func (bc *Blockchain) fetchTip(neighbour string) (*TipResponse, error) {
+	client, _ := bc.peerClient()
+	resp, err := client.Get(fmt.Sprintf("http://%s/tip", neighbour))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var tip TipResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tip); err != nil {
+		return nil, err
+	}
+	return &tip, nil
+}
+
+func (bc *Blockchain) fetchChain(neighbour string) ([]*Block, error) {
+	client, maxBytes := bc.peerClient()
+	resp, err := client.Get(fmt.Sprintf("http://%s/chain", neighbour))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBytes {
+		return nil, fmt.Errorf("response larger than %d bytes", maxBytes)
+	}
+	var bcResp Blockchain
+	if err := json.Unmarshal(body, &bcResp); err != nil {
+		return nil, err
+	}
+	// Callers compare tips before validating, so never hand them an empty
+	// chain or a null block.
+	if len(bcResp.Chain) == 0 {
+		return nil, errors.New("empty chain")
+	}
+	for i, b := range bcResp.Chain {
+		if b == nil {
+			return nil, fmt.Errorf("block %d is null", i)
+		}
+	}
+	return bcResp.Chain, nil
+}
+
+// SetPrimary turns the node into a read replica of primary: it stops mining,
+// talks to no other peers and mirrors the primary's chain whenever it
+// validates, even if that chain is not longer than the local one.
+func (bc *Blockchain) SetPrimary(primary string) {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	bc.primary = primary
+}
+
+func (bc *Blockchain) IsReplica() bool {
+	return bc.primaryPeer() != ""
+}
+
+func (bc *Blockchain) primaryPeer() string {
+	bc.muxNeighbours.Lock()
+	defer bc.muxNeighbours.Unlock()
+	return bc.primary
+}
+
+func (bc *Blockchain) followPrimary() bool {
+	primary := bc.primaryPeer()
+	chain, err := bc.fetchChain(primary)
+	if err != nil {
+		bc.logger.Warn("fetch chain failed", "peer", primary, "err", err)
+		bc.recordPeerFailure(primary)
+		return false
+	}
+	bc.recordPeerSuccess(primary)
+	// As in ResolveConflicts, the chain is validated without the write lock.
+	bc.mux.RLock()
+	rules := bc.chainRules()
+	bc.mux.RUnlock()
+	if !rules.valid(chain, bc.logger) {
+		return false
+	}
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if bc.snapshot != rules.snapshot {
+		return false
+	}
+	if len(chain) == len(bc.Chain) && chain[len(chain)-1].Hash() == bc.lastBlock().Hash() {
+		return false
+	}
+	bc.replaceChain(chain)
+	bc.logger.Info("followed primary", "action", "follow_primary", "peer", primary, "height", len(bc.Chain)-1)
+	return true
+}
+
+func (bc *Blockchain) StartFollowing() {
+	bc.repeat(time.Second*BLOCKCHAIN_NEIGHBOUR_SYNC_TIME_SEC, func() { bc.followPrimary() })
+}
@@ -0,0 +1,443 @@
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestResolveConflictsSkipsBadPeers resolves against a peer that never
+// answers, one that fails with 500 and one that is unreachable, beside one
+// serving a longer valid chain. The bad peers must cost at most the HTTP
+// timeout and the valid chain must still be adopted.
+func TestResolveConflictsSkipsBadPeers(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	fork := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, fork, 3)
+
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer hanging.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	bad := []string{
+		strings.TrimPrefix(hanging.URL, "http://"),
+		strings.TrimPrefix(failing.URL, "http://"),
+		strings.TrimPrefix(closed.URL, "http://"),
+	}
+	bc.SetNeighbourScan(false)
+	for _, p := range append(bad, servePeer(t, fork)) {
+		if err := bc.AddNeighbour(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const timeout = 200 * time.Millisecond
+	bc.SetHTTPTimeout(timeout)
+
+	start := time.Now()
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer valid chain was not adopted")
+	}
+	// Peers are fetched one after another, so allow one timeout each and
+	// some slack.
+	if elapsed := time.Since(start); elapsed > 4*timeout+time.Second {
+		t.Fatalf("resolving took %v", elapsed)
+	}
+	if got, want := bc.LastBlock().Hash(), fork.LastBlock().Hash(); got != want {
+		t.Fatalf("tip %x, want the fork's %x", got, want)
+	}
+	failures := bc.PeerFailures()
+	for _, p := range bad {
+		if failures[p] == 0 {
+			t.Errorf("no failure recorded for %s", p)
+		}
+	}
+}
+
+// TestResolveConflictsKeepsMiningOnInvalidChain offers a miner a longer
+// chain with a tampered block, then a longer valid one. Only adopting the
+// valid chain may cancel the running proof of work.
+func TestResolveConflictsKeepsMiningOnInvalidChain(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	tampered := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, tampered, 3)
+	tampered.Chain[len(tampered.Chain)-1].Transactions[0].Value++
+	valid := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, valid, 3)
+
+	// Keep the search from finishing on its own.
+	bc.SetMiningThreads(1)
+	bc.mux.Lock()
+	bc.Difficulty = MAX_DIFFICULTY
+	bc.mux.Unlock()
+	mined := make(chan bool)
+	go func() { mined <- bc.Mining() }()
+	for {
+		bc.miningMux.Lock()
+		running := bc.mining != nil
+		bc.miningMux.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, tampered)); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ResolveConflicts() {
+		t.Fatal("the tampered chain was adopted")
+	}
+	select {
+	case <-mined:
+		t.Fatal("mining stopped for a chain that was not adopted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := bc.AddNeighbour(servePeer(t, valid)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.ResolveConflicts() {
+		t.Fatal("the longer valid chain was not adopted")
+	}
+	select {
+	case ok := <-mined:
+		if ok {
+			t.Fatal("a block was mined on the replaced chain")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("mining was not cancelled after the chain was replaced")
+	}
+	if got, want := bc.LastBlock().Hash(), valid.LastBlock().Hash(); got != want {
+		t.Fatalf("tip %x, want the valid fork's %x", got, want)
+	}
+}
+
+// TestResolveConflictsRechecksTheTip validates a longer fork, then lets the
+// local chain outgrow it before the swap, as can happen now that
+// validation runs without the write lock. The fork must no longer win.
+func TestResolveConflictsRechecksTheTip(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	fork := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, fork, 2)
+
+	bc.mux.RLock()
+	rules := bc.chainRules()
+	bc.mux.RUnlock()
+	if !rules.valid(fork.Chain, bc.logger) {
+		t.Fatal("the fork is not valid")
+	}
+
+	bc.mux.Lock()
+	better := bc.stillBetter(fork.Chain, rules)
+	bc.mux.Unlock()
+	if !better {
+		t.Fatal("the longer fork does not beat the chain it was validated against")
+	}
+
+	mineBlocks(t, bc, 3)
+	bc.mux.Lock()
+	better = bc.stillBetter(fork.Chain, rules)
+	bc.mux.Unlock()
+	if better {
+		t.Fatal("the fork still wins after the local chain outgrew it")
+	}
+}
+
+// TestCatchUpWhenNeighboursAreAhead puts two of three neighbours ahead of
+// the local node. It must report itself out of sync until CatchUp adopts
+// their chain.
+func TestCatchUpWhenNeighboursAreAhead(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	ahead := forkBlockchain(t, bc, bob.address)
+	mineBlocks(t, ahead, 3)
+	level := forkBlockchain(t, bc, bob.address)
+
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, level)); err != nil {
+		t.Fatal(err)
+	}
+	if !bc.IsSynced() {
+		t.Fatal("out of sync with a neighbour at the same height")
+	}
+	if bc.CatchUp() {
+		t.Fatal("CatchUp replaced the chain while in sync")
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := bc.AddNeighbour(servePeer(t, ahead)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if bc.IsSynced() {
+		t.Fatal("in sync while most neighbours are ahead")
+	}
+	if bc.Stats().Synced {
+		t.Fatal("Stats reports the node in sync")
+	}
+	if !bc.CatchUp() {
+		t.Fatal("CatchUp did not adopt the longer chain")
+	}
+	if got, want := bc.LastBlock().Hash(), ahead.LastBlock().Hash(); got != want {
+		t.Fatalf("tip %x, want %x", got, want)
+	}
+	if !bc.IsSynced() || !bc.Stats().Synced {
+		t.Fatal("still out of sync after catching up")
+	}
+}
+
+// TestResolveConflictsCountsUnavailablePeer resolves against a neighbour
+// answering 503. The failure must be logged with the peer and status and
+// counted against the peer.
+func TestResolveConflictsCountsUnavailablePeer(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	var logs bytes.Buffer
+	bc.SetLogger(NewLogger(&logs, LOG_WARN, LOG_FORMAT_TEXT))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	peer := strings.TrimPrefix(ts.URL, "http://")
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(peer); err != nil {
+		t.Fatal(err)
+	}
+
+	if bc.ResolveConflicts() {
+		t.Fatal("the chain was replaced")
+	}
+	if got := bc.PeerFailures()[peer]; got != 1 {
+		t.Fatalf("failures recorded for the peer: %d, want 1", got)
+	}
+	line := logs.String()
+	if !strings.Contains(line, "fetch chain failed") || !strings.Contains(line, peer) || !strings.Contains(line, "503") {
+		t.Fatalf("log %q does not report the peer and its status", line)
+	}
+}
+
+// TestResolveConflictsAbortsOversizedChain serves a chain body that never
+// ends. The read must stop at the configured limit and the peer be
+// skipped and counted.
+func TestResolveConflictsAbortsOversizedChain(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	const limit = 1 << 16
+	bc.SetMaxChainResponseBytes(limit)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{"chain":[`))
+		chunk := bytes.Repeat([]byte(" "), 4096)
+		// Stop once the client hangs up, or at some bound if it never does.
+		for sent := 0; sent < 64*limit; sent += len(chunk) {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+	peer := strings.TrimPrefix(ts.URL, "http://")
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(peer); err != nil {
+		t.Fatal(err)
+	}
+
+	if bc.ResolveConflicts() {
+		t.Fatal("the oversized chain was adopted")
+	}
+	if got := bc.PeerFailures()[peer]; got != 1 {
+		t.Fatalf("failures recorded for the peer: %d, want 1", got)
+	}
+	if _, err := bc.fetchChain(peer); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Fatalf("fetching the oversized chain: got %v, want a size error", err)
+	}
+}
+
+// TestReplicaFollowsOnlyItsPrimary points a replica at a primary while a
+// longer chain is on offer from another neighbour. The replica must mirror
+// the primary, even where that is shorter, and refuse to mine.
+func TestReplicaFollowsOnlyItsPrimary(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	primary := newTestBlockchain(t, alice.address)
+	mineBlocks(t, primary, 2)
+	replica := forkBlockchain(t, primary, bob.address)
+	other := forkBlockchain(t, primary, carol.address)
+	mineBlocks(t, primary, 1)
+	mineBlocks(t, other, 4)
+
+	replica.SetNeighbourScan(false)
+	if err := replica.AddNeighbour(servePeer(t, other)); err != nil {
+		t.Fatal(err)
+	}
+	primaryAddr := servePeer(t, primary)
+	replica.SetPrimary(primaryAddr)
+	if !replica.IsReplica() {
+		t.Fatal("not a replica with a primary set")
+	}
+	replica.SyncNeighbours()
+	if n := replica.Neighbours(); len(n) != 1 || n[0] != primaryAddr {
+		t.Fatalf("neighbours %v, want only the primary", n)
+	}
+
+	if !replica.ResolveConflicts() {
+		t.Fatal("the replica did not follow its primary")
+	}
+	if got, want := replica.LastBlock().Hash(), primary.LastBlock().Hash(); got != want {
+		t.Fatalf("replica tip %x, want the primary's %x", got, want)
+	}
+	if replica.ResolveConflicts() {
+		t.Fatal("the replica replaced a chain that already mirrors its primary")
+	}
+	if replica.Mining() {
+		t.Fatal("the replica mined a block")
+	}
+
+	// A reorg on the primary to a shorter chain is mirrored too.
+	primary.mux.Lock()
+	primary.Chain = primary.Chain[:len(primary.Chain)-1]
+	primary.mux.Unlock()
+	if !replica.ResolveConflicts() {
+		t.Fatal("the replica did not follow its primary back")
+	}
+	if got, want := replica.Tip().Height, primary.Tip().Height; got != want {
+		t.Fatalf("replica height %d, want the primary's %d", got, want)
+	}
+}
+
+// TestEmptyAndSingleBlockChains feeds ValidChain and ResolveConflicts
+// chains of no blocks and of just a genesis block. None may panic, an empty
+// chain is never valid, and a lone genesis block is valid as long as it
+// carries no transactions.
+func TestEmptyAndSingleBlockChains(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	// An unpinned genesis block is accepted as long as it is empty.
+	loaded := cloneChain(t, bc.Chain[:1])
+	loaded[0].Transactions = []*Transaction{NewTransaction(GENESIS_SENDER, newTestKey(t).address, COIN)}
+	loaded[0].invalidateHash()
+
+	if (&Blockchain{}).LastBlock() != nil {
+		t.Fatal("LastBlock of an empty chain is not nil")
+	}
+	for _, c := range []struct {
+		name  string
+		chain []*Block
+		want  bool
+	}{
+		{"nil", nil, false},
+		{"empty", []*Block{}, false},
+		{"own genesis", bc.Chain[:1], true},
+		{"loaded genesis", loaded, false},
+	} {
+		if got := bc.ValidChain(c.chain); got != c.want {
+			t.Errorf("%s chain: ValidChain = %v, want %v", c.name, got, c.want)
+		}
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		w.Write([]byte(`{"chain":[],"length":5,"height":4}`))
+	}))
+	defer ts.Close()
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(strings.TrimPrefix(ts.URL, "http://")); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ResolveConflicts() {
+		t.Fatal("an empty chain replaced the node's")
+	}
+	if bc.ChainLength() != 1 {
+		t.Fatalf("chain length %d, want 1", bc.ChainLength())
+	}
+}
+
+// TestResolveConflictsRejectsOverspendingChain serves a longer chain, well
+// formed in every other way, in which bob spends coins he never received.
+// ValidChain must refuse it and the node keep its own chain.
+func TestResolveConflictsRejectsOverspendingChain(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	tip := bc.LastBlock().Hash()
+
+	other := forkBlockchain(t, bc, alice.address)
+	params := other.Params()
+	overspend := NewTransaction(bob.address, alice.address, COIN)
+	overspend.SenderPublicKey = bob.publicKey()
+	overspend.Signature = bob.sign(t, overspend).String()
+	other.mux.Lock()
+	for _, spend := range [][]*Transaction{{overspend}, nil} {
+		coinbase := NewTransaction(params.MiningSender(), alice.address, MINING_REWARD)
+		other.Chain = append(other.Chain, sealBlock(other.Chain, append([]*Transaction{coinbase}, spend...), params.Difficulty))
+	}
+	other.mux.Unlock()
+
+	if err := VerifyChain(other.Chain, bc.Chain[0].Hash(), params); err == nil || !strings.Contains(err.Error(), bob.address) {
+		t.Fatalf("got %v, want an overspend by bob", err)
+	}
+	if bc.ValidChain(other.Chain) {
+		t.Fatal("ValidChain accepted a chain with an overspend")
+	}
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, other)); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ResolveConflicts() {
+		t.Fatal("the overspending chain was adopted")
+	}
+	if bc.LastBlock().Hash() != tip {
+		t.Fatal("the node's tip moved")
+	}
+}
+
+// TestMalformedPreviousHash decodes blocks whose previousHash is short,
+// long, odd or not hex at all. Each must fail to decode without a panic,
+// and a peer serving such a chain must be skipped.
+func TestMalformedPreviousHash(t *testing.T) {
+	valid := strings.Repeat("ab", 32)
+	if _, err := ParseHash(valid); err != nil {
+		t.Fatal(err)
+	}
+	for _, hash := range []string{"", "abcd", valid[:63], valid + "ab", strings.Repeat("zz", 32)} {
+		var b Block
+		body := fmt.Sprintf(`{"nonce":0,"previousHash":%q,"timestamp":0,"transactions":[]}`, hash)
+		if err := json.Unmarshal([]byte(body), &b); err == nil {
+			t.Errorf("previousHash %q decoded", hash)
+		}
+	}
+
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, `{"chain":[{"nonce":0,"previousHash":"abcd","timestamp":0,"transactions":[]}],"length":1}`)
+	}))
+	defer ts.Close()
+	peer := strings.TrimPrefix(ts.URL, "http://")
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(peer); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ResolveConflicts() {
+		t.Fatal("a chain that does not decode was adopted")
+	}
+	if bc.PeerFailures()[peer] != 1 {
+		t.Fatal("the peer serving it was not counted as failing")
+	}
+}
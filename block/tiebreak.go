@@ -0,0 +1,33 @@
+package block
+
+import "bytes"
+
+// TieBreakPolicy decides whether ResolveConflicts adopts a competing chain
+// that is exactly as long as the best one seen so far.
+type TieBreakPolicy int
+
+const (
+	// TIE_BREAK_NONE keeps the current chain on ties.
+	TIE_BREAK_NONE TieBreakPolicy = iota
+	// TIE_BREAK_LOWEST_HASH adopts the chain whose tip hash sorts lowest, so
+	// every node settles on the same fork.
+	TIE_BREAK_LOWEST_HASH
+)
+
+func (bc *Blockchain) SetTieBreak(policy TieBreakPolicy) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	bc.tieBreak = policy
+}
+
+// wins reports whether chain should replace one of the same length ending
+// in bestTip.
+func (p TieBreakPolicy) wins(chain []*Block, bestTip [32]byte) bool {
+	switch p {
+	case TIE_BREAK_LOWEST_HASH:
+		tip := chain[len(chain)-1].Hash()
+		return bytes.Compare(tip[:], bestTip[:]) < 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,52 @@
+package block
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestTieBreakConverges lets two nodes mine competing forks of the same
+// length and exchange them. Without a tie-break both keep their own; with
+// TIE_BREAK_LOWEST_HASH both settle on the fork with the lower tip hash.
+func TestTieBreakConverges(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	a := newTestBlockchain(t, alice.address)
+	mineBlocks(t, a, 2)
+	b := forkBlockchain(t, a, bob.address)
+	mineBlocks(t, a, 2)
+	mineBlocks(t, b, 2)
+	aTip, bTip := a.LastBlock().Hash(), b.LastBlock().Hash()
+	want := aTip
+	if bytes.Compare(bTip[:], aTip[:]) < 0 {
+		want = bTip
+	}
+
+	a.SetNeighbourScan(false)
+	b.SetNeighbourScan(false)
+	if err := a.AddNeighbour(servePeer(t, b)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddNeighbour(servePeer(t, a)); err != nil {
+		t.Fatal(err)
+	}
+
+	if a.ResolveConflicts() || b.ResolveConflicts() {
+		t.Fatal("a tie replaced a chain without a tie-break policy")
+	}
+
+	a.SetTieBreak(TIE_BREAK_LOWEST_HASH)
+	b.SetTieBreak(TIE_BREAK_LOWEST_HASH)
+	replacedA, replacedB := a.ResolveConflicts(), b.ResolveConflicts()
+	if replacedA == replacedB {
+		t.Fatalf("replaced a: %v, b: %v; want exactly one", replacedA, replacedB)
+	}
+	for name, bc := range map[string]*Blockchain{"a": a, "b": b} {
+		if got := bc.LastBlock().Hash(); got != want {
+			t.Errorf("%s tip %x, want the lower %x", name, got, want)
+		}
+		// Settled nodes stay put.
+		if bc.ResolveConflicts() {
+			t.Errorf("%s replaced its chain again", name)
+		}
+	}
+}
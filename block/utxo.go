@@ -0,0 +1,176 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OutPoint names an unspent output: the transaction that created it and
+// the output's index, 0 for the payment and 1 for the sender's change.
+// Height disambiguates identical coinbase transactions in different blocks.
+type OutPoint struct {
+	Height int      `json:"height"`
+	TxID   [32]byte `json:"-"`
+	Index  int      `json:"index"`
+}
+
+type Output struct {
+	OutPoint
+	Address string `json:"address"`
+	Value   Amount `json:"value"`
+}
+
+func (o Output) String() string {
+	return fmt.Sprintf("%x:%d@%d %s %s", o.TxID, o.Index, o.Height, o.Address, o.Value)
+}
+
+// UTXOSet views the chain's account transfers as unspent outputs. Transfers
+// name no inputs, so a spend consumes the sender's oldest outputs until it
+// is covered and returns the excess to the sender as change; balances agree
+// with the account model.
+type UTXOSet struct {
+	miningSender string
+	outputs      map[OutPoint]*Output
+	// byAddress lists each address's unspent outputs, oldest first.
+	byAddress map[string][]OutPoint
+}
+
+// NewUTXOSet returns an empty set for a chain whose coinbase transactions
+// come from miningSender.
+func NewUTXOSet(miningSender string) *UTXOSet {
+	return &UTXOSet{
+		miningSender: miningSender,
+		outputs:      make(map[OutPoint]*Output),
+		byAddress:    make(map[string][]OutPoint),
+	}
+}
+
+func (u *UTXOSet) add(op OutPoint, address string, value Amount) {
+	if o, ok := u.outputs[op]; ok {
+		// The same transaction twice in one block.
+		o.Value += value
+		return
+	}
+	u.outputs[op] = &Output{OutPoint: op, Address: address, Value: value}
+	u.byAddress[address] = append(u.byAddress[address], op)
+}
+
+// spend consumes address's oldest outputs until they cover amount and
+// returns their total.
+func (u *UTXOSet) spend(address string, amount Amount) Amount {
+	ops := u.byAddress[address]
+	var total Amount
+	n := 0
+	for n < len(ops) && total < amount {
+		total += u.outputs[ops[n]].Value
+		delete(u.outputs, ops[n])
+		n++
+	}
+	if n == len(ops) {
+		delete(u.byAddress, address)
+	} else {
+		u.byAddress[address] = ops[n:]
+	}
+	return total
+}
+
+// ApplyBlock spends and creates the outputs of b, the block at height.
+func (u *UTXOSet) ApplyBlock(b *Block, height int) {
+	for _, t := range b.Transactions {
+		id := t.ID()
+		if !isCoinbaseSender(t.SenderBlockchainAddress, u.miningSender) {
+			cost := t.Value + t.Fee
+			if change := u.spend(t.SenderBlockchainAddress, cost) - cost; change > 0 {
+				u.add(OutPoint{Height: height, TxID: id, Index: 1}, t.SenderBlockchainAddress, change)
+			}
+		}
+		if t.Value > 0 {
+			u.add(OutPoint{Height: height, TxID: id, Index: 0}, t.RecipientBlockchainAddress, t.Value)
+		}
+	}
+}
+
+// Output returns the unspent output at op.
+func (u *UTXOSet) Output(op OutPoint) (Output, bool) {
+	o, ok := u.outputs[op]
+	if !ok {
+		return Output{}, false
+	}
+	return *o, true
+}
+
+// Unspent returns address's unspent outputs, oldest first.
+func (u *UTXOSet) Unspent(address string) []Output {
+	ops := u.byAddress[address]
+	outputs := make([]Output, 0, len(ops))
+	for _, op := range ops {
+		outputs = append(outputs, *u.outputs[op])
+	}
+	return outputs
+}
+
+func (u *UTXOSet) Balance(address string) Amount {
+	var total Amount
+	for _, op := range u.byAddress[address] {
+		total += u.outputs[op].Value
+	}
+	return total
+}
+
+// SetUTXOMode turns the UTXO view of the chain on or off. It is kept in
+// step as blocks are added and rebuilt when the chain is replaced, and
+// cannot be built on a pruned chain.
+func (bc *Blockchain) SetUTXOMode(enabled bool) {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	if !enabled {
+		bc.utxo = nil
+		return
+	}
+	if bc.snapshot != nil {
+		bc.logger.Warn("utxo mode unavailable on a pruned chain", "pruned_height", bc.snapshot.Height)
+		return
+	}
+	bc.rebuildUTXO()
+}
+
+// UTXOMode reports whether the UTXO set is maintained.
+func (bc *Blockchain) UTXOMode() bool {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	return bc.utxo != nil
+}
+
+// rebuildUTXO builds the UTXO set from the whole chain. The caller must
+// hold bc.mux.
+func (bc *Blockchain) rebuildUTXO() {
+	bc.utxo = NewUTXOSet(bc.params.MiningSender())
+	for height, b := range bc.Chain {
+		bc.utxo.ApplyBlock(b, height)
+	}
+}
+
+// SpendableOutputs picks address's oldest unspent outputs until they cover
+// amount. It needs UTXO mode, and fails with ErrInsufficientBalance if all
+// of them fall short. Outputs already claimed by pooled transactions are
+// not excluded.
+func (bc *Blockchain) SpendableOutputs(address string, amount Amount) ([]Output, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if bc.utxo == nil {
+		return nil, errors.New("utxo mode is off")
+	}
+	var selected []Output
+	var total Amount
+	for _, o := range bc.utxo.Unspent(address) {
+		if total >= amount {
+			break
+		}
+		selected = append(selected, o)
+		total += o.Value
+	}
+	if total < amount {
+		return nil, ErrInsufficientBalance
+	}
+	return selected, nil
+}
@@ -0,0 +1,355 @@
+package block
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"goblockchain/utils"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VerifyChain checks linkage, proof of work and timestamps of chain without
+// needing a Blockchain. A zero genesisHash skips the genesis check.
+//
+// Linkage and timestamps (and, under proof of stake, proposer eligibility)
+// are checked serially first; proof of work or the proposer signature and
+// the coinbase reward are then checked across params.VerifyWorkers
+// goroutines, along with transaction signatures where
+// params.VerifyTransactionSignatures is set.
+// When several blocks fail, the error for the lowest height is returned so
+// the result is deterministic. Each block is checked against the params
+// params.At gives for its height.
+func VerifyChain(chain []*Block, genesisHash [32]byte, params NetworkParams) error {
+	return verifyChain(chain, genesisHash, params, nil)
+}
+
+// verifyChain is VerifyChain for a node that has pruned its chain down to
+// base: chain must contain the last pruned block, and only the blocks above
+// it are checked beyond their linkage, starting from base's state.
+func verifyChain(chain []*Block, genesisHash [32]byte, params NetworkParams, base *pruneSnapshot) error {
+	if len(chain) == 0 {
+		return errors.New("verify chain: empty chain")
+	}
+	for i, b := range chain {
+		if b == nil {
+			return verifyErrorf(i, "null")
+		}
+		if b.pruned && (base == nil || i > base.Height) {
+			return verifyErrorf(i, "pruned")
+		}
+		for j, t := range b.Transactions {
+			if t == nil {
+				return verifyErrorf(i, "transaction %d is null", j)
+			}
+		}
+	}
+	if genesisHash != [32]byte{} && chain[0].Hash() != genesisHash {
+		return fmt.Errorf("verify chain: genesis hash mismatch: got %x, want %x", chain[0].Hash(), genesisHash)
+	}
+	if genesisHash == [32]byte{} && len(chain[0].Transactions) != 0 {
+		return errors.New("verify chain: unpinned genesis block must not carry transactions")
+	}
+	if base != nil && (len(chain) <= base.Height || fmt.Sprintf("%x", chain[base.Height].Hash()) != base.Hash) {
+		return verifyErrorf(base.Height, "does not match the last pruned block")
+	}
+	if err := verifyCheckpoints(chain, params.Checkpoints); err != nil {
+		return err
+	}
+	if err := verifyLinkage(chain, params); err != nil {
+		return err
+	}
+	if err := verifyProposers(chain, params); err != nil {
+		return err
+	}
+	if err := verifyBlockReferences(chain, params); err != nil {
+		return err
+	}
+	from, balances, nonces := base.start()
+	if err := verifyNonces(chain, params, from, nonces, base.confirmed()); err != nil {
+		return err
+	}
+	// Replaying in order rejects a spend placed before the credit that funds
+	// it, within a block as much as across blocks.
+	if err := auditBalances(chain, params, from, balances); err != nil {
+		return fmt.Errorf("verify chain: %w", err)
+	}
+	return verifyProofs(chain, params, from)
+}
+
+func verifyLinkage(chain []*Block, params NetworkParams) error {
+	now := time.Now()
+	preBlock := chain[0]
+	for i := 1; i < len(chain); i++ {
+		b := chain[i]
+		params := params.At(i)
+		if b.PreviousHash != preBlock.Hash() {
+			return verifyErrorf(i, "previous hash %x does not match block %d", b.PreviousHash, i-1)
+		}
+		if b.Timestamp < preBlock.Timestamp {
+			return verifyErrorf(i, "timestamp %d before previous block timestamp %d", b.Timestamp, preBlock.Timestamp)
+		}
+		if params.MedianTimeSpan > 0 {
+			if mtp := medianTimePast(chain[:i], params.MedianTimeSpan); b.Timestamp <= mtp {
+				return verifyErrorf(i, "timestamp %d not after median time past %d", b.Timestamp, mtp)
+			}
+		}
+		if params.MaxFutureDrift > 0 && b.Timestamp > now.Add(params.MaxFutureDrift).UnixNano() {
+			return verifyErrorf(i, "timestamp %d too far in the future", b.Timestamp)
+		}
+		preBlock = b
+	}
+	return nil
+}
+
+// BlockError is a chain verification failure in the block at Height.
+type BlockError struct {
+	Height int
+	Err    error
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("block %d: %v", e.Height, e.Err)
+}
+
+func (e *BlockError) Unwrap() error {
+	return e.Err
+}
+
+func blockErrorf(height int, format string, args ...interface{}) error {
+	return &BlockError{Height: height, Err: fmt.Errorf(format, args...)}
+}
+
+func verifyErrorf(height int, format string, args ...interface{}) error {
+	return fmt.Errorf("verify chain: %w", blockErrorf(height, format, args...))
+}
+
+// verifyProofs checks the blocks from height from on; the genesis block is
+// never checked.
+func verifyProofs(chain []*Block, params NetworkParams, from int) error {
+	if from < 1 {
+		from = 1
+	}
+	difficulties := chainDifficulties(chain, params)
+	paramsAt := func(height int) NetworkParams {
+		p := params.At(height)
+		p.Difficulty = difficulties[height]
+		return p
+	}
+	workers := params.VerifyWorkers
+	if workers > len(chain)-from {
+		workers = len(chain) - from
+	}
+	if workers < 2 {
+		for i := from; i < len(chain); i++ {
+			if err := verifyBlock(chain[i], i, paramsAt(i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, len(chain))
+	heights := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range heights {
+				errs[i] = verifyBlock(chain[i], i, paramsAt(i))
+			}
+		}()
+	}
+	for i := from; i < len(chain); i++ {
+		heights <- i
+	}
+	close(heights)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyBlock(b *Block, height int, params NetworkParams) error {
+	switch {
+	case b.Version <= BLOCK_VERSION_1:
+	case b.Version == BLOCK_VERSION_2:
+		if b.Height != height {
+			return verifyErrorf(height, "recorded height %d", b.Height)
+		}
+		if b.MerkleRoot != merkleRoot(b.Transactions) {
+			return verifyErrorf(height, "merkle root %x does not match its transactions", b.MerkleRoot)
+		}
+	default:
+		return verifyErrorf(height, "unsupported block version %d", b.Version)
+	}
+	if params.MaxBlockBytes > 0 {
+		if size := b.Size(); size > params.MaxBlockBytes {
+			return verifyErrorf(height, "size %d bytes exceeds %d", size, params.MaxBlockBytes)
+		}
+	}
+	if params.MaxTransactionsPerBlock > 0 && len(b.Transactions) > params.MaxTransactionsPerBlock {
+		return verifyErrorf(height, "%d transactions exceed %d", len(b.Transactions), params.MaxTransactionsPerBlock)
+	}
+	if params.Consensus == CONSENSUS_POS {
+		if err := verifyProposerSignature(b); err != nil {
+			return verifyErrorf(height, "%v", err)
+		}
+	} else if !validProof(b.Nonce, b.PreviousHash, b.Transactions, params.Difficulty) {
+		return verifyErrorf(height, "invalid proof of work (nonce %d)", b.Nonce)
+	}
+	if params.CoinbaseFirst {
+		if err := verifyCoinbasePosition(b, params.MiningSender()); err != nil {
+			return verifyErrorf(height, "%v", err)
+		}
+	}
+	var reward Amount
+	for i, t := range b.Transactions {
+		if t.SenderBlockchainAddress == GENESIS_SENDER {
+			return verifyErrorf(height, "transaction %d: genesis allocation outside the genesis block", i)
+		}
+		if t.SenderBlockchainAddress == params.MiningSender() {
+			reward += t.Value
+			continue
+		}
+		if params.VerifyTransactionSignatures {
+			if err := verifyStoredSignature(t); err != nil {
+				return verifyErrorf(height, "transaction %d: %v", i, err)
+			}
+		}
+	}
+	maxReward := params.Reward(height) + blockFees(b, params)
+	if reward > maxReward {
+		return verifyErrorf(height, "coinbase reward %s exceeds %s", reward, maxReward)
+	}
+	return nil
+}
+
+func verifyCoinbasePosition(b *Block, miningSender string) error {
+	if len(b.Transactions) == 0 || b.Transactions[0].SenderBlockchainAddress != miningSender {
+		return errors.New("first transaction is not the coinbase")
+	}
+	for i, t := range b.Transactions[1:] {
+		if t.SenderBlockchainAddress == miningSender {
+			return fmt.Errorf("transaction %d: second coinbase", i+1)
+		}
+	}
+	return nil
+}
+
+// medianTimePast returns the median timestamp of the last span blocks of
+// chain, or 0 when span is not positive or chain is empty.
+func medianTimePast(chain []*Block, span int) int64 {
+	if span <= 0 || len(chain) == 0 {
+		return 0
+	}
+	if span > len(chain) {
+		span = len(chain)
+	}
+	timestamps := make([]int64, 0, span)
+	for _, b := range chain[len(chain)-span:] {
+		timestamps = append(timestamps, b.Timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// validProof reports whether the proof hash starts with difficulty zero hex
+// digits. No proof is valid at a difficulty outside
+// MIN_DIFFICULTY..MAX_DIFFICULTY.
+func validProof(nonce int, previousHash [32]byte, transactions []*Transaction, difficulty int) bool {
+	if difficulty < MIN_DIFFICULTY || difficulty > MAX_DIFFICULTY {
+		return false
+	}
+	zeros := strings.Repeat("0", difficulty)
+	guessHashStr := fmt.Sprintf("%x", proofHash(nonce, previousHash, transactions))
+	return strings.HasPrefix(guessHashStr, zeros)
+}
+
+// ProofHash is the hash b's proof of work is measured on.
+func (b *Block) ProofHash() [32]byte {
+	return proofHash(b.Nonce, b.PreviousHash, b.Transactions)
+}
+
+// proofHash commits to the nonce, the parent and the transactions only.
+// The timestamp is left out, so the miner can stamp the block once the
+// nonce is found; it is written as zero to keep the encoding earlier chains
+// were mined on. Timestamps are instead bounded by the median time past and
+// MaxFutureDrift, and Hash, which links the next block, covers them.
+func proofHash(nonce int, previousHash [32]byte, transactions []*Transaction) [32]byte {
+	m, _ := json.Marshal(struct {
+		Nonce        int            `json:"nonce"`
+		PreviousHash string         `json:"previousHash"`
+		Timestamp    int64          `json:"timestamp"`
+		Transactions []*Transaction `json:"transactions"`
+	}{
+		Nonce:        nonce,
+		PreviousHash: fmt.Sprintf("%x", previousHash),
+		Transactions: transactions,
+	})
+	return sha256.Sum256(m)
+}
+
+// VerifyStoredTransaction re-checks the signature of the transaction at
+// txIndex in the block at blockHeight using the public key and signature
+// stored alongside it.
+func (bc *Blockchain) VerifyStoredTransaction(blockHeight, txIndex int) (bool, error) {
+	bc.mux.RLock()
+	defer bc.mux.RUnlock()
+	if blockHeight < 0 || blockHeight >= len(bc.Chain) {
+		return false, fmt.Errorf("block height %d out of range [0, %d)", blockHeight, len(bc.Chain))
+	}
+	b := bc.Chain[blockHeight]
+	if txIndex < 0 || txIndex >= len(b.Transactions) {
+		return false, fmt.Errorf("transaction index %d out of range [0, %d) in block %d", txIndex, len(b.Transactions), blockHeight)
+	}
+	t := b.Transactions[txIndex]
+	if t.SenderBlockchainAddress == bc.params.MiningSender() {
+		return false, errors.New("coinbase transactions are not signed")
+	}
+	publicKey, signature, err := parseStoredSignature(t)
+	if err != nil {
+		return false, err
+	}
+	return verifyTransactionSignature(publicKey, signature, t), nil
+}
+
+func parseStoredSignature(t *Transaction) (*ecdsa.PublicKey, *utils.Signature, error) {
+	if t.SenderPublicKey == "" || t.Signature == "" {
+		return nil, nil, errors.New("transaction does not carry a public key and signature")
+	}
+	publicKey, err := utils.ParsePublicKey(t.SenderPublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	signature, err := utils.ParseSignature(t.Signature)
+	if err != nil {
+		return nil, nil, err
+	}
+	return publicKey, signature, nil
+}
+
+// verifyStoredSignature checks t's stored signature and that its stored key
+// belongs to its sender.
+func verifyStoredSignature(t *Transaction) error {
+	publicKey, signature, err := parseStoredSignature(t)
+	if err != nil {
+		return err
+	}
+	if utils.AddressFromPublicKey(publicKey) != t.SenderBlockchainAddress {
+		return ErrSenderKeyMismatch
+	}
+	if !verifyTransactionSignature(publicKey, signature, t) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
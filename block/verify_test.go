@@ -0,0 +1,534 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// cloneChain deep-copies chain so a test can corrupt it without touching
+// the blocks, or the cached hashes, of the chain it came from.
+func cloneChain(t testing.TB, chain []*Block) []*Block {
+	t.Helper()
+	m, err := json.Marshal(chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c []*Block
+	if err := json.Unmarshal(m, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestVerifyChain(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	mineBlocks(t, bc, 6)
+	params := bc.Params()
+	genesisHash := bc.Chain[0].Hash()
+	tip := len(bc.Chain) - 1
+
+	if err := VerifyChain(cloneChain(t, bc.Chain), genesisHash, params); err != nil {
+		t.Fatalf("valid chain: %v", err)
+	}
+	if err := VerifyChain(cloneChain(t, bc.Chain), [32]byte{}, params); err != nil {
+		t.Fatalf("valid chain with an unpinned genesis: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(chain []*Block) []*Block
+		height  int // -1 when the failure is not tied to a block
+	}{
+		{"empty", func(chain []*Block) []*Block { return nil }, -1},
+		{"null block", func(chain []*Block) []*Block {
+			chain[2] = nil
+			return chain
+		}, 2},
+		{"other genesis", func(chain []*Block) []*Block {
+			chain[0].Timestamp++
+			return chain
+		}, -1},
+		{"tampered transaction", func(chain []*Block) []*Block {
+			chain[3].Transactions[0].Value++
+			return chain
+		}, 4},
+		{"broken link", func(chain []*Block) []*Block {
+			chain[tip].PreviousHash[0] ^= 0xff
+			return chain
+		}, tip},
+		{"invalid proof", func(chain []*Block) []*Block {
+			b := chain[tip]
+			for validProof(b.Nonce, b.PreviousHash, b.Transactions, params.Difficulty) {
+				b.Nonce++
+			}
+			return chain
+		}, tip},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyChain(tt.corrupt(cloneChain(t, bc.Chain)), genesisHash, params)
+			if err == nil {
+				t.Fatal("corrupted chain verified")
+			}
+			if tt.height < 0 {
+				return
+			}
+			var be *BlockError
+			if !errors.As(err, &be) {
+				t.Fatalf("got %v, want a BlockError", err)
+			}
+			if be.Height != tt.height {
+				t.Fatalf("failed at block %d, want %d: %v", be.Height, tt.height, err)
+			}
+		})
+	}
+
+	// The chain itself was never touched.
+	if err := VerifyChain(bc.Chain, genesisHash, params); err != nil {
+		t.Fatalf("source chain after the corruption cases: %v", err)
+	}
+}
+
+var (
+	benchChainOnce   sync.Once
+	benchChain       []*Block
+	benchChainParams NetworkParams
+)
+
+// benchmarkChain mines, once per test binary, the 1000-block chain the
+// verification benchmarks share.
+func benchmarkChain(b *testing.B) ([]*Block, NetworkParams) {
+	benchChainOnce.Do(func() {
+		miner := newTestKey(b)
+		bc := newTestBlockchain(b, miner.address)
+		mineBlocks(b, bc, 999)
+		benchChain, benchChainParams = bc.Chain, bc.Params()
+	})
+	return benchChain, benchChainParams
+}
+
+func benchmarkVerifyChain(b *testing.B, workers int) {
+	chain, params := benchmarkChain(b)
+	params.VerifyWorkers = workers
+	genesisHash := chain[0].Hash()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := VerifyChain(chain, genesisHash, params); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkVerifyChainSerial(b *testing.B) {
+	benchmarkVerifyChain(b, 1)
+}
+
+func BenchmarkVerifyChainParallel(b *testing.B) {
+	benchmarkVerifyChain(b, runtime.NumCPU())
+}
+
+// BenchmarkVerifyChainHashCache verifies the benchmark chain with the block
+// hashes cached from the previous run and with every cache cleared first,
+// as each call paid before hashes were cached.
+func BenchmarkVerifyChainHashCache(b *testing.B) {
+	chain, params := benchmarkChain(b)
+	params.VerifyWorkers = 1
+	genesisHash := chain[0].Hash()
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := VerifyChain(chain, genesisHash, params); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for _, block := range chain {
+				block.invalidateHash()
+			}
+			if err := VerifyChain(chain, genesisHash, params); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestVerifyChainParallelReportsLowestFailure(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	mineBlocks(t, bc, 40)
+	params := bc.Params()
+
+	// Checked under a stricter difficulty, most proofs fail. Every worker
+	// count must report the lowest failing height.
+	params.Difficulty = 4
+	want := 0
+	for h := 1; h < len(bc.Chain); h++ {
+		b := bc.Chain[h]
+		if !validProof(b.Nonce, b.PreviousHash, b.Transactions, params.Difficulty) {
+			want = h
+			break
+		}
+	}
+	if want == 0 {
+		t.Skip("every proof happens to meet the stricter difficulty")
+	}
+	for _, workers := range []int{1, 2, 8} {
+		params.VerifyWorkers = workers
+		err := VerifyChain(bc.Chain, bc.Chain[0].Hash(), params)
+		var be *BlockError
+		if !errors.As(err, &be) {
+			t.Fatalf("%d workers: got %v, want a BlockError", workers, err)
+		}
+		if be.Height != want {
+			t.Fatalf("%d workers failed at block %d, want %d", workers, be.Height, want)
+		}
+	}
+}
+
+// leadingZeroNibbles counts the leading zero hex digits of h.
+func leadingZeroNibbles(h [32]byte) int {
+	n := 0
+	for _, c := range h {
+		if c>>4 != 0 {
+			return n
+		}
+		n++
+		if c&0x0f != 0 {
+			return n
+		}
+		n++
+	}
+	return n
+}
+
+func TestValidProofChecksFullPrefix(t *testing.T) {
+	previousHash := (&Block{}).Hash()
+	transactions := []*Transaction{NewTransaction("A", "B", 1)}
+	tests := []struct {
+		difficulty int
+		nonces     int
+	}{
+		{1, 2000},
+		{2, 2000},
+		{3, 20000},
+		{4, 20000},
+		{5, 20000},
+		{6, 20000},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("difficulty %d", tt.difficulty), func(t *testing.T) {
+			valid := 0
+			for nonce := 0; nonce < tt.nonces; nonce++ {
+				want := leadingZeroNibbles(proofHash(nonce, previousHash, transactions)) >= tt.difficulty
+				if got := validProof(nonce, previousHash, transactions, tt.difficulty); got != want {
+					t.Fatalf("nonce %d: validProof = %v, want %v", nonce, got, want)
+				}
+				if want {
+					valid++
+				}
+			}
+			if tt.difficulty <= 2 && valid == 0 {
+				t.Fatalf("no valid nonce among %d", tt.nonces)
+			}
+		})
+	}
+}
+
+func TestVerifyStoredTransaction(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	tx := NewTransaction(alice.address, bob.address, COIN/2)
+	if err := bc.AddSignedTransactionE(tx, &alice.private.PublicKey, alice.sign(t, tx)); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+	b := bc.Chain[2]
+	index := -1
+	for i, c := range b.Transactions {
+		if c.SenderBlockchainAddress == alice.address {
+			index = i
+		}
+	}
+	if index < 0 {
+		t.Fatal("the transfer was not mined")
+	}
+
+	if ok, err := bc.VerifyStoredTransaction(2, index); err != nil || !ok {
+		t.Fatalf("stored transaction: %v, %v; want true, nil", ok, err)
+	}
+	if _, err := bc.VerifyStoredTransaction(2, 1-index); err == nil {
+		t.Error("verified the unsigned coinbase")
+	}
+	for _, tc := range []struct{ height, index int }{
+		{-1, 0}, {3, 0}, {2, -1}, {2, len(b.Transactions)},
+	} {
+		if _, err := bc.VerifyStoredTransaction(tc.height, tc.index); err == nil {
+			t.Errorf("VerifyStoredTransaction(%d, %d) accepted an index out of range", tc.height, tc.index)
+		}
+	}
+
+	bc.mux.Lock()
+	b.Transactions[index].Value++
+	bc.mux.Unlock()
+	if ok, err := bc.VerifyStoredTransaction(2, index); err != nil || ok {
+		t.Fatalf("tampered transaction: %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestMedianTimePast(t *testing.T) {
+	chain := make([]*Block, 0, 13)
+	for _, ts := range []int64{5, 1, 9, 3, 7, 2, 8, 4, 6, 10, 11, 12, 0} {
+		chain = append(chain, &Block{Timestamp: ts})
+	}
+	for _, tt := range []struct {
+		n, span int
+		want    int64
+	}{
+		{0, 11, 0},
+		{1, 11, 5},
+		{3, 11, 5},
+		{11, 11, 6},
+		{13, 11, 7},
+		{13, 3, 11},
+		{13, 0, 0},
+	} {
+		if got := medianTimePast(chain[:tt.n], tt.span); got != tt.want {
+			t.Errorf("medianTimePast of %d blocks over %d = %d, want %d", tt.n, tt.span, got, tt.want)
+		}
+	}
+}
+
+// TestBlockBeforeMedianTimePastIsRejected builds a chain whose later blocks
+// share a timestamp, which the previous-block rule alone allows. Once that
+// timestamp is the median of the last MEDIAN_TIME_SPAN blocks, another block
+// carrying it must be refused, while one a nanosecond later is accepted.
+func TestBlockBeforeMedianTimePastIsRejected(t *testing.T) {
+	miner := newTestKey(t)
+	bc := newTestBlockchain(t, miner.address)
+	params := bc.Params()
+	genesisHash := bc.Chain[0].Hash()
+	base := bc.Chain[0].Timestamp
+	coinbase := []*Transaction{NewTransaction(params.MiningSender(), miner.address, MINING_REWARD)}
+	seal := func(chain []*Block, timestamp int64) []*Block {
+		b := sealBlock(chain, coinbase, params.Difficulty)
+		b.Timestamp = timestamp
+		return append(chain[:len(chain):len(chain)], b)
+	}
+
+	chain := cloneChain(t, bc.Chain)
+	for i := 1; i <= MEDIAN_TIME_SPAN; i++ {
+		chain = seal(chain, base+int64(i))
+	}
+	last := base + MEDIAN_TIME_SPAN
+	for medianTimePast(chain, MEDIAN_TIME_SPAN) < last {
+		chain = seal(chain, last)
+		if err := VerifyChain(chain, genesisHash, params); err != nil {
+			t.Fatalf("tied timestamp below the median time past: %v", err)
+		}
+	}
+
+	err := VerifyChain(seal(chain, last), genesisHash, params)
+	var be *BlockError
+	if !errors.As(err, &be) || be.Height != len(chain) || !strings.Contains(err.Error(), "median time past") {
+		t.Fatalf("got %v, want a median time past error for block %d", err, len(chain))
+	}
+	if err := VerifyChain(seal(chain, last+1), genesisHash, params); err != nil {
+		t.Fatalf("block just after the median time past: %v", err)
+	}
+}
+
+// TestOversizedReceivedBlockIsRejected offers a chain whose newest block is
+// one byte over the local MaxBlockBytes. It must be refused until the
+// limit admits the block.
+func TestOversizedReceivedBlockIsRejected(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 2)
+	fork := forkBlockchain(t, bc, bob.address)
+	for i := uint64(1); i <= 20; i++ {
+		if err := addNonced(t, fork, alice, bob.address, COIN/100, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mineBlocks(t, fork, 1)
+	size := fork.LastBlock().Size()
+
+	params := bc.Params()
+	params.MaxBlockBytes = size - 1
+	bc.SetParams(params)
+	bc.SetNeighbourScan(false)
+	if err := bc.AddNeighbour(servePeer(t, fork)); err != nil {
+		t.Fatal(err)
+	}
+	if bc.ResolveConflicts() {
+		t.Fatal("adopted a chain with an oversized block")
+	}
+	err := VerifyChain(fork.Chain, bc.Chain[0].Hash(), params)
+	if err == nil || !strings.Contains(err.Error(), "exceeds") {
+		t.Fatalf("got %v, want a size error", err)
+	}
+
+	params.MaxBlockBytes = size
+	bc.SetParams(params)
+	if !bc.ResolveConflicts() {
+		t.Fatal("refused a block within the limit")
+	}
+}
+
+// TestSpendBeforeItsCreditIsRejected seals a block where bob spends funds
+// that alice only sends him later in the same block. Swapping the two
+// transactions makes the block valid.
+func TestSpendBeforeItsCreditIsRejected(t *testing.T) {
+	alice, bob, carol := newTestKey(t), newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	params := bc.Params()
+
+	coinbase := NewTransaction(params.MiningSender(), alice.address, MINING_REWARD)
+	credit := NewTransaction(alice.address, bob.address, MINING_REWARD)
+	spend := NewTransaction(bob.address, carol.address, MINING_REWARD/2)
+	for _, signed := range []struct {
+		tx  *Transaction
+		key testKey
+	}{{credit, alice}, {spend, bob}} {
+		signed.tx.SenderPublicKey = signed.key.publicKey()
+		signed.tx.Signature = signed.key.sign(t, signed.tx).String()
+	}
+
+	outOfOrder := append(bc.Chain[:2:2], sealBlock(bc.Chain, []*Transaction{coinbase, spend, credit}, params.Difficulty))
+	err := VerifyChain(outOfOrder, bc.Chain[0].Hash(), params)
+	var blockErr *BlockError
+	if !errors.As(err, &blockErr) || blockErr.Height != 2 || !strings.Contains(err.Error(), "drops to") {
+		t.Fatalf("spend before its credit: got %v, want an overdraw at height 2", err)
+	}
+
+	inOrder := append(bc.Chain[:2:2], sealBlock(bc.Chain, []*Transaction{coinbase, credit, spend}, params.Difficulty))
+	if err := VerifyChain(inOrder, bc.Chain[0].Hash(), params); err != nil {
+		t.Fatalf("credit before its spend: %v", err)
+	}
+}
+
+// TestVerifyChainChecksTransactionSignatures seals one transfer at height 2
+// signed properly, by the wrong key, and not at all. Only the first may
+// pass, unless the network schedules signature checks from a later height
+// for blocks confirmed before transactions stored their signatures.
+func TestVerifyChainChecksTransactionSignatures(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	params := bc.Params()
+	genesisHash := bc.Chain[0].Hash()
+
+	withTransfer := func(signer *testKey) []*Block {
+		transfer := NewTransaction(alice.address, bob.address, COIN/2)
+		if signer != nil {
+			transfer.SenderPublicKey = signer.publicKey()
+			transfer.Signature = signer.sign(t, transfer).String()
+		}
+		coinbase := NewTransaction(params.MiningSender(), alice.address, MINING_REWARD)
+		return append(bc.Chain[:2:2], sealBlock(bc.Chain, []*Transaction{coinbase, transfer}, params.Difficulty))
+	}
+	if err := VerifyChain(withTransfer(&alice), genesisHash, params); err != nil {
+		t.Fatalf("signed by the sender: %v", err)
+	}
+	forged, unsigned := withTransfer(&bob), withTransfer(nil)
+	for name, chain := range map[string][]*Block{"signed by another key": forged, "unsigned": unsigned} {
+		var blockErr *BlockError
+		if err := VerifyChain(chain, genesisHash, params); !errors.As(err, &blockErr) || blockErr.Height != 2 {
+			t.Errorf("%s: got %v, want an error at height 2", name, err)
+		}
+	}
+
+	legacy := params
+	legacy.VerifyTransactionSignatures = false
+	legacy.Schedule = ParamSchedule{3: params}
+	if err := VerifyChain(unsigned, genesisHash, legacy); err != nil {
+		t.Fatalf("unsigned before signatures were required: %v", err)
+	}
+}
+
+// TestMinedBlockRevalidates mines blocks at the real time and checks each
+// proof against the stored block rather than a reconstruction. The
+// timestamp is outside the proof but inside the hash the next block links.
+func TestMinedBlockRevalidates(t *testing.T) {
+	bc := newTestBlockchain(t, newTestKey(t).address)
+	bc.SetDifficulty(2)
+	mineBlocks(t, bc, 3)
+	for height, b := range bc.Chain[1:] {
+		if b.Timestamp == 0 {
+			t.Fatalf("block %d carries no timestamp", height+1)
+		}
+		if !validProof(b.Nonce, b.PreviousHash, b.Transactions, 2) {
+			t.Fatalf("block %d does not satisfy its own proof", height+1)
+		}
+	}
+	if err := bc.VerifyOwnChain(); err != nil {
+		t.Fatalf("mined chain: %v", err)
+	}
+	if err := VerifyChain(cloneChain(t, bc.Chain), bc.Chain[0].Hash(), bc.Params()); err != nil {
+		t.Fatalf("decoded chain: %v", err)
+	}
+
+	restamped := cloneChain(t, bc.Chain)
+	b := restamped[2]
+	proof := b.ProofHash()
+	b.Timestamp++
+	b.invalidateHash()
+	if b.ProofHash() != proof {
+		t.Fatal("the timestamp changed the proof hash")
+	}
+	var blockErr *BlockError
+	if err := VerifyChain(restamped, bc.Chain[0].Hash(), bc.Params()); !errors.As(err, &blockErr) || blockErr.Height != 3 {
+		t.Fatalf("restamped block 2: got %v, want block 3 to lose its link", err)
+	}
+}
+
+// TestCoinbaseMustComeFirst seals blocks with the coinbase after a
+// transfer, with two coinbases and with none. Each must be rejected while
+// CoinbaseFirst is set, and locally mined blocks put it first. Without the
+// rule the coinbase may go anywhere.
+func TestCoinbaseMustComeFirst(t *testing.T) {
+	alice, bob := newTestKey(t), newTestKey(t)
+	bc := newTestBlockchain(t, alice.address)
+	mineBlocks(t, bc, 1)
+	if err := addNonced(t, bc, alice, bob.address, COIN/10, 0); err != nil {
+		t.Fatal(err)
+	}
+	mineBlocks(t, bc, 1)
+	params := bc.Params()
+	if !params.CoinbaseFirst {
+		t.Fatal("CoinbaseFirst is off by default")
+	}
+	if mined := bc.Chain[2].Transactions; len(mined) != 2 || mined[0].SenderBlockchainAddress != params.MiningSender() {
+		t.Fatal("the mined block does not start with its coinbase")
+	}
+
+	coinbase := NewTransaction(params.MiningSender(), alice.address, MINING_REWARD/2)
+	transfer := NewTransaction(alice.address, bob.address, COIN/10)
+	transfer.SenderPublicKey = alice.publicKey()
+	transfer.Signature = alice.sign(t, transfer).String()
+	for name, transactions := range map[string][]*Transaction{
+		"coinbase second": {transfer, coinbase},
+		"two coinbases":   {coinbase, coinbase},
+		"no coinbase":     {transfer},
+	} {
+		chain := append(bc.Chain[:2:2], sealBlock(bc.Chain[:2], transactions, params.Difficulty))
+		if err := VerifyChain(chain, bc.Chain[0].Hash(), params); err == nil || !strings.Contains(err.Error(), "coinbase") {
+			t.Errorf("%s: got %v, want a coinbase error", name, err)
+		}
+	}
+
+	params.CoinbaseFirst = false
+	chain := append(bc.Chain[:2:2], sealBlock(bc.Chain[:2], []*Transaction{transfer, coinbase}, params.Difficulty))
+	if err := VerifyChain(chain, bc.Chain[0].Hash(), params); err != nil {
+		t.Fatalf("coinbase second without CoinbaseFirst: %v", err)
+	}
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"crypto/ecdsa"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"goblockchain/block"
 	"goblockchain/utils"
 	"goblockchain/wallet"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 )
@@ -14,11 +18,57 @@ import (
 var cache map[string]*block.Blockchain = make(map[string]*block.Blockchain)
 
 type BlockchainServer struct {
-	port uint16
+	port      uint16
+	chainFile string
+	genesis   *block.Block
+	params    block.NetworkParams
+	metrics   *Metrics
+	bootstrap string
+	advertise string
 }
 
 func NewBlockchainServer(port uint16) *BlockchainServer {
-	return &BlockchainServer{port}
+	return &BlockchainServer{port: port, params: block.DefaultNetworkParams(), metrics: NewMetrics()}
+}
+
+// Params returns the network params the chain will be created with.
+func (bcs *BlockchainServer) Params() block.NetworkParams {
+	return bcs.params
+}
+
+// SetParams sets the network params the chain is created with and a saved
+// chain is validated under. It must be called before the first
+// GetBlockchain.
+func (bcs *BlockchainServer) SetParams(params block.NetworkParams) {
+	bcs.params = params
+}
+
+// SetMetrics replaces the registry the chain counts into and /metrics
+// renders. It must be called before the first GetBlockchain.
+func (bcs *BlockchainServer) SetMetrics(m *Metrics) {
+	bcs.metrics = m
+}
+
+// SetChainFile makes the server load its chain from path, if it exists,
+// and keep it saved there. It must be called before the first
+// GetBlockchain.
+func (bcs *BlockchainServer) SetChainFile(path string) {
+	bcs.chainFile = path
+}
+
+// SetBootstrap makes Run announce advertise, this node's host:port, to the
+// bootstrap node once it is serving, since the bootstrap node calls back on
+// /ping to check the announcement.
+func (bcs *BlockchainServer) SetBootstrap(bootstrap string, advertise string) {
+	bcs.bootstrap = bootstrap
+	bcs.advertise = advertise
+}
+
+// SetGenesis starts the chain from the genesis described by cfg instead of
+// an empty block. Every node of the network must use the same cfg. It must
+// be called before the first GetBlockchain.
+func (bcs *BlockchainServer) SetGenesis(cfg block.GenesisConfig) {
+	bcs.genesis = block.NewGenesisBlock(cfg)
 }
 
 func (bcs *BlockchainServer) Port() uint16 {
@@ -29,7 +79,22 @@ func (bcs *BlockchainServer) GetBlockchain() *block.Blockchain {
 	bc, ok := cache["blockchain"]
 	if !ok {
 		minersWallet := wallet.NewWallet()
-		bc = block.NewBlockchain(minersWallet.BlockchainAddress(), bcs.Port())
+		if bcs.chainFile != "" {
+			var err error
+			bc, err = block.NewBlockchainFromFile(minersWallet.BlockchainAddress(), bcs.Port(), bcs.chainFile, bcs.genesis, bcs.params)
+			if err != nil {
+				log.Fatalf("ERROR: %v", err)
+			}
+		} else if bcs.genesis != nil {
+			bc = block.NewBlockchainWithGenesis(minersWallet.BlockchainAddress(), bcs.Port(), bcs.genesis)
+		} else {
+			bc = block.NewBlockchain(minersWallet.BlockchainAddress(), bcs.Port())
+		}
+		if bcs.chainFile == "" {
+			bc.SetParams(bcs.params)
+		}
+		bc.SetProposerKey(minersWallet.PrivateKey())
+		bc.SetMetrics(bcs.metrics)
 		cache["blockchain"] = bc
 		log.Printf("private_key %v\n", minersWallet.PrivateKeyStr())
 		log.Printf("public_key %v\n", minersWallet.PublicKeyStr())
@@ -50,82 +115,269 @@ func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request)
 	}
 }
 
-func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Request) {
+// BLOCKS_PAGE_DEFAULT is how many blocks /blocks returns when no limit is
+// given.
+const BLOCKS_PAGE_DEFAULT = 20
+
+// Blocks pages through the chain with ?offset=&limit=, for clients that
+// cannot take the whole chain from /chain at once.
+func (bcs *BlockchainServer) Blocks(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		w.Header().Add("Content-Type", "application/json")
+		offset, limit := 0, BLOCKS_PAGE_DEFAULT
+		for name, v := range map[string]*int{"offset": &offset, "limit": &limit} {
+			q := req.URL.Query().Get(name)
+			if q == "" {
+				continue
+			}
+			n, err := strconv.Atoi(q)
+			if err != nil {
+				log.Printf("ERROR: invalid %s %q", name, q)
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			*v = n
+		}
 		bc := bcs.GetBlockchain()
-		transactions := bc.GetTransactionPool()
+		blocks, err := bc.GetBlocks(offset, limit)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
 		m, _ := json.Marshal(struct {
-			Transactions []*block.Transaction `json:"transactions"`
-			Length       int                  `json:"length"`
+			Blocks []*block.Block `json:"blocks"`
+			Offset int            `json:"offset"`
+			Total  int            `json:"total"`
 		}{
-			Transactions: transactions,
-			Length:       len(transactions),
+			Blocks: blocks,
+			Offset: offset,
+			Total:  bc.ChainLength(),
 		})
 		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Tip(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		m, _ := json.Marshal(bcs.GetBlockchain().Tip())
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
 
-	case http.MethodPost:
+func (bcs *BlockchainServer) Ping(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		m, _ := json.Marshal(block.PingResponse{Port: bcs.Port(), PublicKey: bcs.GetBlockchain().NodePublicKey()})
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
 
-		decoder := json.NewDecoder(req.Body)
-		var t block.TransactionRequest
-		err := decoder.Decode(&t)
+func (bcs *BlockchainServer) Block(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		hash, err := block.ParseHash(req.URL.Query().Get("hash"))
 		if err != nil {
 			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
-		if !t.ValidateTransactionRequest() {
-			log.Println("ERROR: missing field(s)")
+		b, height, err := bcs.GetBlockchain().GetBlockByHash(hash)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
+		m, _ := json.Marshal(struct {
+			Height int          `json:"height"`
+			Block  *block.Block `json:"block"`
+		}{
+			Height: height,
+			Block:  b,
+		})
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Stats(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		m, _ := json.Marshal(bcs.GetBlockchain().Stats())
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func (bcs *BlockchainServer) Metrics(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "text/plain; version=0.0.4")
+		bcs.metrics.Render(w, bcs.GetBlockchain().Stats())
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// decodeTransactionRequest reads a signed TransactionRequest from the body,
+// checks that no field is missing, rebuilds the sender's public key from its
+// 128-digit hex form and the signature from its string form, and verifies
+// the signature. It answers 400 itself and reports false when any of that
+// fails.
+func decodeTransactionRequest(w http.ResponseWriter, req *http.Request) (*block.Transaction, *ecdsa.PublicKey, *utils.Signature, bool) {
+	var t block.TransactionRequest
+	err := json.NewDecoder(req.Body).Decode(&t)
+	var publicKey *ecdsa.PublicKey
+	var signature *utils.Signature
+	switch {
+	case err != nil:
+	case !t.ValidateTransactionRequest():
+		err = errors.New("missing field(s)")
+	default:
+		if publicKey, err = utils.ParsePublicKey(*t.SenderPublicKey); err != nil {
+			break
+		}
+		if signature, err = utils.ParseSignature(*t.Signature); err != nil {
+			break
+		}
+		if ok, _ := t.VerifySignature(); !ok {
+			err = block.ErrInvalidSignature
+		}
+	}
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, string(utils.JsonStatus("fail")))
+		return nil, nil, nil, false
+	}
+	return t.Transaction(), publicKey, signature, true
+}
+
+// transactionErrorStatus maps a rejected transaction's error to the status
+// the transaction handlers answer with.
+func transactionErrorStatus(err error) int {
+	switch err {
+	case block.ErrInsufficientBalance:
+		return http.StatusUnprocessableEntity
+	case block.ErrInvalidSignature, block.ErrSenderKeyMismatch:
+		return http.StatusUnauthorized
+	case block.ErrReservedSender, block.ErrSenderNotPermitted:
+		return http.StatusForbidden
+	case block.ErrStaleNonce, block.ErrReplayedTransaction:
+		return http.StatusConflict
+	case block.ErrTooManyPending, block.ErrNonceGapQueueFull:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Transactions lists the pool on GET, optionally only the transactions sent
+// or received by ?blockchain_address=. POST submits and relays a
+// transaction, PUT accepts one relayed by a neighbour and DELETE clears the
+// pool.
+func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		limit := 0
+		if l := req.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 0 {
+				log.Printf("ERROR: invalid limit %q", l)
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+			limit = n
+		}
 		bc := bcs.GetBlockchain()
-		isCreated := bc.CreateTransaction(*t.SenderBlockchainAddress, *t.RecipientBlockchainAddress,
-			*t.Value, publicKey, signature)
+		var transactions []*block.Transaction
+		var total int
+		if address := req.URL.Query().Get("blockchain_address"); address != "" {
+			transactions = bc.PendingTransactionsFor(address)
+			total = len(transactions)
+			if limit > 0 && limit < total {
+				transactions = transactions[:limit]
+			}
+		} else {
+			transactions, total = bc.PendingTransactions(limit)
+		}
+		m, _ := json.Marshal(struct {
+			Transactions []*block.Transaction `json:"transactions"`
+			Length       int                  `json:"length"`
+			Total        int                  `json:"total"`
+		}{
+			Transactions: transactions,
+			Length:       len(transactions),
+			Total:        total,
+		})
+		io.WriteString(w, string(m[:]))
+
+	case http.MethodPost:
+
+		transaction, publicKey, signature, ok := decodeTransactionRequest(w, req)
+		if !ok {
+			return
+		}
+		bc := bcs.GetBlockchain()
+		err := bc.CreateSignedTransactionE(transaction, publicKey, signature)
 
 		w.Header().Add("Content-Type", "application/json")
-		var m []byte
-		if !isCreated {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
+		tr := &block.TransactionResponse{ID: fmt.Sprintf("%x", transaction.ID())}
+		if err != nil {
+			w.WriteHeader(transactionErrorStatus(err))
+			tr.Message = "fail"
+			tr.Error = err.Error()
 		} else {
 			w.WriteHeader(http.StatusCreated)
-			m = utils.JsonStatus("success")
+			tr.Message = "success"
 		}
+		m, _ := json.Marshal(tr)
 		io.WriteString(w, string(m))
 	case http.MethodPut:
 
-		decoder := json.NewDecoder(req.Body)
-		var t block.TransactionRequest
-		err := decoder.Decode(&t)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+		transaction, publicKey, signature, ok := decodeTransactionRequest(w, req)
+		if !ok {
 			return
 		}
-		if !t.ValidateTransactionRequest() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
 		bc := bcs.GetBlockchain()
-		isUpdated := bc.AddTransaction(*t.SenderBlockchainAddress, *t.RecipientBlockchainAddress,
-			*t.Value, publicKey, signature)
+		err := bc.AddSignedTransactionE(transaction, publicKey, signature)
 
 		w.Header().Add("Content-Type", "application/json")
-		var m []byte
-		if !isUpdated {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
+		tr := &block.TransactionResponse{ID: fmt.Sprintf("%x", transaction.ID())}
+		if err != nil {
+			w.WriteHeader(transactionErrorStatus(err))
+			tr.Message = "fail"
+			tr.Error = err.Error()
 		} else {
 			w.WriteHeader(http.StatusOK)
-			m = utils.JsonStatus("success")
+			tr.Message = "success"
 		}
+		m, _ := json.Marshal(tr)
 		io.WriteString(w, string(m))
 	case http.MethodDelete:
 		bc := bcs.GetBlockchain()
@@ -138,11 +390,20 @@ func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Reque
 	}
 }
 
+// Mine mines one block, paying the reward to ?blockchain_address= if given.
 func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodGet:
 		bc := bcs.GetBlockchain()
-		isMined := bc.Mining()
+		isMined := false
+		if address := req.URL.Query().Get("blockchain_address"); address != "" {
+			var err error
+			if isMined, err = bc.MineTo(address); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		} else {
+			isMined = bc.Mining()
+		}
 
 		var m []byte
 		if !isMined {
@@ -191,6 +452,36 @@ func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Nonce answers ?blockchain_address= with the nonce that address's next
+// transaction should carry.
+func (bcs *BlockchainServer) Nonce(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchainAddress := req.URL.Query().Get("blockchain_address")
+		m, _ := json.Marshal(&block.NonceResponse{Nonce: bcs.GetBlockchain().NextNonce(blockchainAddress)})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Balance answers like Amount but reads the node's balance index instead of
+// replaying the chain.
+func (bcs *BlockchainServer) Balance(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		blockchainAddress := req.URL.Query().Get("blockchain_address")
+		m, _ := json.Marshal(&block.AmountResponse{Amount: bcs.GetBlockchain().Balance(blockchainAddress)})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m[:]))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
 func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, req *http.Request) {
 	switch req.Method {
 	case http.MethodPut:
@@ -209,14 +500,187 @@ func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, req *http.Request)
 	}
 }
 
+func (bcs *BlockchainServer) Announce(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodPost:
+		decoder := json.NewDecoder(req.Body)
+		var a block.Announcement
+		if err := decoder.Decode(&a); err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		peers, err := bcs.GetBlockchain().HandleAnnouncement(&a)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		m, _ := json.Marshal(&block.AnnounceResponse{Peers: peers})
+		w.Header().Add("Content-Type", "application/json")
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Verify checks the node's own chain and reports the block that fails, with
+// a height of -1 when the chain is valid or the failure is not tied to one
+// block.
+func (bcs *BlockchainServer) Verify(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		bc := bcs.GetBlockchain()
+		report := struct {
+			Valid  bool   `json:"valid"`
+			Length int    `json:"length"`
+			Height int    `json:"height"`
+			Error  string `json:"error,omitempty"`
+		}{
+			Valid:  true,
+			Length: bc.ChainLength(),
+			Height: -1,
+		}
+		if err := bc.VerifyOwnChain(); err != nil {
+			report.Valid = false
+			report.Error = err.Error()
+			var be *block.BlockError
+			if errors.As(err, &be) {
+				report.Height = be.Height
+			}
+			w.WriteHeader(http.StatusConflict)
+		}
+		m, _ := json.Marshal(report)
+		io.WriteString(w, string(m))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// Peers lists the neighbours, registers one on POST with {"address":
+// "host:port"} and forgets one on DELETE with ?address=host:port.
+func (bcs *BlockchainServer) Peers(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Add("Content-Type", "application/json")
+		m, _ := json.Marshal(&block.PeersResponse{Peers: bc.Neighbours()})
+		io.WriteString(w, string(m))
+	case http.MethodPost:
+		var p block.PeerRequest
+		if err := json.NewDecoder(req.Body).Decode(&p); err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		if err := bc.AddNeighbour(p.Address); err != nil {
+			log.Printf("ERROR: %v", err)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	case http.MethodDelete:
+		w.Header().Add("Content-Type", "application/json")
+		if !bc.RemoveNeighbour(req.URL.Query().Get("address")) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		io.WriteString(w, string(utils.JsonStatus("success")))
+	default:
+		log.Println("ERROR: Invalid HTTP Method")
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+// BlocksWebSocket streams the blocks joining the chain over a WebSocket. Each
+// block is one text message:
+//
+//	{"height": 12, "hash": "<hex block hash>", "block": {<block as in /chain>}}
+//
+// After a reorg the new branch is sent from the fork point on, so heights
+// may repeat. Whatever the client sends is ignored, apart from ping and
+// close. A client that falls too far behind misses blocks, and one whose
+// connection stops accepting writes is disconnected.
+func (bcs *BlockchainServer) BlocksWebSocket(w http.ResponseWriter, req *http.Request) {
+	conn, err := upgradeWebSocket(w, req)
+	if err != nil {
+		log.Printf("ERROR: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	bc := bcs.GetBlockchain()
+	blocks := bc.Subscribe()
+	defer bc.Unsubscribe(blocks)
+
+	closed := make(chan struct{})
+	go func() {
+		conn.readLoop()
+		close(closed)
+	}()
+	for {
+		select {
+		case b := <-blocks:
+			m, _ := json.Marshal(struct {
+				Height int          `json:"height"`
+				Hash   string       `json:"hash"`
+				Block  *block.Block `json:"block"`
+			}{
+				Height: b.Height,
+				Hash:   fmt.Sprintf("%x", b.Hash()),
+				Block:  b,
+			})
+			if err := conn.WriteText(m); err != nil {
+				log.Printf("ERROR: websocket write: %v", err)
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
+
 func (bcs *BlockchainServer) Run() {
 	bcs.GetBlockchain().Run()
 
 	http.HandleFunc("/chain", bcs.GetChain)
+	http.HandleFunc("/blocks", bcs.Blocks)
+	http.HandleFunc("/tip", bcs.Tip)
+	http.HandleFunc("/ping", bcs.Ping)
+	http.HandleFunc("/block", bcs.Block)
+	http.HandleFunc("/stats", bcs.Stats)
+	http.HandleFunc("/verify", bcs.Verify)
+	http.HandleFunc("/metrics", bcs.Metrics)
 	http.HandleFunc("/transactions", bcs.Transactions)
 	http.HandleFunc("/mine", bcs.Mine)
 	http.HandleFunc("/mine/start", bcs.StartMine)
 	http.HandleFunc("/amount", bcs.Amount)
+	http.HandleFunc("/balance", bcs.Balance)
+	http.HandleFunc("/nonce", bcs.Nonce)
 	http.HandleFunc("/consensus", bcs.Consensus)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(bcs.Port())), nil))
+	http.HandleFunc("/announce", bcs.Announce)
+	http.HandleFunc("/peers", bcs.Peers)
+	http.HandleFunc("/ws/blocks", bcs.BlocksWebSocket)
+	ln, err := net.Listen("tcp", "0.0.0.0:"+strconv.Itoa(int(bcs.Port())))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if bcs.bootstrap != "" {
+		go func() {
+			if err := bcs.GetBlockchain().Announce(bcs.bootstrap, bcs.advertise); err != nil {
+				log.Printf("ERROR: %v", err)
+			}
+		}()
+	}
+	log.Fatal(http.Serve(ln, nil))
 }
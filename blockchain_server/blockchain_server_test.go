@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"goblockchain/block"
+	"goblockchain/wallet"
+)
+
+func TestTransactionsReturnsID(t *testing.T) {
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	bcs := NewBlockchainServer(0)
+	bc := bcs.GetBlockchain()
+	bc.SetLogger(block.NewLogger(io.Discard, block.LOG_ERROR, block.LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+	ts := httptest.NewServer(http.HandlerFunc(bcs.Transactions))
+	defer ts.Close()
+
+	sender, recipient := wallet.NewWallet(), wallet.NewWallet()
+	if _, err := bc.MineTo(sender.BlockchainAddress()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		value   block.Amount
+		status  int
+		message string
+	}{
+		{block.COIN, http.StatusOK, "success"},
+		{2 * block.MINING_REWARD, http.StatusUnprocessableEntity, "fail"},
+	} {
+		tr, err := wallet.NewTransactionRequest(sender, recipient.BlockchainAddress(), c.value, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := json.Marshal(tr)
+		req, _ := http.NewRequest(http.MethodPut, ts.URL, bytes.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got block.TransactionResponse
+		err = json.NewDecoder(resp.Body).Decode(&got)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != c.status || got.Message != c.message {
+			t.Errorf("value %s: status %d %q, want %d %q", c.value, resp.StatusCode, got.Message, c.status, c.message)
+		}
+		if want := fmt.Sprintf("%x", tr.Transaction().ID()); got.ID != want {
+			t.Errorf("value %s: returned ID %s, want %s", c.value, got.ID, want)
+		}
+	}
+
+	pool := bc.CopyTransactionPool()
+	if len(pool) != 1 {
+		t.Fatalf("pool holds %d transactions, want 1", len(pool))
+	}
+}
+
+func TestMetricsUseInjectedRegistry(t *testing.T) {
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	bcs := NewBlockchainServer(0)
+	registry := NewMetrics()
+	bcs.SetMetrics(registry)
+	bc := bcs.GetBlockchain()
+	bc.SetLogger(block.NewLogger(io.Discard, block.LOG_ERROR, block.LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+	for i := 0; i < 2; i++ {
+		if !bc.Mining() {
+			t.Fatal("no block was mined")
+		}
+	}
+	if registry.blocksMined != 2 || registry.proofOfWorkCount != 2 {
+		t.Fatalf("registry counted %d blocks and %d proofs of work, want 2 each", registry.blocksMined, registry.proofOfWorkCount)
+	}
+
+	rec := httptest.NewRecorder()
+	bcs.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		"goblockchain_blocks_mined_total 2",
+		"goblockchain_proof_of_work_seconds_count 2",
+		"goblockchain_chain_height 2",
+		"goblockchain_mempool_transactions 0",
+		"goblockchain_difficulty 1",
+		"goblockchain_neighbours 0",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("/metrics lacks %q", line)
+		}
+	}
+}
+
+func TestSubmitTransactionRejectsMalformedRequests(t *testing.T) {
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	bcs := NewBlockchainServer(0)
+	bc := bcs.GetBlockchain()
+	bc.SetLogger(block.NewLogger(io.Discard, block.LOG_ERROR, block.LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+	sender, recipient := wallet.NewWallet(), wallet.NewWallet()
+	if _, err := bc.MineTo(sender.BlockchainAddress()); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(body []byte) int {
+		rec := httptest.NewRecorder()
+		bcs.Transactions(rec, httptest.NewRequest(http.MethodPost, "/transactions", bytes.NewReader(body)))
+		return rec.Code
+	}
+	request := func(edit func(tr *block.TransactionRequest)) []byte {
+		tr, err := wallet.NewTransactionRequest(sender, recipient.BlockchainAddress(), block.COIN/10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edit(tr)
+		body, _ := json.Marshal(tr)
+		return body
+	}
+	text := func(s string) *string { return &s }
+
+	for _, c := range []struct {
+		name string
+		body []byte
+	}{
+		{"not JSON", []byte("{")},
+		{"missing signature", request(func(tr *block.TransactionRequest) { tr.Signature = nil })},
+		{"missing public key", request(func(tr *block.TransactionRequest) { tr.SenderPublicKey = nil })},
+		{"missing value", request(func(tr *block.TransactionRequest) { tr.Value = nil })},
+		{"public key not hex", request(func(tr *block.TransactionRequest) { tr.SenderPublicKey = text(strings.Repeat("zz", 64)) })},
+		{"public key too short", request(func(tr *block.TransactionRequest) { tr.SenderPublicKey = text((*tr.SenderPublicKey)[:126]) })},
+		{"signature not hex", request(func(tr *block.TransactionRequest) { tr.Signature = text(strings.Repeat("g", len(*tr.Signature))) })},
+		{"signature too short", request(func(tr *block.TransactionRequest) { tr.Signature = text((*tr.Signature)[:10]) })},
+	} {
+		if status := post(c.body); status != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", c.name, status)
+		}
+	}
+	if pool := bc.CopyTransactionPool(); len(pool) != 0 {
+		t.Fatalf("pool holds %d malformed transactions", len(pool))
+	}
+
+	if status := post(request(func(*block.TransactionRequest) {})); status != http.StatusCreated {
+		t.Fatalf("well-formed request: status %d, want 201", status)
+	}
+}
+
+// TestVerifyDetectsCorruptedNonce corrupts the tip's nonce, which breaks
+// only its proof of work, and expects /verify to report the tip's height.
+func TestVerifyDetectsCorruptedNonce(t *testing.T) {
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	bcs := NewBlockchainServer(0)
+	bc := bcs.GetBlockchain()
+	bc.SetLogger(block.NewLogger(io.Discard, block.LOG_ERROR, block.LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+	for i := 0; i < 3; i++ {
+		if !bc.Mining() {
+			t.Fatal("no block was mined")
+		}
+	}
+
+	verify := func() (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		bcs.Verify(rec, httptest.NewRequest(http.MethodGet, "/verify", nil))
+		var report map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, report
+	}
+	if status, report := verify(); status != http.StatusOK || report["valid"] != true {
+		t.Fatalf("intact chain: status %d, report %v", status, report)
+	}
+
+	tip := bc.LastBlock()
+	difficulty := bc.Params().At(3).Difficulty
+	for tip.Nonce++; bc.ValidProof(tip.Nonce, tip.PreviousHash, tip.Transactions, difficulty); tip.Nonce++ {
+	}
+	if err := bc.VerifyOwnChain(); err == nil {
+		t.Fatal("VerifyOwnChain missed the corrupted nonce")
+	}
+	status, report := verify()
+	if status != http.StatusConflict || report["valid"] != false || report["height"] != float64(3) {
+		t.Fatalf("corrupted nonce: status %d, report %v; want 409 naming height 3", status, report)
+	}
+}
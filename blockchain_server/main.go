@@ -2,7 +2,13 @@ package main
 
 import (
 	"flag"
+	"fmt"
+	"goblockchain/block"
 	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func init() {
@@ -11,7 +17,128 @@ func init() {
 
 func main() {
 	port := flag.Uint("port", 5001, "TCP Port Number for Blockchain Server")
+	chainFile := flag.String("chain_file", "", "File to persist the chain in and reload it from")
+	peersFile := flag.String("peers_file", "", "File to persist known-good neighbours in")
+	logFormat := flag.String("log_format", "text", "Log format: text or json")
+	primary := flag.String("primary", "", "Run as a read replica of this host:port")
+	consensus := flag.String("consensus", "pow", "Consensus mode: pow or pos")
+	difficulty := flag.Int("difficulty", block.MINING_DIFFICULTY, "Proof-of-work difficulty")
+	targetBlockSec := flag.Int("target_block_sec", 0, "Retarget difficulty toward this block interval in seconds (0 keeps it fixed)")
+	miningThreads := flag.Int("mining_threads", 0, "Goroutines used for proof of work (0 uses every CPU)")
+	archive := flag.Bool("archive", false, "Index every transaction, address and historical balance (uses much more memory)")
+	utxo := flag.Bool("utxo", false, "Also track the chain as unspent outputs for coin selection")
+	peers := flag.String("peers", "", "Comma-separated host:port neighbours to register explicitly")
+	noScan := flag.Bool("no_scan", false, "Only use registered, persisted and announced neighbours, without scanning IP ranges")
+	verify := flag.Bool("verify", false, "Verify the whole chain under the configured params at startup and exit if it fails")
+	miningSender := flag.String("mining_sender", "", "Sender label of coinbase transactions, shared by every node")
+	checkpoints := flag.String("checkpoints", "", "Comma-separated height:hash pairs every accepted chain must contain")
+	mempoolMaxAge := flag.Duration("mempool_max_age", block.MEMPOOL_MAX_AGE, "How long a transaction may wait in the pool before it is dropped; 0 keeps it")
+	bootstrap := flag.String("bootstrap", "", "Announce this node to the bootstrap node at host:port")
+	advertise := flag.String("advertise", "", "host:port announced to the bootstrap node")
+	genesis := flag.String("genesis", "", "JSON genesis config with a timestamp and allocations in smallest units, shared by every node")
+	halvingInterval := flag.Int("halving_interval", 0, "Halve the mining reward every this many blocks (0 keeps it constant)")
+	requireNonce := flag.Bool("require_nonce", false, "Refuse transactions without a replay-protection nonce")
 	flag.Parse()
 	app := NewBlockchainServer(uint16(*port))
+	if *chainFile != "" {
+		app.SetChainFile(*chainFile)
+	}
+	if *genesis != "" {
+		cfg, err := block.LoadGenesisConfig(*genesis)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		app.SetGenesis(cfg)
+	}
+	// The params must be final before the chain is created, since a saved
+	// chain is validated under them as it is loaded.
+	params := app.Params()
+	if *consensus == "pos" {
+		params.Consensus = block.CONSENSUS_POS
+	}
+	if *targetBlockSec > 0 {
+		params.TargetBlockInterval = time.Duration(*targetBlockSec) * time.Second
+	}
+	if *difficulty < block.MIN_DIFFICULTY || *difficulty > block.MAX_DIFFICULTY {
+		log.Fatalf("ERROR: difficulty must be between %d and %d", block.MIN_DIFFICULTY, block.MAX_DIFFICULTY)
+	}
+	params.Difficulty = *difficulty
+	if *miningSender != "" {
+		params.CoinbaseSender = *miningSender
+	}
+	if *checkpoints != "" {
+		cps, err := parseCheckpoints(*checkpoints)
+		if err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+		params.Checkpoints = cps
+	}
+	if *halvingInterval > 0 {
+		params.RewardPolicy = block.HalvingReward{Base: block.MINING_REWARD, Interval: *halvingInterval}
+	}
+	app.SetParams(params)
+	if *primary != "" {
+		app.GetBlockchain().SetPrimary(*primary)
+	}
+	if *logFormat == "json" {
+		app.GetBlockchain().SetLogger(block.NewLogger(os.Stderr, block.LOG_INFO, block.LOG_FORMAT_JSON))
+	}
+	if *miningThreads > 0 {
+		app.GetBlockchain().SetMiningThreads(*miningThreads)
+	}
+	if *mempoolMaxAge != block.MEMPOOL_MAX_AGE {
+		app.GetBlockchain().SetMempoolMaxAge(*mempoolMaxAge)
+	}
+	if *requireNonce {
+		app.GetBlockchain().SetRequireNonce(true)
+	}
+	if *archive {
+		app.GetBlockchain().SetArchiveMode(true)
+	}
+	if *utxo {
+		app.GetBlockchain().SetUTXOMode(true)
+	}
+	if *verify {
+		if err := app.GetBlockchain().VerifyOwnChain(); err != nil {
+			log.Fatalf("ERROR: %v", err)
+		}
+	}
+	if *noScan {
+		app.GetBlockchain().SetNeighbourScan(false)
+	}
+	for _, p := range strings.Split(*peers, ",") {
+		if p == "" {
+			continue
+		}
+		if err := app.GetBlockchain().AddNeighbour(strings.TrimSpace(p)); err != nil {
+			log.Fatalf("ERROR: peer %q: %v", p, err)
+		}
+	}
+	if *peersFile != "" {
+		app.GetBlockchain().SetPeersFile(*peersFile)
+	}
+	if *bootstrap != "" {
+		app.SetBootstrap(*bootstrap, *advertise)
+	}
 	app.Run()
 }
+
+func parseCheckpoints(s string) (block.Checkpoints, error) {
+	checkpoints := make(block.Checkpoints)
+	for _, pair := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("checkpoint %q: want height:hash", pair)
+		}
+		height, err := strconv.Atoi(parts[0])
+		if err != nil || height < 0 {
+			return nil, fmt.Errorf("checkpoint %q: invalid height", pair)
+		}
+		hash, err := block.ParseHash(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %q: %v", pair, err)
+		}
+		checkpoints[height] = hash
+	}
+	return checkpoints, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"goblockchain/block"
+	"io"
+	"sync"
+	"time"
+)
+
+// Metrics collects the node's counters as a block.Metrics and renders them,
+// with gauges taken from the chain's Stats, in the Prometheus text format.
+type Metrics struct {
+	mux                sync.Mutex
+	blocksMined        uint64
+	proofOfWorkCount   uint64
+	proofOfWorkSeconds float64
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+func (m *Metrics) BlockMined() {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.blocksMined++
+}
+
+func (m *Metrics) ProofOfWorkDone(d time.Duration) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.proofOfWorkCount++
+	m.proofOfWorkSeconds += d.Seconds()
+}
+
+func writeMetric(w io.Writer, name, kind, help string, value interface{}) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+}
+
+// Render writes the counters and the gauges in s.
+func (m *Metrics) Render(w io.Writer, s *block.Stats) {
+	m.mux.Lock()
+	blocksMined, count, seconds := m.blocksMined, m.proofOfWorkCount, m.proofOfWorkSeconds
+	m.mux.Unlock()
+
+	writeMetric(w, "goblockchain_blocks_mined_total", "counter", "Blocks mined by this node.", blocksMined)
+	fmt.Fprintf(w, "# HELP goblockchain_proof_of_work_seconds Time spent searching for proof of work.\n"+
+		"# TYPE goblockchain_proof_of_work_seconds summary\n"+
+		"goblockchain_proof_of_work_seconds_sum %g\ngoblockchain_proof_of_work_seconds_count %d\n", seconds, count)
+	writeMetric(w, "goblockchain_chain_height", "gauge", "Height of the chain tip.", s.Height)
+	writeMetric(w, "goblockchain_mempool_transactions", "gauge", "Transactions waiting in the pool.", s.PendingTransactions)
+	writeMetric(w, "goblockchain_difficulty", "gauge", "Current proof-of-work difficulty.", s.Difficulty)
+	writeMetric(w, "goblockchain_neighbours", "gauge", "Known neighbours.", s.Neighbours)
+}
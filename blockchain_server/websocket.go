@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal server side of RFC 6455: enough to push text messages to a
+// browser or client and notice when it goes away.
+
+const (
+	WS_GUID          = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	WS_WRITE_TIMEOUT = 10 * time.Second
+	// WS_MAX_CLIENT_PAYLOAD bounds a frame from a client, which only listens
+	// and has no reason to send much.
+	WS_MAX_CLIENT_PAYLOAD  = 1 << 16
+	WS_MAX_CONTROL_PAYLOAD = 125
+
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+type wsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	mux    sync.Mutex
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgradeWebSocket completes the opening handshake and takes over the
+// connection. On failure it has already answered the request.
+func upgradeWebSocket(w http.ResponseWriter, req *http.Request) (*wsConn, error) {
+	key := req.Header.Get("Sec-WebSocket-Key")
+	if req.Method != http.MethodGet || !headerContains(req.Header, "Connection", "upgrade") ||
+		!headerContains(req.Header, "Upgrade", "websocket") || key == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return nil, errors.New("websocket: not a websocket handshake")
+	}
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		w.WriteHeader(http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, errors.New("websocket: connection cannot be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	h := sha1.Sum([]byte(key + WS_GUID))
+	_, err = fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n",
+		base64.StdEncoding.EncodeToString(h[:]))
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, reader: rw.Reader}, nil
+}
+
+// writeFrame sends one unfragmented, unmasked frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126, byte(n>>8), byte(n))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(n))
+		header = append(append(header, 127), ext[:]...)
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *wsConn) WriteText(payload []byte) error {
+	return c.writeFrame(wsOpText, payload)
+}
+
+// readLoop answers pings and returns once the client closes the connection
+// or breaks the protocol. Data frames are discarded.
+func (c *wsConn) readLoop() error {
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(c.reader, h[:]); err != nil {
+			return err
+		}
+		opcode := h[0] & 0x0F
+		if h[1]&0x80 == 0 {
+			return errors.New("websocket: unmasked client frame")
+		}
+		n := uint64(h[1] & 0x7F)
+		switch n {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+				return err
+			}
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(c.reader, ext[:]); err != nil {
+				return err
+			}
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		var mask [4]byte
+		if _, err := io.ReadFull(c.reader, mask[:]); err != nil {
+			return err
+		}
+		if n > WS_MAX_CLIENT_PAYLOAD || opcode >= wsOpClose && n > WS_MAX_CONTROL_PAYLOAD {
+			return errors.New("websocket: oversized frame")
+		}
+		if opcode < wsOpClose {
+			if _, err := io.CopyN(io.Discard, c.reader, int64(n)); err != nil {
+				return err
+			}
+			continue
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(c.reader, payload); err != nil {
+			return err
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		switch opcode {
+		case wsOpClose:
+			c.writeFrame(wsOpClose, payload)
+			return nil
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goblockchain/block"
+)
+
+// readServerFrame reads one unmasked frame sent by the server.
+func readServerFrame(t *testing.T, r *bufio.Reader) (opcode byte, payload []byte) {
+	t.Helper()
+	var h [2]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := uint64(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return h[0] & 0x0F, payload
+}
+
+// writeClientFrame sends a masked frame with a payload under 126 bytes, as
+// a client must.
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBlocksWebSocket(t *testing.T) {
+	t.Cleanup(func() { delete(cache, "blockchain") })
+	bcs := NewBlockchainServer(0)
+	bc := bcs.GetBlockchain()
+	bc.SetLogger(block.NewLogger(io.Discard, block.LOG_ERROR, block.LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+	ts := httptest.NewServer(http.HandlerFunc(bcs.BlocksWebSocket))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("plain GET: status %d, want 400", resp.StatusCode)
+	}
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	// The key and accept value are the example of RFC 6455 section 1.3.
+	fmt.Fprintf(conn, "GET /ws/blocks HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n", ts.Listener.Addr())
+	r := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake: status %d, want 101", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("handshake: accept %q", got)
+	}
+
+	// The server subscribes before it starts reading, so the pong means
+	// the next block will be sent.
+	writeClientFrame(t, conn, wsOpPing, []byte("hi"))
+	if op, payload := readServerFrame(t, r); op != wsOpPong || string(payload) != "hi" {
+		t.Fatalf("got opcode %#x %q, want a pong echoing the ping", op, payload)
+	}
+
+	for height := 1; height <= 2; height++ {
+		if !bc.Mining() {
+			t.Fatal("mining failed")
+		}
+		op, payload := readServerFrame(t, r)
+		if op != wsOpText {
+			t.Fatalf("got opcode %#x, want a text message", op)
+		}
+		var m struct {
+			Height int          `json:"height"`
+			Hash   string       `json:"hash"`
+			Block  *block.Block `json:"block"`
+		}
+		if err := json.Unmarshal(payload, &m); err != nil {
+			t.Fatal(err)
+		}
+		want := bc.LastBlock()
+		if m.Height != height || m.Hash != fmt.Sprintf("%x", want.Hash()) {
+			t.Fatalf("got block %d %s, want %d %x", m.Height, m.Hash, height, want.Hash())
+		}
+		if m.Block == nil || m.Block.Hash() != want.Hash() {
+			t.Fatalf("block %d does not match the mined block", height)
+		}
+	}
+
+	writeClientFrame(t, conn, wsOpClose, nil)
+	if op, _ := readServerFrame(t, r); op != wsOpClose {
+		t.Fatalf("got opcode %#x, want the close echoed", op)
+	}
+}
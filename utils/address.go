@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// AddressFromPublicKey derives the base58 blockchain address of publicKey.
+func AddressFromPublicKey(publicKey *ecdsa.PublicKey) string {
+	//2. Perform SHA-256 hashing on the public key (32 bytes).
+	h2 := sha256.New()
+	h2.Write(publicKey.X.Bytes())
+	h2.Write(publicKey.Y.Bytes())
+	digest2 := h2.Sum(nil)
+
+	//3. Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
+	h3 := ripemd160.New()
+	h3.Write(digest2)
+	digest3 := h3.Sum(nil)
+
+	//4. Add version byte in front of RIPEMD-160 hash (0x00 for Main Network).
+	vd4 := make([]byte, 21)
+	vd4[0] = 0x00
+	copy(vd4[1:], digest3[:])
+
+	//5. Perform SHA-256 hash on the extended RIPEMD-160 result.
+	h5 := sha256.New()
+	h5.Write(vd4)
+	digest5 := h5.Sum(nil)
+
+	//6. Perform SHA-256 hash on the result of the previous SHA-256 hash.
+	h6 := sha256.New()
+	h6.Write(digest5)
+	digest6 := h6.Sum(nil)
+
+	//7. Take the first 4 bytes of the second SHA-256 hash for checksum.
+	checkSum := digest6[:4]
+
+	//8. Add the 4 checksum bytes from 7 at the end of extended RIPEMD-160 hash from 4 (25 bytes).
+	dc8 := make([]byte, 25)
+	copy(dc8[:21], vd4[:])
+	copy(dc8[21:], checkSum[:])
+
+	//9. Convert the result from a byte string into base58.
+	return base58.Encode(dc8)
+}
+
+// IsValidBlockchainAddress checks that address is a base58 encoded 25 byte
+// payload whose last 4 bytes are the double SHA-256 checksum of the rest.
+func IsValidBlockchainAddress(address string) bool {
+	decoded := base58.Decode(address)
+	if len(decoded) != 25 {
+		return false
+	}
+	first := sha256.Sum256(decoded[:21])
+	second := sha256.Sum256(first[:])
+	return bytes.Equal(second[:4], decoded[21:])
+}
@@ -8,6 +8,8 @@ import (
 	"math/big"
 )
 
+const KEY_HEX_LEN = 128
+
 type Signature struct {
 	R *big.Int
 	S *big.Int
@@ -52,3 +54,37 @@ func PrivateKeyFromString(s string, publicKey *ecdsa.PublicKey) *ecdsa.PrivateKe
 		D:         &bi,
 	}
 }
+
+func parseBigIntTuple(s string) (*big.Int, *big.Int, error) {
+	if len(s) != KEY_HEX_LEN {
+		return nil, nil, fmt.Errorf("expected %d hex characters, got %d", KEY_HEX_LEN, len(s))
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return new(big.Int).SetBytes(b[:32]), new(big.Int).SetBytes(b[32:]), nil
+}
+
+// ParseSignature is like SignatureFromString but rejects malformed input.
+func ParseSignature(str string) (*Signature, error) {
+	r, s, err := parseBigIntTuple(str)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature: %w", err)
+	}
+	return &Signature{R: r, S: s}, nil
+}
+
+// ParsePublicKey is like PublicKeyFromString but rejects malformed input and
+// points that are not on the P-256 curve.
+func ParsePublicKey(s string) (*ecdsa.PublicKey, error) {
+	x, y, err := parseBigIntTuple(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	curve := elliptic.P256()
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("invalid public key: point is not on curve")
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
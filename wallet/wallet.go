@@ -6,12 +6,20 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/btcsuite/btcutil/base58"
+	"goblockchain/block"
 	"goblockchain/utils"
-	"golang.org/x/crypto/ripemd160"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/crypto/hkdf"
 )
 
+const WALLET_SEED_INFO = "goblockchain wallet"
+
 type Wallet struct {
 	privateKey        *ecdsa.PrivateKey
 	publicKey         *ecdsa.PublicKey
@@ -25,45 +33,42 @@ func NewWallet() *Wallet {
 	w.privateKey = privateKey
 	w.publicKey = &w.privateKey.PublicKey
 
-	//2. Perform SHA-256 hashing on the public key (32 bytes).
-	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
-	digest2 := h2.Sum(nil)
-
-	//3. Perform RIPEMD-160 hashing on the result of SHA-256 (20 bytes).
-	h3 := ripemd160.New()
-	h3.Write(digest2)
-	digest3 := h3.Sum(nil)
-
-	//4. Add version byte in front of RIPEMD-160 hash (0x00 for Main Network).
-	vd4 := make([]byte, 21)
-	vd4[0] = 0x00
-	copy(vd4[1:], digest3[:])
+	w.blockchainAddress = utils.AddressFromPublicKey(w.publicKey)
 
-	//5. Perform SHA-256 hash on the extended RIPEMD-160 result.
-	h5 := sha256.New()
-	h5.Write(vd4)
-	digest5 := h5.Sum(nil)
-
-	//6. Perform SHA-256 hash on the result of the previous SHA-256 hash.
-	h6 := sha256.New()
-	h6.Write(digest5)
-	digest6 := h6.Sum(nil)
-
-	//7. Take the first 4 bytes of the second SHA-256 hash for checksum.
-	checkSum := digest6[:4]
+	return w
+}
 
-	//8. Add the 4 checksum bytes from 7 at the end of extended RIPEMD-160 hash from 4 (25 bytes).
-	dc8 := make([]byte, 25)
-	copy(dc8[:21], vd4[:])
-	copy(dc8[21:], checkSum[:])
+// WalletFromSeed derives a wallet deterministically from seed, so the same
+// seed always yields the same keys and address. The seed should carry at
+// least 128 bits of entropy.
+func WalletFromSeed(seed []byte) (*Wallet, error) {
+	if len(seed) == 0 {
+		return nil, errors.New("wallet: empty seed")
+	}
+	curve := elliptic.P256()
+	params := curve.Params()
+
+	// Read 64 extra bits and reduce into [1, N-1] so the bias is negligible
+	// (FIPS 186-4 B.4.1).
+	buf := make([]byte, params.BitSize/8+8)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, seed, nil, []byte(WALLET_SEED_INFO)), buf); err != nil {
+		return nil, err
+	}
+	k := new(big.Int).SetBytes(buf)
+	n := new(big.Int).Sub(params.N, big.NewInt(1))
+	k.Mod(k, n)
+	k.Add(k, big.NewInt(1))
 
-	//9. Convert the result from a byte string into base58.
-	address := base58.Encode(dc8)
-	w.blockchainAddress = address
+	privateKey := new(ecdsa.PrivateKey)
+	privateKey.PublicKey.Curve = curve
+	privateKey.D = k
+	privateKey.PublicKey.X, privateKey.PublicKey.Y = curve.ScalarBaseMult(k.Bytes())
 
-	return w
+	w := new(Wallet)
+	w.privateKey = privateKey
+	w.publicKey = &w.privateKey.PublicKey
+	w.blockchainAddress = utils.AddressFromPublicKey(w.publicKey)
+	return w, nil
 }
 
 func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
@@ -101,12 +106,15 @@ func (w *Wallet) MarshalJSON() ([]byte, error) {
 type Transaction struct {
 	senderPrivateKey           *ecdsa.PrivateKey
 	senderPublicKey            *ecdsa.PublicKey
-	SenderBlockchainAddress    string  `json:"senderBlockchainAddress"`
-	RecipientBlockchainAddress string  `json:"recipientBlockchainAddress"`
-	Value                      float32 `json:"value"`
+	SenderBlockchainAddress    string       `json:"senderBlockchainAddress"`
+	RecipientBlockchainAddress string       `json:"recipientBlockchainAddress"`
+	Value                      block.Amount `json:"value"`
+	Fee                        block.Amount `json:"fee,omitempty"`
+	Nonce                      uint64       `json:"nonce,omitempty"`
+	RecentBlockHash            string       `json:"recentBlockHash,omitempty"`
 }
 
-func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, sender string, recipient string, value float32) *Transaction {
+func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, sender string, recipient string, value block.Amount) *Transaction {
 	return &Transaction{
 		senderPrivateKey:           privateKey,
 		senderPublicKey:            publicKey,
@@ -117,13 +125,69 @@ func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey, se
 }
 
 func (t *Transaction) GenerateSignature() *utils.Signature {
-	m, _ := json.Marshal(t)
+	signature, _ := t.sign()
+	return signature
+}
+
+func (t *Transaction) sign() (*utils.Signature, error) {
+	m, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
 	h := sha256.Sum256([]byte(m))
-	r, s, _ := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
+	r, s, err := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
+	if err != nil {
+		return nil, err
+	}
 	return &utils.Signature{
 		R: r,
 		S: s,
+	}, nil
+}
+
+// NextNonce asks the blockchain server at gateway, a base URL such as
+// http://127.0.0.1:5001, for the nonce address's next transaction should
+// carry.
+func NextNonce(client *http.Client, gateway string, address string) (uint64, error) {
+	resp, err := client.Get(fmt.Sprintf("%s/nonce?blockchain_address=%s", gateway, url.QueryEscape(address)))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("next nonce: unexpected status %d", resp.StatusCode)
+	}
+	var nr block.NonceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&nr); err != nil {
+		return 0, fmt.Errorf("next nonce: %v", err)
+	}
+	return nr.Nonce, nil
+}
+
+// NewTransactionRequest signs a transfer of value from w to recipient with
+// the given nonce, which NextNonce fetches, and encodes it as the request
+// the blockchain server's /transactions endpoint expects.
+func NewTransactionRequest(w *Wallet, recipient string, value block.Amount, nonce uint64) (*block.TransactionRequest, error) {
+	t := NewTransaction(w.PrivateKey(), w.PublicKey(), w.BlockchainAddress(), recipient, value)
+	t.Nonce = nonce
+	signature, err := t.sign()
+	if err != nil {
+		return nil, err
+	}
+	sender := w.BlockchainAddress()
+	publicKeyStr := w.PublicKeyStr()
+	signatureStr := signature.String()
+	tr := &block.TransactionRequest{
+		SenderBlockchainAddress:    &sender,
+		RecipientBlockchainAddress: &recipient,
+		SenderPublicKey:            &publicKeyStr,
+		Value:                      &value,
+		Signature:                  &signatureStr,
+	}
+	if nonce != 0 {
+		tr.Nonce = &nonce
 	}
+	return tr, nil
 }
 
 type TransactionRequest struct {
@@ -132,6 +196,8 @@ type TransactionRequest struct {
 	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
 	SenderPublicKey            *string `json:"sender_public_key"`
 	Value                      *string `json:"value"`
+	Fee                        *string `json:"fee,omitempty"`
+	Nonce                      *string `json:"nonce,omitempty"`
 }
 
 func (tr *TransactionRequest) ValidateTransactionRequest() bool {
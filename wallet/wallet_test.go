@@ -0,0 +1,124 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"goblockchain/block"
+	"goblockchain/utils"
+)
+
+func TestTransactionRequestCarriesNextNonce(t *testing.T) {
+	w := NewWallet()
+	bc := block.NewBlockchain(w.BlockchainAddress(), 0)
+	bc.SetLogger(block.NewLogger(io.Discard, block.LOG_ERROR, block.LOG_FORMAT_TEXT))
+	bc.SetDifficulty(1)
+	for i := 0; i < 2; i++ {
+		if !bc.Mining() {
+			t.Fatal("mining failed")
+		}
+	}
+	gateway := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/nonce" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		m, _ := json.Marshal(&block.NonceResponse{Nonce: bc.NextNonce(req.URL.Query().Get("blockchain_address"))})
+		rw.Write(m)
+	}))
+	defer gateway.Close()
+
+	recipient := NewWallet().BlockchainAddress()
+	for want := uint64(1); want <= 2; want++ {
+		nonce, err := NextNonce(http.DefaultClient, gateway.URL, w.BlockchainAddress())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonce != want {
+			t.Fatalf("next nonce %d, want %d", nonce, want)
+		}
+		tr, err := NewTransactionRequest(w, recipient, block.COIN/4, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr.Nonce == nil || *tr.Nonce != nonce {
+			t.Fatalf("request nonce %v, want %d", tr.Nonce, nonce)
+		}
+		publicKey, err := utils.ParsePublicKey(*tr.SenderPublicKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := utils.ParseSignature(*tr.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := bc.AddSignedTransactionE(tr.Transaction(), publicKey, signature); err != nil {
+			t.Fatalf("transaction %d rejected: %v", nonce, err)
+		}
+	}
+}
+
+func TestWalletFromSeed(t *testing.T) {
+	seed := []byte("correct horse battery staple, 128 bits at least")
+	a, err := WalletFromSeed(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := WalletFromSeed(append([]byte(nil), seed...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.BlockchainAddress() != b.BlockchainAddress() || a.PrivateKeyStr() != b.PrivateKeyStr() {
+		t.Fatal("the same seed gave different wallets")
+	}
+	if !utils.IsValidBlockchainAddress(a.BlockchainAddress()) {
+		t.Fatalf("invalid address %s", a.BlockchainAddress())
+	}
+
+	tx := NewTransaction(a.PrivateKey(), a.PublicKey(), a.BlockchainAddress(), NewWallet().BlockchainAddress(), block.COIN)
+	signature := tx.GenerateSignature()
+	m, _ := json.Marshal(tx)
+	h := sha256.Sum256(m)
+	if !ecdsa.Verify(b.PublicKey(), h[:], signature.R, signature.S) {
+		t.Fatal("a signature by one wallet does not verify with the other's key")
+	}
+
+	other, err := WalletFromSeed(append(seed, '!'))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.BlockchainAddress() == a.BlockchainAddress() {
+		t.Fatal("different seeds gave the same address")
+	}
+	if _, err := WalletFromSeed(nil); err == nil {
+		t.Fatal("an empty seed gave a wallet")
+	}
+}
+
+func TestNewTransactionRequestVerifies(t *testing.T) {
+	w := NewWallet()
+	recipient := NewWallet().BlockchainAddress()
+	for _, nonce := range []uint64{0, 7} {
+		tr, err := NewTransactionRequest(w, recipient, 3*block.COIN/2, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tr.ValidateTransactionRequest() {
+			t.Fatalf("nonce %d: request fails ValidateTransactionRequest", nonce)
+		}
+		if ok, err := tr.VerifySignature(); err != nil || !ok {
+			t.Fatalf("nonce %d: VerifySignature = %v, %v", nonce, ok, err)
+		}
+
+		wrong := recipient + "x"
+		tr.RecipientBlockchainAddress = &wrong
+		if ok, _ := tr.VerifySignature(); ok {
+			t.Fatalf("nonce %d: signature verifies after changing the recipient", nonce)
+		}
+	}
+}
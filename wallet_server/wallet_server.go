@@ -20,12 +20,14 @@ const tempDir = "wallet_server/templates"
 type WalletServer struct {
 	port    uint16
 	gateway string
+	client  *http.Client
 }
 
 func NewWalletServer(port uint16, gateway string) *WalletServer {
 	return &WalletServer{
 		port:    port,
 		gateway: gateway,
+		client:  block.NewPeerClient(block.HTTP_TIMEOUT),
 	}
 }
 
@@ -81,17 +83,40 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 
 		publicKey := utils.PublicKeyFromString(*tr.SenderPublicKey)
 		privateKey := utils.PrivateKeyFromString(*tr.SenderPrivateKey, publicKey)
-		value, err := strconv.ParseFloat(*tr.Value, 32)
+		value, err := block.ParseAmount(*tr.Value)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		var fee block.Amount
+		if tr.Fee != nil {
+			fee, err = block.ParseAmount(*tr.Fee)
+			if err != nil {
+				log.Printf("ERROR: %v", err)
+				io.WriteString(w, string(utils.JsonStatus("fail")))
+				return
+			}
+		}
+		// Without a nonce of its own the transaction takes the sender's next
+		// one, so it cannot be replayed.
+		var nonce uint64
+		if tr.Nonce != nil {
+			nonce, err = strconv.ParseUint(*tr.Nonce, 10, 64)
+		} else {
+			nonce, err = wallet.NextNonce(ws.client, ws.Gateway(), *tr.SenderBlockchainAddress)
+		}
 		if err != nil {
 			log.Printf("ERROR: %v", err)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
-		value32 := float32(value)
 
 		w.Header().Add("Content-Type", "application/json")
 
-		transaction := wallet.NewTransaction(privateKey, publicKey, *tr.SenderBlockchainAddress, *tr.RecipientBlockchainAddress, value32)
+		transaction := wallet.NewTransaction(privateKey, publicKey, *tr.SenderBlockchainAddress, *tr.RecipientBlockchainAddress, value)
+		transaction.Fee = fee
+		transaction.Nonce = nonce
 		signature := transaction.GenerateSignature()
 		signatureStr := signature.String()
 
@@ -99,13 +124,25 @@ func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Reque
 			SenderBlockchainAddress:    tr.SenderBlockchainAddress,
 			RecipientBlockchainAddress: tr.RecipientBlockchainAddress,
 			SenderPublicKey:            tr.SenderPublicKey,
-			Value:                      &value32,
+			Value:                      &value,
 			Signature:                  &signatureStr,
 		}
+		if fee != 0 {
+			bt.Fee = &fee
+		}
+		if nonce != 0 {
+			bt.Nonce = &nonce
+		}
 		m, _ := json.Marshal(bt)
 		buf := bytes.NewBuffer(m)
 
-		resp, _ := http.Post(ws.Gateway()+"/transactions", "application/json", buf)
+		resp, err := ws.client.Post(ws.Gateway()+"/transactions", "application/json", buf)
+		if err != nil {
+			log.Printf("ERROR: %v", err)
+			io.WriteString(w, string(utils.JsonStatus("fail")))
+			return
+		}
+		defer resp.Body.Close()
 		if resp.StatusCode == 201 {
 			io.WriteString(w, string(utils.JsonStatus("success")))
 			return
@@ -124,18 +161,18 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 		blockchainAddress := req.URL.Query().Get("blockchain_address")
 		endPoint := fmt.Sprintf("%s/amount", ws.Gateway())
 
-		client := &http.Client{}
 		bcsReq, _ := http.NewRequest("GET", endPoint, nil)
 		q := bcsReq.URL.Query()
 		q.Add("blockchain_address", blockchainAddress)
 		bcsReq.URL.RawQuery = q.Encode()
 
-		bcsResp, err := client.Do(bcsReq)
+		bcsResp, err := ws.client.Do(bcsReq)
 		if err != nil {
-			log.Printf("ERROR: %w", err)
+			log.Printf("ERROR: %v", err)
 			io.WriteString(w, string(utils.JsonStatus("fail")))
 			return
 		}
+		defer bcsResp.Body.Close()
 
 		w.Header().Add("Content-Type", "application/json")
 		if bcsResp.StatusCode == 200 {
@@ -149,11 +186,11 @@ func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
 			}
 
 			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
+				Message string `json:"message"`
+				Amount  string `json:"amount"`
 			}{
 				Message: "success",
-				Amount:  bar.Amount,
+				Amount:  bar.Amount.String(),
 			})
 			io.WriteString(w, string(m[:]))
 		} else {
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"goblockchain/block"
+)
+
+func TestWalletAmountGivesUpOnHangingGateway(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer gateway.Close()
+
+	const timeout = 100 * time.Millisecond
+	ws := NewWalletServer(0, gateway.URL)
+	ws.client = block.NewPeerClient(timeout)
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	ws.WalletAmount(rec, httptest.NewRequest(http.MethodGet, "/wallet/amount?blockchain_address=x", nil))
+	if elapsed := time.Since(start); elapsed > timeout+time.Second {
+		t.Fatalf("answered after %v", elapsed)
+	}
+	if !strings.Contains(rec.Body.String(), "fail") {
+		t.Fatalf("got %q, want a fail status", rec.Body.String())
+	}
+}